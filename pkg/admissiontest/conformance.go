@@ -0,0 +1,57 @@
+package admissiontest
+
+import (
+	"context"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ConformanceCase is an operation on objects to check the responses of the admission hooks to.
+type ConformanceCase struct {
+	// Name is the name of the subtests of the case.
+	Name      string
+	Operation admissionv1.Operation
+	// Object is the object to create or update to. OldObject is the object to update or delete.
+	Object    runtime.Object
+	OldObject runtime.Object
+	// Options modify the admission request of the case. The version of the AdmissionReview does not matter, the
+	// hooks are called with v1 requests.
+	Options []RequestOption
+}
+
+// CheckConformance calls every admission hook of the server with the admission request of every case, and fails the
+// test for every violation of the admission protocol by a response. These are the violations the server fixes up, or
+// denies requests for in strict conformance mode. Every hook and case runs in a subtest named after the resource the
+// hook is served on and the case.
+func (s *Server) CheckConformance(t *testing.T, cases ...ConformanceCase) {
+	t.Helper()
+
+	requests := make([]*admissionv1.AdmissionRequest, 0, len(cases))
+	for _, c := range cases {
+		if c.Object == nil && c.OldObject == nil {
+			t.Fatalf("conformance case %q has no object", c.Name)
+		}
+		config := &requestConfig{version: admissionv1.SchemeGroupVersion, request: s.request(c.Operation, c.Object, c.OldObject)}
+		for _, option := range c.Options {
+			option(config)
+		}
+		requests = append(requests, config.request)
+	}
+
+	for _, resource := range s.reviewer.Resources() {
+		for i, c := range cases {
+			request := requests[i]
+			t.Run(resource.Resource+"."+resource.Version+"."+resource.Group+"/"+c.Name, func(t *testing.T) {
+				violations, err := s.reviewer.Verify(context.Background(), resource, request)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, v := range violations {
+					t.Errorf("the response violates the admission protocol: %s", v)
+				}
+			})
+		}
+	}
+}
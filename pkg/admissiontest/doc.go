@@ -0,0 +1,10 @@
+// Package admissiontest starts admission servers with the admission hooks under test in process, and sends them
+// AdmissionReviews for objects like the Kubernetes API server does.
+//
+//	server := admissiontest.NewServer(t, []apiserver.AdmissionHook{&myHook{}})
+//	server.Create(path, &corev1.ConfigMap{...}).ExpectDenied().ExpectMessage("must not")
+//	server.Create(path, deployment).ExpectAllowed().ExpectPatched(expectedDeployment)
+//
+// CheckConformance checks the responses of the hooks against the rules of the admission protocol the server
+// enforces, like patches only coming from mutating hooks.
+package admissiontest
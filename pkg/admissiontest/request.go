@@ -0,0 +1,107 @@
+package admissiontest
+
+import (
+	"encoding/json"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+type requestConfig struct {
+	version schema.GroupVersion
+	request *admissionv1.AdmissionRequest
+}
+
+// RequestOption modifies an admission request before it is sent.
+type RequestOption func(*requestConfig)
+
+// V1Beta1 sends the request in a v1beta1 AdmissionReview.
+func V1Beta1() RequestOption {
+	return func(c *requestConfig) { c.version = admissionv1beta1.SchemeGroupVersion }
+}
+
+// AsUser sets the user making the request under admission.
+func AsUser(userInfo authenticationv1.UserInfo) RequestOption {
+	return func(c *requestConfig) { c.request.UserInfo = userInfo }
+}
+
+// WithSubResource sets the subresource of the request under admission, e.g. status.
+func WithSubResource(subResource string) RequestOption {
+	return func(c *requestConfig) {
+		c.request.SubResource = subResource
+		c.request.RequestSubResource = subResource
+	}
+}
+
+// DryRun marks the request under admission as dry run.
+func DryRun() RequestOption {
+	return func(c *requestConfig) {
+		dryRun := true
+		c.request.DryRun = &dryRun
+	}
+}
+
+// request returns the admission request of the operation on the objects. The kind is the one of the objects, or
+// looked up in the scheme of the server, and the resource is guessed from it.
+func (s *Server) request(operation admissionv1.Operation, obj, oldObj runtime.Object) *admissionv1.AdmissionRequest {
+	s.t.Helper()
+
+	ref := obj
+	if ref == nil {
+		ref = oldObj
+	}
+	gvk := s.kind(ref)
+	resource, _ := meta.UnsafeGuessKindToResource(gvk)
+	accessor, err := meta.Accessor(ref)
+	if err != nil {
+		s.t.Fatalf("failed to access the metadata of %T: %v", ref, err)
+	}
+
+	request := &admissionv1.AdmissionRequest{
+		UID:             uuid.NewUUID(),
+		Kind:            metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+		Resource:        metav1.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource},
+		RequestKind:     &metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+		RequestResource: &metav1.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource},
+		Name:            accessor.GetName(),
+		Namespace:       accessor.GetNamespace(),
+		Operation:       operation,
+	}
+	if obj != nil {
+		request.Object = runtime.RawExtension{Raw: s.encode(obj, gvk)}
+	}
+	if oldObj != nil {
+		request.OldObject = runtime.RawExtension{Raw: s.encode(oldObj, gvk)}
+	}
+	return request
+}
+
+func (s *Server) kind(obj runtime.Object) schema.GroupVersionKind {
+	s.t.Helper()
+	if gvk := obj.GetObjectKind().GroupVersionKind(); !gvk.Empty() {
+		return gvk
+	}
+	gvks, _, err := s.scheme.ObjectKinds(obj)
+	if err != nil || len(gvks) == 0 {
+		s.t.Fatalf("failed to look up the kind of %T, set its apiVersion and kind or use WithScheme: %v", obj, err)
+	}
+	return gvks[0]
+}
+
+// encode returns the JSON of the object with its apiVersion and kind set.
+func (s *Server) encode(obj runtime.Object, gvk schema.GroupVersionKind) []byte {
+	s.t.Helper()
+	obj = obj.DeepCopyObject()
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	data, err := json.Marshal(obj)
+	if err != nil {
+		s.t.Fatalf("failed to encode %T: %v", obj, err)
+	}
+	return data
+}
@@ -0,0 +1,163 @@
+package admissiontest
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Response is the response of an admission hook to a request, with assertions. Failed assertions are reported with
+// Errorf, so that all of them are seen.
+type Response struct {
+	*admissionv1.AdmissionResponse
+
+	// Request is the request the response is for.
+	Request *admissionv1.AdmissionRequest
+
+	t      testing.TB
+	scheme *runtime.Scheme
+}
+
+// ExpectAllowed expects the request to be allowed.
+func (r *Response) ExpectAllowed() *Response {
+	r.t.Helper()
+	if !r.Allowed {
+		r.t.Errorf("expected the request to be allowed, but it was denied: %s", r.message())
+	}
+	return r
+}
+
+// ExpectDenied expects the request to be denied.
+func (r *Response) ExpectDenied() *Response {
+	r.t.Helper()
+	if r.Allowed {
+		r.t.Errorf("expected the request to be denied, but it was allowed")
+	}
+	return r
+}
+
+// ExpectCode expects the status code of the result.
+func (r *Response) ExpectCode(code int32) *Response {
+	r.t.Helper()
+	if r.Result == nil || r.Result.Code != code {
+		r.t.Errorf("expected the result code %d, got %v", code, r.Result)
+	}
+	return r
+}
+
+// ExpectMessage expects the message of the result to contain the given substring.
+func (r *Response) ExpectMessage(substring string) *Response {
+	r.t.Helper()
+	if !strings.Contains(r.message(), substring) {
+		r.t.Errorf("expected the message to contain %q, got %q", substring, r.message())
+	}
+	return r
+}
+
+// ExpectWarnings expects exactly the given warnings, in order.
+func (r *Response) ExpectWarnings(warnings ...string) *Response {
+	r.t.Helper()
+	if len(warnings) == 0 && len(r.Warnings) == 0 {
+		return r
+	}
+	if !reflect.DeepEqual(warnings, r.Warnings) {
+		r.t.Errorf("expected the warnings %q, got %q", warnings, r.Warnings)
+	}
+	return r
+}
+
+// ExpectNoPatch expects the response to leave the object unchanged.
+func (r *Response) ExpectNoPatch() *Response {
+	r.t.Helper()
+	if len(r.Patch) > 0 {
+		r.t.Errorf("expected no patch, got %s", r.Patch)
+	}
+	return r
+}
+
+// ExpectPatched expects the object of the request, with the patch of the response applied, to equal the given
+// object. The object is compared as JSON, so its apiVersion and kind must be set or be known to the scheme of the
+// server.
+func (r *Response) ExpectPatched(expected runtime.Object) *Response {
+	r.t.Helper()
+	patched, ok := r.patchedObject()
+	if !ok {
+		return r
+	}
+
+	expected = expected.DeepCopyObject()
+	if expected.GetObjectKind().GroupVersionKind().Empty() {
+		if gvks, _, err := r.scheme.ObjectKinds(expected); err == nil && len(gvks) > 0 {
+			expected.GetObjectKind().SetGroupVersionKind(gvks[0])
+		}
+	}
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		r.t.Fatalf("failed to encode %T: %v", expected, err)
+	}
+	var want, got interface{}
+	if err := json.Unmarshal(expectedJSON, &want); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := json.Unmarshal(patched, &got); err != nil {
+		r.t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		r.t.Errorf("expected the patched object\n%s\ngot\n%s", expectedJSON, patched)
+	}
+	return r
+}
+
+// PatchedObject returns the object of the request with the patch of the response applied.
+func (r *Response) PatchedObject() []byte {
+	r.t.Helper()
+	patched, _ := r.patchedObject()
+	return patched
+}
+
+// DecodePatchedObject decodes the object of the request with the patch of the response applied into obj.
+func (r *Response) DecodePatchedObject(obj runtime.Object) {
+	r.t.Helper()
+	patched, ok := r.patchedObject()
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(patched, obj); err != nil {
+		r.t.Errorf("failed to decode the patched object into %T: %v", obj, err)
+	}
+}
+
+func (r *Response) patchedObject() ([]byte, bool) {
+	r.t.Helper()
+	original := r.Request.Object.Raw
+	if len(r.Patch) == 0 {
+		return original, true
+	}
+	if r.PatchType == nil || *r.PatchType != admissionv1.PatchTypeJSONPatch {
+		r.t.Errorf("expected the patch type JSONPatch, got %v", r.PatchType)
+		return nil, false
+	}
+	patch, err := jsonpatch.DecodePatch(r.Patch)
+	if err != nil {
+		r.t.Errorf("failed to decode the patch %s: %v", r.Patch, err)
+		return nil, false
+	}
+	patched, err := patch.Apply(original)
+	if err != nil {
+		r.t.Errorf("failed to apply the patch %s: %v", r.Patch, err)
+		return nil, false
+	}
+	return patched, true
+}
+
+func (r *Response) message() string {
+	if r.Result == nil {
+		return ""
+	}
+	return r.Result.Message
+}
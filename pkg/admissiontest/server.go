@@ -0,0 +1,238 @@
+package admissiontest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/openapi"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview/generated"
+)
+
+// Server is an admission server serving admission hooks under test over plain HTTP, with authentication and
+// authorization disabled unless configured.
+type Server struct {
+	*httptest.Server
+
+	t        testing.TB
+	scheme   *runtime.Scheme
+	reviewer *apiserver.Reviewer
+}
+
+type serverConfig struct {
+	scheme      *runtime.Scheme
+	user        user.Info
+	authorizer  authorizer.Authorizer
+	restConfig  *restclient.Config
+	extraConfig apiserver.ExtraConfig
+}
+
+// Option configures a Server.
+type Option func(*serverConfig)
+
+// WithScheme sets the scheme the kinds of the objects under admission are looked up in. It defaults to the scheme of
+// client-go, which knows the built-in types.
+func WithScheme(scheme *runtime.Scheme) Option {
+	return func(c *serverConfig) { c.scheme = scheme }
+}
+
+// WithUser authenticates every request to the server as the given user.
+func WithUser(u user.Info) Option {
+	return func(c *serverConfig) { c.user = u }
+}
+
+// WithAuthorizer authorizes every request to the server with the given authorizer.
+func WithAuthorizer(a authorizer.Authorizer) Option {
+	return func(c *serverConfig) { c.authorizer = a }
+}
+
+// WithRestConfig sets the client config the hooks are initialized with. It defaults to an empty config. Hooks whose
+// match criteria have a namespace selector need the config of a cluster serving namespaces, which the server watches
+// to evaluate the selector.
+func WithRestConfig(config *restclient.Config) Option {
+	return func(c *serverConfig) { c.restConfig = config }
+}
+
+// WithExtraConfig sets the extra config of the server, like enforcement modes. Its admission hooks are replaced by
+// the ones passed to NewServer.
+func WithExtraConfig(extraConfig apiserver.ExtraConfig) Option {
+	return func(c *serverConfig) { c.extraConfig = extraConfig }
+}
+
+// NewServer starts an admission server with the given hooks, which are initialized first, and the controllers of the
+// server, like the informer of namespace selectors. Errors initializing the hooks fail the test. The server is closed
+// when the test ends.
+func NewServer(t testing.TB, admissionHooks []apiserver.AdmissionHook, options ...Option) *Server {
+	t.Helper()
+
+	c := &serverConfig{scheme: clientgoscheme.Scheme, restConfig: &restclient.Config{}}
+	for _, option := range options {
+		option(c)
+	}
+
+	genericConfig := genericapiserver.NewRecommendedConfig(apiserver.Codecs)
+	genericConfig.OpenAPIV3Config = genericapiserver.DefaultOpenAPIV3Config(generated.GetOpenAPIDefinitions, openapi.NewDefinitionNamer(apiserver.Scheme))
+	genericConfig.SkipOpenAPIInstallation = true
+	genericConfig.ExternalAddress = "127.0.0.1:443"
+	genericConfig.PublicAddress = net.ParseIP("127.0.0.1")
+	genericConfig.LegacyAPIGroupPrefixes = sets.NewString("/api")
+	genericConfig.LoopbackClientConfig = &restclient.Config{}
+	if c.user != nil {
+		u := c.user
+		genericConfig.Authentication.Authenticator = authenticator.RequestFunc(func(*http.Request) (*authenticator.Response, bool, error) {
+			return &authenticator.Response{User: u}, true, nil
+		})
+	}
+	genericConfig.Authorization.Authorizer = c.authorizer
+
+	extraConfig := c.extraConfig
+	extraConfig.AdmissionHooks = admissionHooks
+	config := &apiserver.Config{
+		GenericConfig: genericConfig,
+		ExtraConfig:   extraConfig,
+		RestConfig:    c.restConfig,
+	}
+	admissionServer, err := config.Complete().New()
+	if err != nil {
+		t.Fatalf("failed to build admission server: %v", err)
+	}
+
+	reviewer, err := apiserver.NewReviewer(admissionHooks...)
+	if err != nil {
+		t.Fatalf("failed to build admission server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	for _, hook := range admissionHooks {
+		if err := hook.Initialize(c.restConfig, ctx.Done()); err != nil {
+			t.Fatalf("failed to initialize admission hook %T: %v", hook, err)
+		}
+	}
+	admissionServer.StartControllers(ctx)
+
+	s := &Server{
+		Server:   httptest.NewServer(admissionServer.GenericAPIServer.Handler),
+		t:        t,
+		scheme:   c.scheme,
+		reviewer: reviewer,
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Path returns the path the admission hook served on the given resource is called on.
+func Path(resource schema.GroupVersionResource) string {
+	return "/apis/" + resource.Group + "/" + resource.Version + "/" + resource.Resource
+}
+
+// ValidatingPath returns the path of the validating admission hook.
+func ValidatingPath(hook apiserver.ValidatingAdmissionHook) string {
+	resource, _ := hook.ValidatingResource()
+	return Path(resource)
+}
+
+// MutatingPath returns the path of the mutating admission hook.
+func MutatingPath(hook apiserver.MutatingAdmissionHook) string {
+	resource, _ := hook.MutatingResource()
+	return Path(resource)
+}
+
+// Create sends the admission request to create the object to the hook on the given path.
+func (s *Server) Create(path string, obj runtime.Object, options ...RequestOption) *Response {
+	s.t.Helper()
+	return s.Review(path, s.request(admissionv1.Create, obj, nil), options...)
+}
+
+// Update sends the admission request to update oldObj to obj to the hook on the given path.
+func (s *Server) Update(path string, oldObj, obj runtime.Object, options ...RequestOption) *Response {
+	s.t.Helper()
+	return s.Review(path, s.request(admissionv1.Update, obj, oldObj), options...)
+}
+
+// Delete sends the admission request to delete oldObj to the hook on the given path.
+func (s *Server) Delete(path string, oldObj runtime.Object, options ...RequestOption) *Response {
+	s.t.Helper()
+	return s.Review(path, s.request(admissionv1.Delete, nil, oldObj), options...)
+}
+
+// Review sends the admission request to the hook on the given path in an AdmissionReview of the version chosen by
+// the options, v1 by default, and returns the response in v1.
+func (s *Server) Review(path string, request *admissionv1.AdmissionRequest, options ...RequestOption) *Response {
+	s.t.Helper()
+
+	c := &requestConfig{version: admissionv1.SchemeGroupVersion, request: request.DeepCopy()}
+	for _, option := range options {
+		option(c)
+	}
+
+	var review interface{} = &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request:  c.request,
+	}
+	if c.version == admissionv1beta1.SchemeGroupVersion {
+		review = &admissionv1beta1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: admissionv1beta1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+			Request:  admissionreview.ConvertV1RequestToV1Beta1(c.request),
+		}
+	}
+	payload, err := json.Marshal(review)
+	if err != nil {
+		s.t.Fatalf("failed to encode AdmissionReview: %v", err)
+	}
+
+	resp, err := http.Post(s.URL+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		s.t.Fatalf("failed to post AdmissionReview to %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("failed to read the response of %s: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("unexpected status %s of %s: %s", resp.Status, path, body)
+	}
+
+	response := &Response{t: s.t, scheme: s.scheme, Request: c.request}
+	if c.version == admissionv1beta1.SchemeGroupVersion {
+		out := &admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(body, out); err != nil {
+			s.t.Fatalf("failed to decode the AdmissionReview of %s: %v", path, err)
+		}
+		if out.APIVersion != admissionv1beta1.SchemeGroupVersion.String() {
+			s.t.Errorf("expected a %s AdmissionReview in response, got %s", admissionv1beta1.SchemeGroupVersion, out.APIVersion)
+		}
+		response.AdmissionResponse = admissionreview.ConvertV1Beta1ResponseToV1(out.Response)
+	} else {
+		out := &admissionv1.AdmissionReview{}
+		if err := json.Unmarshal(body, out); err != nil {
+			s.t.Fatalf("failed to decode the AdmissionReview of %s: %v", path, err)
+		}
+		response.AdmissionResponse = out.Response
+	}
+	if response.AdmissionResponse == nil {
+		s.t.Fatalf("the AdmissionReview of %s has no response", path)
+	}
+	return response
+}
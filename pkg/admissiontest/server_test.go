@@ -0,0 +1,244 @@
+package admissiontest_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/openshift/generic-admission-server/pkg/admissiontest"
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+)
+
+type configMapHook struct {
+	initialized bool
+}
+
+func (h *configMapHook) Initialize(*restclient.Config, <-chan struct{}) error {
+	h.initialized = true
+	return nil
+}
+
+func (h *configMapHook) ValidatingResource() (schema.GroupVersionResource, string) {
+	return schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "configmapvalidators"}, "configmapvalidator"
+}
+
+func (h *configMapHook) MutatingResource() (schema.GroupVersionResource, string) {
+	return schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "configmapmutators"}, "configmapmutator"
+}
+
+func (h *configMapHook) ValidateCreate(ctx context.Context, obj *corev1.ConfigMap) ([]string, error) {
+	if u, ok := genericapirequest.UserFrom(ctx); ok && u.GetName() != "system:apiserver" {
+		return nil, fmt.Errorf("unexpected caller %s", u.GetName())
+	}
+	if _, ok := obj.Data["forbidden"]; ok {
+		return nil, fmt.Errorf("forbidden keys are not allowed")
+	}
+	return []string{"checked"}, nil
+}
+
+func (h *configMapHook) ValidateUpdate(ctx context.Context, oldObj, obj *corev1.ConfigMap) ([]string, error) {
+	if oldObj.Data["immutable"] != obj.Data["immutable"] {
+		return nil, fmt.Errorf("immutable must not change")
+	}
+	return nil, nil
+}
+
+func (h *configMapHook) ValidateDelete(ctx context.Context, oldObj *corev1.ConfigMap) ([]string, error) {
+	if oldObj.Name == "keep" {
+		return nil, fmt.Errorf("keep must not be deleted")
+	}
+	return nil, nil
+}
+
+func (h *configMapHook) Mutate(ctx context.Context, _ *admissionv1.AdmissionRequest, obj *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	if obj.Labels == nil {
+		obj.Labels = map[string]string{}
+	}
+	obj.Labels["mutated"] = "true"
+	return obj, nil
+}
+
+func newConfigMap(name string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}, Data: data}
+}
+
+func TestServer(t *testing.T) {
+	hook := &configMapHook{}
+	validating := apiserver.NewTypedValidatingHook[*corev1.ConfigMap](clientgoscheme.Scheme, hook)
+	mutating := apiserver.NewTypedMutatingHook[*corev1.ConfigMap](clientgoscheme.Scheme, hook)
+	server := admissiontest.NewServer(t, []apiserver.AdmissionHook{validating, mutating},
+		admissiontest.WithUser(&user.DefaultInfo{Name: "system:apiserver", Groups: []string{user.SystemPrivilegedGroup}}),
+	)
+	if !hook.initialized {
+		t.Errorf("expected the hook to be initialized")
+	}
+
+	validatingPath := admissiontest.ValidatingPath(validating)
+	server.Create(validatingPath, newConfigMap("foo", nil)).ExpectAllowed().ExpectWarnings("checked")
+	server.Create(validatingPath, newConfigMap("foo", map[string]string{"forbidden": ""}), admissiontest.V1Beta1()).
+		ExpectDenied().
+		ExpectCode(http.StatusForbidden).
+		ExpectMessage("forbidden keys are not allowed")
+	server.Update(validatingPath, newConfigMap("foo", map[string]string{"immutable": "a"}), newConfigMap("foo", map[string]string{"immutable": "b"})).
+		ExpectDenied().
+		ExpectMessage("immutable must not change")
+	server.Delete(validatingPath, newConfigMap("keep", nil)).ExpectDenied()
+	server.Delete(validatingPath, newConfigMap("other", nil)).ExpectAllowed().ExpectNoPatch()
+
+	expected := newConfigMap("foo", nil)
+	expected.Labels = map[string]string{"mutated": "true"}
+	for _, options := range [][]admissiontest.RequestOption{nil, {admissiontest.V1Beta1()}} {
+		response := server.Create(admissiontest.MutatingPath(mutating), newConfigMap("foo", nil), options...).
+			ExpectAllowed().
+			ExpectPatched(expected)
+
+		patched := &corev1.ConfigMap{}
+		response.DecodePatchedObject(patched)
+		if patched.Labels["mutated"] != "true" {
+			t.Errorf("expected the decoded object to be patched, got %v", patched.Labels)
+		}
+	}
+}
+
+func TestCheckConformance(t *testing.T) {
+	hook := &configMapHook{}
+	server := admissiontest.NewServer(t, []apiserver.AdmissionHook{
+		apiserver.NewTypedValidatingHook[*corev1.ConfigMap](clientgoscheme.Scheme, hook),
+		apiserver.NewTypedMutatingHook[*corev1.ConfigMap](clientgoscheme.Scheme, hook),
+	})
+
+	server.CheckConformance(t,
+		admissiontest.ConformanceCase{Name: "create", Operation: admissionv1.Create, Object: newConfigMap("foo", nil)},
+		admissiontest.ConformanceCase{Name: "create forbidden", Operation: admissionv1.Create, Object: newConfigMap("foo", map[string]string{"forbidden": ""})},
+		admissiontest.ConformanceCase{Name: "update", Operation: admissionv1.Update, Object: newConfigMap("foo", nil), OldObject: newConfigMap("foo", nil)},
+		admissiontest.ConformanceCase{Name: "delete", Operation: admissionv1.Delete, OldObject: newConfigMap("keep", nil)},
+	)
+}
+
+type namespaceSelectingHook struct {
+	calls int
+}
+
+func (h *namespaceSelectingHook) Initialize(*restclient.Config, <-chan struct{}) error {
+	return nil
+}
+
+func (h *namespaceSelectingHook) ValidatingResource() (schema.GroupVersionResource, string) {
+	return schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "prodvalidators"}, "prodvalidator"
+}
+
+func (h *namespaceSelectingHook) Validate(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	h.calls++
+	return &admissionv1.AdmissionResponse{Allowed: false, Result: &metav1.Status{Message: "denied in prod"}}
+}
+
+func (h *namespaceSelectingHook) MatchCriteria() apiserver.MatchCriteria {
+	return apiserver.MatchCriteria{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}}
+}
+
+// newNamespaceServer serves the namespaces for lists and watches, and nothing else.
+func newNamespaceServer(t *testing.T, namespaces ...corev1.Namespace) *httptest.Server {
+	list := &corev1.NamespaceList{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "NamespaceList"},
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		Items:    namespaces,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path != "/api/v1/namespaces" || query.Get("sendInitialEvents") == "true":
+			http.NotFound(w, r)
+		case query.Get("watch") == "true":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(list); err != nil {
+				t.Error(err)
+			}
+		}
+	}))
+	// registered before the admission server, which stops watching when the test ends, to be closed after it
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestServerNamespaceSelector(t *testing.T) {
+	namespaces := newNamespaceServer(t,
+		corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}},
+		corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"env": "dev"}}},
+	)
+	hook := &namespaceSelectingHook{}
+	server := admissiontest.NewServer(t, []apiserver.AdmissionHook{hook}, admissiontest.WithRestConfig(&restclient.Config{Host: namespaces.URL}))
+	path := admissiontest.ValidatingPath(hook)
+
+	// namespaces are only known once the informer of the server listed them
+	inNamespace := func(namespace string) *corev1.ConfigMap {
+		configMap := newConfigMap("foo", nil)
+		configMap.Namespace = namespace
+		return configMap
+	}
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		response := server.Create(path, inNamespace("prod"))
+		return response.Result != nil && strings.Contains(response.Result.Message, "denied in prod"), nil
+	})
+	if err != nil {
+		t.Fatalf("expected the hook to be called for the selected namespace: %v", err)
+	}
+
+	calls := hook.calls
+	server.Create(path, inNamespace("dev")).ExpectAllowed()
+	if hook.calls != calls {
+		t.Errorf("expected the hook not to be called for other namespaces")
+	}
+}
+
+type failingHook struct {
+	namespaceSelectingHook
+}
+
+func (h *failingHook) Initialize(*restclient.Config, <-chan struct{}) error {
+	return fmt.Errorf("no cluster")
+}
+
+// fatalRecorder records the failure of a test instead of failing it.
+type fatalRecorder struct {
+	testing.TB
+	failure string
+}
+
+func (r *fatalRecorder) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func TestServerInitializeError(t *testing.T) {
+	recorder := &fatalRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		admissiontest.NewServer(recorder, []apiserver.AdmissionHook{&failingHook{}})
+	}()
+	<-done
+	if !strings.Contains(recorder.failure, "no cluster") {
+		t.Errorf("expected the initialization error to fail the test, got %q", recorder.failure)
+	}
+}
@@ -1,6 +1,7 @@
 package apiserver
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -10,11 +11,18 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/predicates/namespace"
 	"k8s.io/apiserver/pkg/registry/rest"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	"k8s.io/apiserver/pkg/server/healthz"
 	"k8s.io/apiserver/pkg/util/compatibility"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 
+	"github.com/openshift/generic-admission-server/pkg/capture"
+	"github.com/openshift/generic-admission-server/pkg/decisionlog"
 	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
 )
 
@@ -45,6 +53,26 @@ type ValidatingAdmissionHookV1Beta1 interface {
 	Validate(admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
 }
 
+type ValidatingAdmissionHookV1Beta1WithContext interface {
+	ValidatingAdmissionHook
+
+	// Validate is called to decide whether to accept the admission request. The context is the one of the
+	// webhook request: it is cancelled when the API server gives up on the webhook and carries the audit ID and
+	// the authenticated caller. The returned AdmissionResponse must not use the Patch field.
+	Validate(ctx context.Context, admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
+}
+
+type ValidatingAdmissionHookV1Beta1WithError interface {
+	ValidatingAdmissionHook
+
+	// Validate is called to decide whether to accept the admission request, with the context of the webhook
+	// request as for ValidatingAdmissionHookV1Beta1WithContext. A returned error denies the request: API status
+	// errors are returned as they are, field errors (e.g. field.ErrorList.ToAggregate()) become an Invalid status
+	// with causes and any other error becomes Forbidden. A nil response without error allows the request.
+	// The returned AdmissionResponse must not use the Patch field.
+	Validate(ctx context.Context, admissionSpec *admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error)
+}
+
 type ValidatingAdmissionHookV1 interface {
 	ValidatingAdmissionHook
 
@@ -53,6 +81,26 @@ type ValidatingAdmissionHookV1 interface {
 	Validate(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
 }
 
+type ValidatingAdmissionHookV1WithContext interface {
+	ValidatingAdmissionHook
+
+	// Validate is called to decide whether to accept the v1 admission request. The context is the one of the
+	// webhook request: it is cancelled when the API server gives up on the webhook and carries the audit ID and
+	// the authenticated caller. The returned AdmissionResponse must not use the Patch field.
+	Validate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+}
+
+type ValidatingAdmissionHookV1WithError interface {
+	ValidatingAdmissionHook
+
+	// Validate is called to decide whether to accept the v1 admission request, with the context of the webhook
+	// request as for ValidatingAdmissionHookV1WithContext. A returned error denies the request: API status
+	// errors are returned as they are, field errors (e.g. field.ErrorList.ToAggregate()) become an Invalid status
+	// with causes and any other error becomes Forbidden. A nil response without error allows the request.
+	// The returned AdmissionResponse must not use the Patch field.
+	Validate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error)
+}
+
 type MutatingAdmissionHook interface {
 	AdmissionHook
 
@@ -70,6 +118,24 @@ type MutatingAdmissionHookV1Beta1 interface {
 	Admit(admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
 }
 
+type MutatingAdmissionHookV1Beta1WithContext interface {
+	MutatingAdmissionHook
+
+	// Admit is called to decide whether to accept the admission request. The context is the one of the
+	// webhook request, see ValidatingAdmissionHookV1Beta1WithContext. The returned AdmissionResponse may
+	// use the Patch field to mutate the object from the passed AdmissionRequest.
+	Admit(ctx context.Context, admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
+}
+
+type MutatingAdmissionHookV1Beta1WithError interface {
+	MutatingAdmissionHook
+
+	// Admit is called to decide whether to accept the admission request, with the context of the webhook
+	// request. Returned errors deny the request as described for ValidatingAdmissionHookV1Beta1WithError.
+	// The returned AdmissionResponse may use the Patch field to mutate the object from the passed AdmissionRequest.
+	Admit(ctx context.Context, admissionSpec *admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error)
+}
+
 type MutatingAdmissionHookV1 interface {
 	MutatingAdmissionHook
 
@@ -78,9 +144,51 @@ type MutatingAdmissionHookV1 interface {
 	Admit(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
 }
 
+type MutatingAdmissionHookV1WithContext interface {
+	MutatingAdmissionHook
+
+	// Admit is called to decide whether to accept the v1 admission request. The context is the one of the
+	// webhook request, see ValidatingAdmissionHookV1WithContext. The returned AdmissionResponse may
+	// use the Patch field to mutate the object from the passed AdmissionRequest.
+	Admit(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+}
+
+type MutatingAdmissionHookV1WithError interface {
+	MutatingAdmissionHook
+
+	// Admit is called to decide whether to accept the v1 admission request, with the context of the webhook
+	// request. Returned errors deny the request as described for ValidatingAdmissionHookV1WithError.
+	// The returned AdmissionResponse may use the Patch field to mutate the object from the passed AdmissionRequest.
+	Admit(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error)
+}
+
+// PanicPolicy decides about an admission request when the hook handling it panics.
+type PanicPolicy string
+
+const (
+	// PanicPolicyDeny denies the admission request with an internal error. This is the default.
+	PanicPolicyDeny PanicPolicy = "Deny"
+	// PanicPolicyAllow allows the admission request with a warning.
+	PanicPolicyAllow PanicPolicy = "Allow"
+)
+
+// AdmissionHookWithPanicPolicy can be implemented by admission hooks to choose what happens to a request when
+// Validate or Admit panics. The panic is recovered, logged with its stack trace and counted in the
+// generic_admission_server_hook_panics_total metric in either case.
+type AdmissionHookWithPanicPolicy interface {
+	PanicPolicy() PanicPolicy
+}
+
+// AdmissionHookWithReadyzChecks can be implemented by admission hooks to add checks to the readyz endpoint of the
+// server, like whether the configuration they load is valid.
+type AdmissionHookWithReadyzChecks interface {
+	ReadyzChecks() []healthz.HealthChecker
+}
+
 func init() {
 	admissionv1.AddToScheme(Scheme)
 	admissionv1beta1.AddToScheme(Scheme)
+	admissionreview.AddConversionFuncs(Scheme)
 
 	// we need to add the options to empty v1
 	// TODO fix the server code to avoid this
@@ -105,11 +213,54 @@ type Config struct {
 
 type ExtraConfig struct {
 	AdmissionHooks []AdmissionHook
+
+	// EnforcementModes are the enforcement modes of the hooks by the resource they are served on. Hooks without a
+	// mode enforce their decisions.
+	EnforcementModes map[schema.GroupVersionResource]admissionreview.EnforcementMode
+	// ConformanceMode is how responses of the hooks violating the admission protocol are handled. They are fixed up
+	// by default.
+	ConformanceMode admissionreview.ConformanceMode
+
+	// Registration configures the registration of the server and its hooks in a post-start hook, if set. The
+	// APIServices and webhook configurations are written with the client config of the server.
+	Registration *RegistrationConfig
+
+	// DecisionLogger logs the admission decisions of all hooks, if set. The caller closes it once the server has
+	// stopped serving, since requests are still admitted during the shutdown delay.
+	DecisionLogger *decisionlog.Logger
+	// Capturer captures sampled reviews of all hooks with their responses, if set.
+	Capturer *capture.Capturer
+
+	// Exemptions select the admission requests all hooks allow without being called, if set.
+	Exemptions *admissionreview.Exemptions
 }
 
 // AdmissionServer contains state for a Kubernetes cluster master/api server.
 type AdmissionServer struct {
 	GenericAPIServer *genericapiserver.GenericAPIServer
+
+	// controllers are started by post-start hooks of the server, or by StartControllers.
+	controllers []func(ctx context.Context)
+}
+
+// StartControllers starts the controllers of the server, like the namespace informer and the registrar, until the
+// context is done. They are started by the post-start hooks of a running server, so that StartControllers is only
+// needed to serve the handler of the server without running it, with the admission hooks initialized by the caller.
+func (s *AdmissionServer) StartControllers(ctx context.Context) {
+	for _, start := range s.controllers {
+		start(ctx)
+	}
+}
+
+// addController adds a controller of the server, started by a post-start hook with the given name.
+func (s *AdmissionServer) addController(name string, start func(ctx context.Context)) {
+	s.controllers = append(s.controllers, start)
+	s.GenericAPIServer.AddPostStartHookOrDie(name,
+		func(hookContext genericapiserver.PostStartHookContext) error {
+			start(hookContext)
+			return nil
+		},
+	)
 }
 
 type completedConfig struct {
@@ -136,6 +287,21 @@ func (c *Config) Complete() CompletedConfig {
 
 // New returns a new instance of AdmissionServer from the given config.
 func (c completedConfig) New() (*AdmissionServer, error) {
+	if err := ValidateAdmissionHooks(c.ExtraConfig.AdmissionHooks...); err != nil {
+		return nil, err
+	}
+	if err := validateEnforcementModes(c.ExtraConfig.EnforcementModes, c.ExtraConfig.AdmissionHooks...); err != nil {
+		return nil, err
+	}
+	if err := c.ExtraConfig.Exemptions.Validate(); err != nil {
+		return nil, err
+	}
+	if len(c.ExtraConfig.ConformanceMode) > 0 {
+		if _, err := admissionreview.ParseConformanceMode(string(c.ExtraConfig.ConformanceMode)); err != nil {
+			return nil, err
+		}
+	}
+
 	genericServer, err := c.GenericConfig.New("admission-server", genericapiserver.NewEmptyDelegate()) // completion is done in Complete, no need for a second time
 	if err != nil {
 		return nil, err
@@ -153,6 +319,20 @@ func (c completedConfig) New() (*AdmissionServer, error) {
 		}
 	}
 
+	// namespace selectors of match criteria are evaluated with the labels of the namespaces in the cluster
+	var namespaces *namespace.Matcher
+	if NeedsNamespaces(c.ExtraConfig.AdmissionHooks...) {
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return nil, err
+		}
+		informerFactory := informers.NewSharedInformerFactory(client, 0)
+		namespaces = &namespace.Matcher{NamespaceLister: informerFactory.Core().V1().Namespaces().Lister(), Client: client}
+		s.addController("start-namespace-informer", func(ctx context.Context) {
+			informerFactory.Start(ctx.Done())
+		})
+	}
+
 	for _, versionMap := range admissionHooksByGroupThenVersion(c.ExtraConfig.AdmissionHooks...) {
 		// TODO we're going to need a later k8s.io/apiserver so that we can get discovery to list a different group version for
 		// our endpoint which we'll use to back some custom storage which will consume the AdmissionReview type and give back the correct response
@@ -174,9 +354,9 @@ func (c completedConfig) New() (*AdmissionServer, error) {
 				// just overwrite the groupversion with a random one.  We don't really care or know.
 				apiGroupInfo.PrioritizedVersions = appendUniqueGroupVersion(apiGroupInfo.PrioritizedVersions, admissionVersion)
 
-				admissionReview := getAdmissionRest(admissionHook)
-				if admissionReview == nil {
-					continue
+				admissionReview, err := getAdmissionRest(admissionHook, c.ExtraConfig, namespaces)
+				if err != nil {
+					return nil, err
 				}
 				v1alpha1storage, ok := apiGroupInfo.VersionedResourcesStorageMap[admissionVersion.Version]
 				if !ok {
@@ -192,6 +372,30 @@ func (c completedConfig) New() (*AdmissionServer, error) {
 		}
 	}
 
+	admissionreview.RegisterMetrics()
+
+	if config := c.ExtraConfig.Registration; config != nil {
+		var servingCert dynamiccertificates.CertKeyContentProvider
+		if s.GenericAPIServer.SecureServingInfo != nil {
+			servingCert = s.GenericAPIServer.SecureServingInfo.Cert
+		}
+		registrar, err := newRegistrar(*config, restConfig, servingCert, c.ExtraConfig.AdmissionHooks...)
+		if err != nil {
+			return nil, err
+		}
+		s.addController("register-admission-hooks", func(ctx context.Context) {
+			go registrar.run(ctx)
+		})
+	}
+
+	for _, admissionHook := range c.ExtraConfig.AdmissionHooks {
+		if h, ok := hookAs[AdmissionHookWithReadyzChecks](admissionHook); ok {
+			if err := s.GenericAPIServer.AddReadyzChecks(h.ReadyzChecks()...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	for i := range c.ExtraConfig.AdmissionHooks {
 		admissionHook := c.ExtraConfig.AdmissionHooks[i]
 		postStartName := postStartHookName(admissionHook)
@@ -227,11 +431,11 @@ func postStartHookName(hook AdmissionHook) string {
 	var ns []string
 	if mutatingHook, ok := hook.(MutatingAdmissionHook); ok {
 		gvr, _ := mutatingHook.MutatingResource()
-		ns = append(ns, fmt.Sprintf("mutating-%s.%s.%s", gvr.Resource, gvr.Version, gvr.Group))
+		ns = append(ns, "mutating-"+resourceName(gvr))
 	}
 	if validatingHook, ok := hook.(ValidatingAdmissionHook); ok {
 		gvr, _ := validatingHook.ValidatingResource()
-		ns = append(ns, fmt.Sprintf("validating-%s.%s.%s", gvr.Resource, gvr.Version, gvr.Group))
+		ns = append(ns, "validating-"+resourceName(gvr))
 	}
 	if len(ns) == 0 {
 		return ""
@@ -239,123 +443,192 @@ func postStartHookName(hook AdmissionHook) string {
 	return strings.Join(append(ns, "init"), "-")
 }
 
-func admissionHooksByGroupThenVersion(admissionHooks ...AdmissionHook) map[string]map[string][]admissionHookWrapper {
-	ret := map[string]map[string][]admissionHookWrapper{}
+func admissionHooksByGroupThenVersion(admissionHooks ...AdmissionHook) map[string]map[string][]*admissionHookWrapper {
+	ret := map[string]map[string][]*admissionHookWrapper{}
+	add := func(wrapper *admissionHookWrapper) {
+		gvr, _ := wrapper.Resource()
+		group, ok := ret[gvr.Group]
+		if !ok {
+			group = map[string][]*admissionHookWrapper{}
+			ret[gvr.Group] = group
+		}
+		group[gvr.Version] = append(group[gvr.Version], wrapper)
+	}
 
 	for i := range admissionHooks {
-		if mutatingHook, ok := admissionHooks[i].(MutatingAdmissionHookV1Beta1); ok {
-			gvr, _ := mutatingHook.MutatingResource()
-			group, ok := ret[gvr.Group]
-			if !ok {
-				group = map[string][]admissionHookWrapper{}
-				ret[gvr.Group] = group
-			}
-			group[gvr.Version] = append(group[gvr.Version], mutatingAdmissionHookV1Beta1Wrapper{hook: mutatingHook})
+		if admission, ok := mutatingAdmission(admissionHooks[i]); ok {
+			mutatingHook := admissionHooks[i].(MutatingAdmissionHook)
+			add(&admissionHookWrapper{hook: mutatingHook, hookType: admissionreview.HookTypeMutating, resource: mutatingHook.MutatingResource, admission: admission})
 		}
-		if validatingHook, ok := admissionHooks[i].(ValidatingAdmissionHookV1Beta1); ok {
-			gvr, _ := validatingHook.ValidatingResource()
-			group, ok := ret[gvr.Group]
-			if !ok {
-				group = map[string][]admissionHookWrapper{}
-				ret[gvr.Group] = group
-			}
-			group[gvr.Version] = append(group[gvr.Version], validatingAdmissionHookV1Beta1Wrapper{hook: validatingHook})
-		}
-		if mutatingHook, ok := admissionHooks[i].(MutatingAdmissionHookV1); ok {
-			gvr, _ := mutatingHook.MutatingResource()
-			group, ok := ret[gvr.Group]
-			if !ok {
-				group = map[string][]admissionHookWrapper{}
-				ret[gvr.Group] = group
-			}
-			group[gvr.Version] = append(group[gvr.Version], mutatingAdmissionHookV1Wrapper{hook: mutatingHook})
-		}
-		if validatingHook, ok := admissionHooks[i].(ValidatingAdmissionHookV1); ok {
-			gvr, _ := validatingHook.ValidatingResource()
-			group, ok := ret[gvr.Group]
-			if !ok {
-				group = map[string][]admissionHookWrapper{}
-				ret[gvr.Group] = group
-			}
-			group[gvr.Version] = append(group[gvr.Version], validatingAdmissionHookV1Wrapper{hook: validatingHook})
+		if admission, ok := validatingAdmission(admissionHooks[i]); ok {
+			validatingHook := admissionHooks[i].(ValidatingAdmissionHook)
+			add(&admissionHookWrapper{hook: validatingHook, hookType: admissionreview.HookTypeValidating, resource: validatingHook.ValidatingResource, admission: admission})
 		}
 	}
 
 	return ret
 }
 
-func getAdmissionRest(wrapper admissionHookWrapper) rest.Storage {
-	switch t := wrapper.(type) {
-	case admissionHookWrapperV1Alpha1:
-		return admissionreview.NewREST(t.Admission)
-	case admissionHookWrapperV1:
-		return admissionreview.NewV1REST(t.Admission)
+// mutatingAdmission returns the Admit method of a mutating admission hook of any version and variant as v1 admission
+// function. The error returning and context aware variants are preferred when a hook implements them, v1beta1 hooks
+// are converted to v1. The storage serves both versions of AdmissionReview.
+func mutatingAdmission(hook AdmissionHook) (admissionreview.AdmissionV1HookFuncWithError, bool) {
+	switch mutatingHook := hook.(type) {
+	case MutatingAdmissionHookV1Beta1WithError:
+		return fromV1Beta1(allowOnNilResponseV1Beta1(mutatingHook.Admit)), true
+	case MutatingAdmissionHookV1Beta1WithContext:
+		return fromV1Beta1(withoutErrorV1Beta1(mutatingHook.Admit)), true
+	case MutatingAdmissionHookV1Beta1:
+		return fromV1Beta1(withoutContextV1Beta1(mutatingHook.Admit)), true
+	case MutatingAdmissionHookV1WithError:
+		return allowOnNilResponseV1(mutatingHook.Admit), true
+	case MutatingAdmissionHookV1WithContext:
+		return withoutErrorV1(mutatingHook.Admit), true
+	case MutatingAdmissionHookV1:
+		return withoutContextV1(mutatingHook.Admit), true
 	}
-
-	return nil
-}
-
-// admissionHookWrapper wraps either a validating or mutating admission hooks, calling the respective resource and admission method.
-type admissionHookWrapper interface {
-	Resource() (plural schema.GroupVersionResource, singular string)
-}
-
-type admissionHookWrapperV1Alpha1 interface {
-	admissionHookWrapper
-	Admission(admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
+	return nil, false
+}
+
+// validatingAdmission returns the Validate method of a validating admission hook of any version and variant as v1
+// admission function, like mutatingAdmission.
+func validatingAdmission(hook AdmissionHook) (admissionreview.AdmissionV1HookFuncWithError, bool) {
+	switch validatingHook := hook.(type) {
+	case ValidatingAdmissionHookV1Beta1WithError:
+		return fromV1Beta1(allowOnNilResponseV1Beta1(validatingHook.Validate)), true
+	case ValidatingAdmissionHookV1Beta1WithContext:
+		return fromV1Beta1(withoutErrorV1Beta1(validatingHook.Validate)), true
+	case ValidatingAdmissionHookV1Beta1:
+		return fromV1Beta1(withoutContextV1Beta1(validatingHook.Validate)), true
+	case ValidatingAdmissionHookV1WithError:
+		return allowOnNilResponseV1(validatingHook.Validate), true
+	case ValidatingAdmissionHookV1WithContext:
+		return withoutErrorV1(validatingHook.Validate), true
+	case ValidatingAdmissionHookV1:
+		return withoutContextV1(validatingHook.Validate), true
+	}
+	return nil, false
+}
+
+// getAdmissionRest returns the storage of the hook. Namespace selectors of its match criteria are evaluated with the
+// namespace matcher, if there is one.
+func getAdmissionRest(wrapper *admissionHookWrapper, extraConfig *ExtraConfig, namespaces *namespace.Matcher) (rest.Storage, error) {
+	resource, singular := wrapper.Resource()
+	options := admissionreview.HookOptions{
+		Resource:        resource,
+		Singular:        singular,
+		Type:            wrapper.hookType,
+		EnforcementMode: extraConfig.EnforcementModes[resource],
+		ConformanceMode: extraConfig.ConformanceMode,
+		DecisionLogger:  extraConfig.DecisionLogger,
+		Capturer:        extraConfig.Capturer,
+		AllowOnPanic:    hookPanicPolicy(wrapper.hook) == PanicPolicyAllow,
+		Exemptions:      extraConfig.Exemptions,
+	}
+	matcher, err := hookMatcher(wrapper.hook, wrapper.hookType, resourceName(resource))
+	if err != nil {
+		return nil, fmt.Errorf("admission hook %s: invalid match criteria: %w", resourceName(resource), err)
+	}
+	if matcher != nil {
+		matcher.namespaces = namespaces
+		options.Match = matcher.Match
+	}
+	return admissionreview.NewV1RESTWithOptions(wrapper.admission, options), nil
 }
 
-type admissionHookWrapperV1 interface {
-	admissionHookWrapper
-	Admission(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+func hookPanicPolicy(hook AdmissionHook) PanicPolicy {
+	if h, ok := hookAs[AdmissionHookWithPanicPolicy](hook); ok && h.PanicPolicy() == PanicPolicyAllow {
+		return PanicPolicyAllow
+	}
+	return PanicPolicyDeny
 }
 
-// v1beta1 wrappers
-type mutatingAdmissionHookV1Beta1Wrapper struct {
-	hook MutatingAdmissionHookV1Beta1
+// wrappedAdmissionHook is implemented by the admission hooks of this package that adapt a hook of the caller, like
+// NewTypedValidatingHook, so that optional interfaces implemented by the caller's hook are still honored.
+type wrappedAdmissionHook interface {
+	unwrap() AdmissionHook
 }
 
-func (h mutatingAdmissionHookV1Beta1Wrapper) Resource() (plural schema.GroupVersionResource, singular string) {
-	return h.hook.MutatingResource()
+// hookAs returns the first admission hook in the chain of wrapped hooks that implements T.
+func hookAs[T any](hook AdmissionHook) (T, bool) {
+	for hook != nil {
+		if t, ok := hook.(T); ok {
+			return t, true
+		}
+		wrapped, ok := hook.(wrappedAdmissionHook)
+		if !ok {
+			break
+		}
+		hook = wrapped.unwrap()
+	}
+	var zero T
+	return zero, false
 }
 
-func (h mutatingAdmissionHookV1Beta1Wrapper) Admission(admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
-	return h.hook.Admit(admissionSpec)
+// admissionHookWrapper wraps either a validating or mutating admission hook of either version, calling the respective
+// resource and admission method.
+type admissionHookWrapper struct {
+	hook      AdmissionHook
+	hookType  admissionreview.HookType
+	resource  func() (plural schema.GroupVersionResource, singular string)
+	admission admissionreview.AdmissionV1HookFuncWithError
 }
 
-type validatingAdmissionHookV1Beta1Wrapper struct {
-	hook ValidatingAdmissionHookV1Beta1
+func (h *admissionHookWrapper) Resource() (plural schema.GroupVersionResource, singular string) {
+	return h.resource()
 }
 
-func (h validatingAdmissionHookV1Beta1Wrapper) Resource() (plural schema.GroupVersionResource, singular string) {
-	return h.hook.ValidatingResource()
-}
+// v1beta1 adapters
+type admissionV1Beta1HookFunc func(ctx context.Context, admissionSpec *admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error)
 
-func (h validatingAdmissionHookV1Beta1Wrapper) Admission(admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
-	return h.hook.Validate(admissionSpec)
+func fromV1Beta1(fn admissionV1Beta1HookFunc) admissionreview.AdmissionV1HookFuncWithError {
+	return func(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		response, err := fn(ctx, admissionreview.ConvertV1RequestToV1Beta1(admissionSpec))
+		return admissionreview.ConvertV1Beta1ResponseToV1(response), err
+	}
 }
 
-// v1 wrappers
-type mutatingAdmissionHookV1Wrapper struct {
-	hook MutatingAdmissionHookV1
+func withoutContextV1Beta1(fn func(*admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse) admissionV1Beta1HookFunc {
+	return func(_ context.Context, admissionSpec *admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error) {
+		return fn(admissionSpec), nil
+	}
 }
 
-func (h mutatingAdmissionHookV1Wrapper) Resource() (plural schema.GroupVersionResource, singular string) {
-	return h.hook.MutatingResource()
+func withoutErrorV1Beta1(fn func(context.Context, *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse) admissionV1Beta1HookFunc {
+	return func(ctx context.Context, admissionSpec *admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error) {
+		return fn(ctx, admissionSpec), nil
+	}
 }
 
-func (h mutatingAdmissionHookV1Wrapper) Admission(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
-	return h.hook.Admit(admissionSpec)
+func allowOnNilResponseV1Beta1(fn admissionV1Beta1HookFunc) admissionV1Beta1HookFunc {
+	return func(ctx context.Context, admissionSpec *admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error) {
+		response, err := fn(ctx, admissionSpec)
+		if response == nil && err == nil {
+			return &admissionv1beta1.AdmissionResponse{Allowed: true}, nil
+		}
+		return response, err
+	}
 }
 
-type validatingAdmissionHookV1Wrapper struct {
-	hook ValidatingAdmissionHookV1
+// v1 adapters
+func withoutContextV1(fn func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) admissionreview.AdmissionV1HookFuncWithError {
+	return func(_ context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		return fn(admissionSpec), nil
+	}
 }
 
-func (h validatingAdmissionHookV1Wrapper) Resource() (plural schema.GroupVersionResource, singular string) {
-	return h.hook.ValidatingResource()
+func withoutErrorV1(fn func(context.Context, *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) admissionreview.AdmissionV1HookFuncWithError {
+	return func(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		return fn(ctx, admissionSpec), nil
+	}
 }
 
-func (h validatingAdmissionHookV1Wrapper) Admission(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
-	return h.hook.Validate(admissionSpec)
+func allowOnNilResponseV1(fn admissionreview.AdmissionV1HookFuncWithError) admissionreview.AdmissionV1HookFuncWithError {
+	return func(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		response, err := fn(ctx, admissionSpec)
+		if response == nil && err == nil {
+			return &admissionv1.AdmissionResponse{Allowed: true}, nil
+		}
+		return response, err
+	}
 }
@@ -2,10 +2,12 @@ package apiserver
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"strings"
 	"testing"
 
 	"net/http"
@@ -16,9 +18,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/endpoints/openapi"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	"k8s.io/client-go/rest"
 	restclient "k8s.io/client-go/rest"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview/generated"
 )
 
 const (
@@ -77,6 +83,22 @@ func (a *testWebhookV1) Admit(admissionSpec *admissionv1.AdmissionRequest) *admi
 	return &admissionv1.AdmissionResponse{Allowed: true, Patch: []byte("{}")}
 }
 
+type testWebhookV1WithContext struct {
+	testWebhook
+
+	hadDeadline bool
+}
+
+func (a *testWebhookV1WithContext) Validate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	_, a.hadDeadline = ctx.Deadline()
+	return &admissionv1.AdmissionResponse{Allowed: ctx.Err() == nil}
+}
+
+func (a *testWebhookV1WithContext) Admit(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	_, a.hadDeadline = ctx.Deadline()
+	return &admissionv1.AdmissionResponse{Allowed: ctx.Err() == nil, Patch: []byte("{}")}
+}
+
 func TestV1Beta1Webhook(t *testing.T) {
 	testHook := &testWebhookV1Beta1{}
 	server := newTestServer(t, testHook)
@@ -221,8 +243,229 @@ func TestV1Webhook(t *testing.T) {
 	}
 }
 
+func TestConvertedReviewVersions(t *testing.T) {
+	cases := []struct {
+		name    string
+		hook    AdmissionHook
+		version string
+	}{
+		{name: "v1 hook, v1beta1 review", hook: &testWebhookV1{}, version: "v1beta1"},
+		{name: "v1beta1 hook, v1 review", hook: &testWebhookV1Beta1{}, version: "v1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := newTestServer(t, c.hook)
+			defer server.Close()
+
+			for _, path := range []string{validatorPath, mutatorPath} {
+				payload := fmt.Sprintf(`{"apiVersion":"admission.k8s.io/%s","kind":"AdmissionReview","request":{"uid":"some-uid","kind":{"kind":"TestKind"},"operation":"CREATE"}}`, c.version)
+				resp, err := http.Post(server.URL+path, "application/json", bytes.NewBufferString(payload))
+				if err != nil {
+					t.Fatalf("unexpected error when calling webhook, but got %v", err)
+				}
+				body, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					t.Fatalf("unexpected error reading body at path %q: %v", path, err)
+				}
+
+				// both versions share the same fields
+				reviewResponse := &admissionv1.AdmissionReview{}
+				if err := json.Unmarshal(body, reviewResponse); err != nil {
+					t.Fatalf("unexpected error parsing json body at path %q: %v", path, err)
+				}
+				if reviewResponse.APIVersion != "admission.k8s.io/"+c.version {
+					t.Errorf("expect the review in %s at path %q, got %s", c.version, path, body)
+				}
+				if reviewResponse.Response == nil || !reviewResponse.Response.Allowed || reviewResponse.Response.UID != "some-uid" {
+					t.Errorf("expect an allowed response with the request UID at path %q, got %s", path, body)
+				}
+			}
+		})
+	}
+}
+
+func TestV1WebhookWithContext(t *testing.T) {
+	testHook := &testWebhookV1WithContext{}
+	server := newTestServer(t, testHook)
+	defer server.Close()
+
+	for _, path := range []string{validatorPath, mutatorPath} {
+		t.Run(path, func(t *testing.T) {
+			testHook.hadDeadline = false
+
+			response := postV1Review(t, server.URL+path, &admissionv1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{Kind: "TestKind"},
+			})
+			if response == nil || !response.Allowed {
+				t.Errorf("expect review to be allowed, got %v", response)
+			}
+			if !testHook.hadDeadline {
+				t.Errorf("expect the hook context to carry the request deadline")
+			}
+		})
+	}
+}
+
+type testWebhookV1WithError struct {
+	testWebhook
+}
+
+func (a *testWebhookV1WithError) Validate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	return nil, field.ErrorList{field.Required(field.NewPath("spec", "foo"), "")}.ToAggregate()
+}
+
+func (a *testWebhookV1WithError) Admit(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	return nil, nil
+}
+
+func TestV1WebhookWithError(t *testing.T) {
+	server := newTestServer(t, &testWebhookV1WithError{})
+	defer server.Close()
+
+	request := &admissionv1.AdmissionRequest{
+		UID:  "some-uid",
+		Kind: metav1.GroupVersionKind{Kind: "TestKind"},
+		Name: "foo",
+	}
+
+	response := postV1Review(t, server.URL+validatorPath, request)
+	if response == nil || response.Allowed {
+		t.Fatalf("expect review to be denied, got %v", response)
+	}
+	if response.UID != request.UID {
+		t.Errorf("expect response UID %q, got %q", request.UID, response.UID)
+	}
+	if response.Result == nil || response.Result.Reason != metav1.StatusReasonInvalid || response.Result.Details == nil || len(response.Result.Details.Causes) != 1 {
+		t.Errorf("expect an Invalid result with one cause, got %v", response.Result)
+	}
+
+	response = postV1Review(t, server.URL+mutatorPath, request)
+	if response == nil || !response.Allowed {
+		t.Errorf("expect a nil response without error to be allowed, got %v", response)
+	}
+}
+
+type testWebhookV1NilResponse struct {
+	testWebhook
+}
+
+func (a *testWebhookV1NilResponse) Validate(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	return nil
+}
+
+func (a *testWebhookV1NilResponse) Admit(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	return nil
+}
+
+func TestV1WebhookNilResponse(t *testing.T) {
+	server := newTestServer(t, &testWebhookV1NilResponse{})
+	defer server.Close()
+
+	for path, resource := range map[string]string{validatorPath: "testvalidators.admission.openshift.io", mutatorPath: "testmutators.admission.openshift.io"} {
+		response := postV1Review(t, server.URL+path, &admissionv1.AdmissionRequest{
+			UID:  "some-uid",
+			Kind: metav1.GroupVersionKind{Kind: "TestKind"},
+		})
+		if response == nil || response.Allowed {
+			t.Fatalf("expect a nil response at %q to be denied, got %v", path, response)
+		}
+		if response.Result == nil || response.Result.Code != http.StatusInternalServerError || !strings.Contains(response.Result.Message, "admission hook for "+resource) {
+			t.Errorf("expect an internal error naming the hook at %q, got %v", path, response.Result)
+		}
+	}
+}
+
+type testWebhookV1Panicking struct {
+	testWebhook
+
+	policy PanicPolicy
+}
+
+func (a *testWebhookV1Panicking) PanicPolicy() PanicPolicy {
+	return a.policy
+}
+
+func (a *testWebhookV1Panicking) Validate(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	panic("validate")
+}
+
+func (a *testWebhookV1Panicking) Admit(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	var patch []byte
+	patch[0] = '{'
+	return &admissionv1.AdmissionResponse{Allowed: true, Patch: patch}
+}
+
+func TestV1WebhookPanics(t *testing.T) {
+	cases := []struct {
+		policy      PanicPolicy
+		wantAllowed bool
+	}{
+		{policy: "", wantAllowed: false},
+		{policy: PanicPolicyDeny, wantAllowed: false},
+		{policy: PanicPolicyAllow, wantAllowed: true},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.policy), func(t *testing.T) {
+			server := newTestServer(t, &testWebhookV1Panicking{policy: c.policy})
+			defer server.Close()
+
+			for _, path := range []string{validatorPath, mutatorPath} {
+				response := postV1Review(t, server.URL+path, &admissionv1.AdmissionRequest{
+					UID:  "some-uid",
+					Kind: metav1.GroupVersionKind{Kind: "TestKind"},
+				})
+				if response == nil {
+					t.Fatalf("expect review response at %q but get nil", path)
+				}
+				if response.Allowed != c.wantAllowed {
+					t.Errorf("expect allowed=%v at %q, got %v", c.wantAllowed, path, response)
+				}
+				if !response.Allowed && (response.Result == nil || response.Result.Code != http.StatusInternalServerError) {
+					t.Errorf("expect an internal error result at %q, got %v", path, response.Result)
+				}
+				if response.Allowed && len(response.Warnings) == 0 {
+					t.Errorf("expect a warning at %q when allowing after a panic", path)
+				}
+			}
+		})
+	}
+}
+
+func postV1Review(t *testing.T, url string, request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	payload, _ := json.Marshal(&admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "admission.k8s.io/v1",
+			Kind:       "AdmissionReview",
+		},
+		Request: request,
+	})
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatalf("unexpected error when calling webhook, but got %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading body at url %q: %v", url, err)
+	}
+
+	reviewResponse := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, reviewResponse); err != nil {
+		t.Fatalf("unexpected error parsing json body at url %q: %v", url, err)
+	}
+	return reviewResponse.Response
+}
+
 func newTestServer(t *testing.T, webhook AdmissionHook) *httptest.Server {
 	serverConfig := genericapiserver.NewRecommendedConfig(Codecs)
+	serverConfig.OpenAPIV3Config = genericapiserver.DefaultOpenAPIV3Config(generated.GetOpenAPIDefinitions, openapi.NewDefinitionNamer(Scheme))
+	serverConfig.SkipOpenAPIInstallation = true
 	serverConfig.ExternalAddress = "192.168.10.4:443"
 	serverConfig.PublicAddress = net.ParseIP("192.168.10.4")
 	serverConfig.LegacyAPIGroupPrefixes = sets.NewString("/api")
@@ -231,7 +474,7 @@ func newTestServer(t *testing.T, webhook AdmissionHook) *httptest.Server {
 	config := &Config{
 		GenericConfig: serverConfig,
 		ExtraConfig: ExtraConfig{
-			[]AdmissionHook{webhook},
+			AdmissionHooks: []AdmissionHook{webhook},
 		},
 		RestConfig: &restclient.Config{},
 	}
@@ -0,0 +1,64 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// VersionedAttributes returns the attributes of the admission request in the form the admission plugins of the
+// API server evaluate, with the objects in the version of the request decoded as unstructured.
+func VersionedAttributes(request *admissionv1.AdmissionRequest) (*admission.VersionedAttributes, error) {
+	obj, err := decodeObject(request.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode object: %w", err)
+	}
+	oldObj, err := decodeObject(request.OldObject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode oldObject: %w", err)
+	}
+	options, err := decodeObject(request.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode options: %w", err)
+	}
+
+	extra := map[string][]string{}
+	for k, v := range request.UserInfo.Extra {
+		extra[k] = []string(v)
+	}
+	userInfo := &user.DefaultInfo{
+		Name:   request.UserInfo.Username,
+		UID:    request.UserInfo.UID,
+		Groups: request.UserInfo.Groups,
+		Extra:  extra,
+	}
+	kind := schema.GroupVersionKind(request.Kind)
+	resource := schema.GroupVersionResource(request.Resource)
+	dryRun := request.DryRun != nil && *request.DryRun
+
+	attributes := admission.NewAttributesRecord(obj, oldObj, kind, request.Namespace, request.Name, resource, request.SubResource, admission.Operation(request.Operation), options, dryRun, userInfo)
+	return &admission.VersionedAttributes{
+		Attributes:         attributes,
+		VersionedKind:      kind,
+		VersionedObject:    obj,
+		VersionedOldObject: oldObj,
+	}, nil
+}
+
+// decodeObject decodes the raw object, returning nil for no object.
+func decodeObject(raw runtime.RawExtension) (runtime.Object, error) {
+	if len(raw.Raw) == 0 || string(raw.Raw) == "null" {
+		return nil, nil
+	}
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(raw.Raw, &obj.Object); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
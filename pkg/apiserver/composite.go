@@ -0,0 +1,215 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// NewCompositeValidatingHook returns a validating admission hook served on the given resource, which runs the given
+// validating hooks of any version and variant in order. A request is allowed if all hooks allow it. The messages
+// and causes of all denials and the warnings and audit annotations of all hooks are aggregated. The resources of
+// the given hooks are not served. The given hooks must not declare match criteria, which a composition cannot honor.
+func NewCompositeValidatingHook(resource schema.GroupVersionResource, singular string, hooks ...ValidatingAdmissionHook) ValidatingAdmissionHookV1WithError {
+	h := &compositeValidatingHook{compositeHook: compositeHook{resource: resource, singular: singular}}
+	for _, hook := range hooks {
+		admission, ok := validatingAdmission(hook)
+		if !ok {
+			panic(fmt.Sprintf("%T does not implement any validating admission hook interface", hook))
+		}
+		if _, ok := hookAs[AdmissionHookWithMatchCriteria](hook); ok {
+			panic(fmt.Sprintf("%T declares match criteria, which are not evaluated for the hooks of a composition", hook))
+		}
+		gvr, _ := hook.ValidatingResource()
+		h.hooks = append(h.hooks, hook)
+		h.names = append(h.names, gvr.GroupResource().String())
+		h.admissions = append(h.admissions, admission)
+	}
+	return h
+}
+
+// NewCompositeMutatingHook returns a mutating admission hook served on the given resource, which runs the given
+// mutating hooks of any version and variant in order. Every hook sees the object with the patches of the previous
+// hooks applied and one combined patch is returned. The first denial ends the chain. Warnings and audit annotations
+// of all called hooks are aggregated. The resources of the given hooks are not served. The given hooks must not declare
+// match criteria, like for NewCompositeValidatingHook.
+func NewCompositeMutatingHook(resource schema.GroupVersionResource, singular string, hooks ...MutatingAdmissionHook) MutatingAdmissionHookV1WithError {
+	h := &compositeMutatingHook{compositeHook: compositeHook{resource: resource, singular: singular}}
+	for _, hook := range hooks {
+		admission, ok := mutatingAdmission(hook)
+		if !ok {
+			panic(fmt.Sprintf("%T does not implement any mutating admission hook interface", hook))
+		}
+		if _, ok := hookAs[AdmissionHookWithMatchCriteria](hook); ok {
+			panic(fmt.Sprintf("%T declares match criteria, which are not evaluated for the hooks of a composition", hook))
+		}
+		gvr, _ := hook.MutatingResource()
+		h.hooks = append(h.hooks, hook)
+		h.names = append(h.names, gvr.GroupResource().String())
+		h.admissions = append(h.admissions, admission)
+	}
+	return h
+}
+
+type compositeHook struct {
+	resource schema.GroupVersionResource
+	singular string
+
+	hooks      []AdmissionHook
+	names      []string
+	admissions []admissionreview.AdmissionV1HookFuncWithError
+}
+
+// Initialize initializes all hooks of the composition.
+func (h *compositeHook) Initialize(kubeClientConfig *restclient.Config, stopCh <-chan struct{}) error {
+	var errs []error
+	for i, hook := range h.hooks {
+		if err := hook.Initialize(kubeClientConfig, stopCh); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.names[i], err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// admit calls the i-th hook of the composition, converting errors to denials.
+func (h *compositeHook) admit(ctx context.Context, i int, admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response, err := h.admissions[i](ctx, admissionSpec)
+	if err != nil {
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result:  admissionreview.StatusForError(schema.GroupKind{Group: admissionSpec.Kind.Group, Kind: admissionSpec.Kind.Kind}, admissionSpec.Name, err),
+		}
+	}
+	if response == nil {
+		status := apierrors.NewInternalError(fmt.Errorf("admission hook %s returned no response", h.names[i])).Status()
+		return &admissionv1.AdmissionResponse{Allowed: false, Result: &status}
+	}
+	return response
+}
+
+type compositeValidatingHook struct {
+	compositeHook
+}
+
+func (h *compositeValidatingHook) ValidatingResource() (plural schema.GroupVersionResource, singular string) {
+	return h.resource, h.singular
+}
+
+func (h *compositeValidatingHook) Validate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	result := &admissionv1.AdmissionResponse{Allowed: true}
+	var denials []*metav1.Status
+	for i := range h.admissions {
+		response := h.admit(ctx, i, admissionSpec)
+		mergeWarningsAndAnnotations(result, response)
+		if !response.Allowed {
+			denials = append(denials, response.Result)
+		}
+	}
+
+	if len(denials) > 0 {
+		result.Allowed = false
+		result.Result = aggregateDenials(denials)
+	}
+	return result, nil
+}
+
+type compositeMutatingHook struct {
+	compositeHook
+}
+
+func (h *compositeMutatingHook) MutatingResource() (plural schema.GroupVersionResource, singular string) {
+	return h.resource, h.singular
+}
+
+func (h *compositeMutatingHook) Admit(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	result := &admissionv1.AdmissionResponse{Allowed: true}
+	original := admissionSpec.Object.Raw
+	current := original
+
+	for i := range h.admissions {
+		request := admissionSpec
+		if len(current) > 0 {
+			request = admissionSpec.DeepCopy()
+			request.Object.Raw = current
+			request.Object.Object = nil
+		}
+
+		response := h.admit(ctx, i, request)
+		mergeWarningsAndAnnotations(result, response)
+		if !response.Allowed {
+			result.Allowed = false
+			result.Result = response.Result
+			return result, nil
+		}
+		if len(response.Patch) == 0 {
+			continue
+		}
+
+		patched, err := applyPatch(current, response)
+		if err != nil {
+			return nil, apierrors.NewInternalError(fmt.Errorf("admission hook %s: %w", h.names[i], err))
+		}
+		current = patched
+	}
+
+	patch, err := createPatch(original, current)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	combined := patchResponse(patch)
+	result.Patch, result.PatchType = combined.Patch, combined.PatchType
+	return result, nil
+}
+
+func mergeWarningsAndAnnotations(into, from *admissionv1.AdmissionResponse) {
+	into.Warnings = append(into.Warnings, from.Warnings...)
+	for k, v := range from.AuditAnnotations {
+		if into.AuditAnnotations == nil {
+			into.AuditAnnotations = map[string]string{}
+		}
+		into.AuditAnnotations[k] = v
+	}
+}
+
+// aggregateDenials combines the results of several denials into one, keeping the code and reason of the first one
+// with a result.
+func aggregateDenials(denials []*metav1.Status) *metav1.Status {
+	aggregated := &metav1.Status{
+		Status: metav1.StatusFailure,
+		Code:   http.StatusForbidden,
+		Reason: metav1.StatusReasonForbidden,
+	}
+	var messages []string
+	seeded := false
+	for _, denial := range denials {
+		if denial == nil {
+			continue
+		}
+		if len(denial.Message) > 0 {
+			messages = append(messages, denial.Message)
+		}
+		if !seeded {
+			aggregated = denial.DeepCopy()
+			seeded = true
+			continue
+		}
+		if denial.Details != nil && len(denial.Details.Causes) > 0 {
+			if aggregated.Details == nil {
+				aggregated.Details = &metav1.StatusDetails{}
+			}
+			aggregated.Details.Causes = append(aggregated.Details.Causes, denial.Details.Causes...)
+		}
+	}
+	aggregated.Message = strings.Join(messages, "; ")
+	return aggregated
+}
@@ -0,0 +1,201 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type testPolicy struct {
+	testWebhook
+
+	name string
+}
+
+// Validate denies objects carrying the label of the policy.
+func (p *testPolicy) Validate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(admissionSpec.Object.Raw, &obj); err != nil {
+		return nil, err
+	}
+	labels, _ := obj["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	if _, ok := labels[p.name]; ok {
+		return nil, fmt.Errorf("label %s is not allowed", p.name)
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true, Warnings: []string{p.name}}, nil
+}
+
+// Admit adds the label of the policy, counting the labels that were there before.
+func (p *testPolicy) Admit(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	if p.name == "deny" {
+		return nil, errors.New("denied")
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(admissionSpec.Object.Raw, &obj); err != nil {
+		return nil, err
+	}
+	labels, _ := obj["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	patch := fmt.Sprintf(`[{"op":"add","path":"/metadata/labels/%s","value":"%d"}]`, p.name, len(labels))
+	return &admissionv1.AdmissionResponse{Allowed: true, Patch: []byte(patch)}, nil
+}
+
+func TestCompositeValidatingHook(t *testing.T) {
+	hook := NewCompositeValidatingHook(
+		schema.GroupVersionResource{Group: "admission.openshift.io", Version: "v1", Resource: "testvalidators"}, "testvalidator",
+		&testPolicy{name: "a"}, &testPolicy{name: "b"}, &testPolicy{name: "c"},
+	)
+	server := newTestServer(t, hook)
+	defer server.Close()
+
+	cases := []struct {
+		labels       string
+		wantAllowed  bool
+		wantMessage  string
+		wantWarnings int
+	}{
+		{labels: `{}`, wantAllowed: true, wantWarnings: 3},
+		{labels: `{"b":""}`, wantMessage: "label b is not allowed", wantWarnings: 2},
+		{labels: `{"a":"","c":""}`, wantMessage: "label a is not allowed; label c is not allowed", wantWarnings: 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.labels, func(t *testing.T) {
+			response := postV1Review(t, server.URL+validatorPath, &admissionv1.AdmissionRequest{
+				Kind:   metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+				Object: runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":` + c.labels + `}}`)},
+			})
+			if response == nil {
+				t.Fatalf("expect review response but get nil")
+			}
+			if response.Allowed != c.wantAllowed {
+				t.Errorf("expect allowed=%v, got %v", c.wantAllowed, response)
+			}
+			if !c.wantAllowed && (response.Result == nil || response.Result.Message != c.wantMessage) {
+				t.Errorf("expect message %q, got %v", c.wantMessage, response.Result)
+			}
+			if len(response.Warnings) != c.wantWarnings {
+				t.Errorf("expect %d warnings, got %v", c.wantWarnings, response.Warnings)
+			}
+		})
+	}
+}
+
+func TestCompositeMutatingHook(t *testing.T) {
+	resource := schema.GroupVersionResource{Group: "admission.openshift.io", Version: "v1", Resource: "testmutators"}
+	raw := []byte(`{"metadata":{"labels":{"existing":""}}}`)
+
+	cases := []struct {
+		name        string
+		hooks       []MutatingAdmissionHook
+		wantAllowed bool
+		wantObject  string
+	}{
+		{
+			name:        "patches are applied in sequence",
+			hooks:       []MutatingAdmissionHook{&testPolicy{name: "a"}, &testPolicy{name: "b"}},
+			wantAllowed: true,
+			wantObject:  `{"metadata":{"labels":{"existing":"","a":"1","b":"2"}}}`,
+		},
+		{
+			name:  "denial ends the chain",
+			hooks: []MutatingAdmissionHook{&testPolicy{name: "a"}, &testPolicy{name: "deny"}, &testPolicy{name: "b"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := newTestServer(t, NewCompositeMutatingHook(resource, "testmutator", c.hooks...))
+			defer server.Close()
+
+			response := postV1Review(t, server.URL+mutatorPath, &admissionv1.AdmissionRequest{
+				Kind:   metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+				Object: runtime.RawExtension{Raw: raw},
+			})
+			if response == nil {
+				t.Fatalf("expect review response but get nil")
+			}
+			if response.Allowed != c.wantAllowed {
+				t.Fatalf("expect allowed=%v, got %v", c.wantAllowed, response)
+			}
+			if !c.wantAllowed {
+				if len(response.Patch) != 0 {
+					t.Errorf("expect no patch for a denial, got %s", response.Patch)
+				}
+				return
+			}
+
+			patch, err := jsonpatch.DecodePatch(response.Patch)
+			if err != nil {
+				t.Fatalf("unexpected error decoding patch %s: %v", response.Patch, err)
+			}
+			patched, err := patch.Apply(raw)
+			if err != nil {
+				t.Fatalf("unexpected error applying patch %s: %v", response.Patch, err)
+			}
+			if !jsonpatch.Equal(patched, []byte(c.wantObject)) {
+				t.Errorf("expect patched object %s, got %s", c.wantObject, patched)
+			}
+		})
+	}
+}
+
+func TestCompositeHookRejectsMatchCriteria(t *testing.T) {
+	resource := schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "composites"}
+	for name, compose := range map[string]func(){
+		"validating": func() {
+			NewCompositeValidatingHook(resource, "composite", &testPolicy{name: "a"}, &testMatchingWebhook{criteria: podCriteria})
+		},
+		"mutating": func() {
+			NewCompositeMutatingHook(resource, "composite", &testPolicy{name: "a"}, &testMatchingWebhook{criteria: podCriteria})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expect a hook with match criteria to be rejected")
+				}
+			}()
+			compose()
+		})
+	}
+}
+
+func TestAggregateDenials(t *testing.T) {
+	invalid := &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusUnprocessableEntity,
+		Reason:  metav1.StatusReasonInvalid,
+		Message: "a is invalid",
+		Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{{Field: "a"}}},
+	}
+	forbidden := &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusForbidden,
+		Reason:  metav1.StatusReasonForbidden,
+		Message: "b is forbidden",
+		Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{{Field: "b"}}},
+	}
+
+	aggregated := aggregateDenials([]*metav1.Status{nil, invalid, forbidden})
+	if aggregated.Code != http.StatusUnprocessableEntity || aggregated.Reason != metav1.StatusReasonInvalid {
+		t.Errorf("expect the code and reason of the first result, got %d %s", aggregated.Code, aggregated.Reason)
+	}
+	if aggregated.Message != "a is invalid; b is forbidden" {
+		t.Errorf("unexpected message %q", aggregated.Message)
+	}
+	if aggregated.Details == nil || len(aggregated.Details.Causes) != 2 {
+		t.Errorf("expect the causes of both results, got %#v", aggregated.Details)
+	}
+	if len(invalid.Details.Causes) != 1 {
+		t.Errorf("expect the results to be left unchanged, got %#v", invalid.Details)
+	}
+}
@@ -0,0 +1,207 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// IdempotencyResult is the result of calling a mutating admission hook twice for an object, the second time with the
+// patch of the first call applied, like the API server does when it reinvokes a webhook.
+type IdempotencyResult struct {
+	// Object is the object the hook was called with first.
+	Object *unstructured.Unstructured
+	// Denied is the message of the denial if the hook denied one of the calls, which ends the check.
+	Denied string
+	// Mutated is the object with the patch of the first call applied.
+	Mutated []byte
+	// Diff are the changes of the patch of the second call to the mutated object.
+	Diff []FieldDiff
+}
+
+// ObjectName returns the kind and the name of the object, with its namespace if namespaced, like "Pod ns/name".
+func (r *IdempotencyResult) ObjectName() string {
+	return objectName(r.Object)
+}
+
+// Idempotent tells whether the second call changed nothing. Patches which do not change the object, like adding a
+// label that is already set, are idempotent.
+func (r *IdempotencyResult) Idempotent() bool {
+	return len(r.Diff) == 0
+}
+
+// FieldDiff is the change of a field of an object, identified by its JSON pointer.
+type FieldDiff struct {
+	Operation string      `json:"op"`
+	Path      string      `json:"path"`
+	Before    interface{} `json:"before,omitempty"`
+	After     interface{} `json:"after,omitempty"`
+}
+
+func (d FieldDiff) String() string {
+	before, _ := json.Marshal(d.Before)
+	after, _ := json.Marshal(d.After)
+	switch d.Operation {
+	case "add":
+		return fmt.Sprintf("%s: added %s", d.Path, after)
+	case "remove":
+		return fmt.Sprintf("%s: removed %s", d.Path, before)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", d.Path, before, after)
+	}
+}
+
+// CheckIdempotency calls the mutating admission hook for each object with the given operation, CREATE or UPDATE,
+// and a second time with the patch of the first call applied. Updates are from the object to itself. The hook is not
+// initialized.
+func CheckIdempotency(ctx context.Context, hook MutatingAdmissionHook, operation admissionv1.Operation, objects ...*unstructured.Unstructured) ([]*IdempotencyResult, error) {
+	if operation != admissionv1.Create && operation != admissionv1.Update {
+		return nil, fmt.Errorf("mutating admission hooks are reinvoked for CREATE and UPDATE, got %s", operation)
+	}
+	reviewer, err := NewReviewer(hook)
+	if err != nil {
+		return nil, err
+	}
+	resource, _ := hook.MutatingResource()
+
+	results := make([]*IdempotencyResult, 0, len(objects))
+	for _, obj := range objects {
+		original, err := obj.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		result := &IdempotencyResult{Object: obj}
+		results = append(results, result)
+
+		if result.Mutated, result.Denied, err = admitOnce(ctx, reviewer, resource, reinvocationRequest(obj, operation, original, original)); err != nil {
+			return nil, fmt.Errorf("%s: %w", objectName(obj), err)
+		}
+		if len(result.Denied) > 0 {
+			continue
+		}
+		reinvoked, denied, err := admitOnce(ctx, reviewer, resource, reinvocationRequest(obj, operation, result.Mutated, original))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", objectName(obj), err)
+		}
+		if result.Denied = denied; len(denied) > 0 {
+			continue
+		}
+		if result.Diff, err = diffObjects(result.Mutated, reinvoked); err != nil {
+			return nil, fmt.Errorf("%s: %w", objectName(obj), err)
+		}
+	}
+	return results, nil
+}
+
+// admitOnce runs the request through the mutating hook, returning the object with the patch applied, or the message
+// of the denial.
+func admitOnce(ctx context.Context, reviewer *Reviewer, resource schema.GroupVersionResource, request *admissionv1.AdmissionRequest) ([]byte, string, error) {
+	result, err := reviewer.Review(ctx, resource, &admissionv1.AdmissionReview{Request: request})
+	if err != nil {
+		return nil, "", err
+	}
+	if response := result.Review.Response; !response.Allowed {
+		if response.Result != nil && len(response.Result.Message) > 0 {
+			return nil, response.Result.Message, nil
+		}
+		return nil, "denied", nil
+	}
+	if result.PatchedObject != nil {
+		return result.PatchedObject, "", nil
+	}
+	return request.Object.Raw, "", nil
+}
+
+// reinvocationRequest returns the admission request of the operation on the object, with the current state of the
+// object. Updates are from the original object.
+func reinvocationRequest(obj *unstructured.Unstructured, operation admissionv1.Operation, current, original []byte) *admissionv1.AdmissionRequest {
+	gvk := obj.GroupVersionKind()
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+	kind := metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}
+	resource := metav1.GroupVersionResource{Group: gvr.Group, Version: gvr.Version, Resource: gvr.Resource}
+	request := &admissionv1.AdmissionRequest{
+		UID:             uuid.NewUUID(),
+		Kind:            kind,
+		Resource:        resource,
+		RequestKind:     &kind,
+		RequestResource: &resource,
+		Name:            obj.GetName(),
+		Namespace:       obj.GetNamespace(),
+		Operation:       operation,
+		Object:          runtime.RawExtension{Raw: current},
+	}
+	if operation == admissionv1.Update {
+		request.OldObject = runtime.RawExtension{Raw: original}
+	}
+	return request
+}
+
+// diffObjects returns the changes from the JSON object before to after.
+func diffObjects(before, after []byte) ([]FieldDiff, error) {
+	operations, err := jsonpatch.CreatePatch(before, after)
+	if err != nil {
+		return nil, fmt.Errorf("unable to diff objects: %w", err)
+	}
+	if len(operations) == 0 {
+		return nil, nil
+	}
+	var obj interface{}
+	if err := json.Unmarshal(before, &obj); err != nil {
+		return nil, err
+	}
+	diff := make([]FieldDiff, 0, len(operations))
+	for _, op := range operations {
+		d := FieldDiff{Operation: op.Operation, Path: op.Path}
+		if op.Operation != "add" {
+			d.Before = lookupPointer(obj, op.Path)
+		}
+		if op.Operation != "remove" {
+			d.After = op.Value
+		}
+		diff = append(diff, d)
+	}
+	return diff, nil
+}
+
+// lookupPointer returns the value at the JSON pointer in the decoded JSON object, or nil if there is none.
+func lookupPointer(obj interface{}, pointer string) interface{} {
+	if len(pointer) == 0 {
+		return obj
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch value := obj.(type) {
+		case map[string]interface{}:
+			obj = value[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(value) {
+				return nil
+			}
+			obj = value[i]
+		default:
+			return nil
+		}
+	}
+	return obj
+}
+
+// objectName returns the kind and the name of the object, with its namespace if namespaced.
+func objectName(obj *unstructured.Unstructured) string {
+	name := obj.GetKind() + " " + obj.GetName()
+	if ns := obj.GetNamespace(); len(ns) > 0 {
+		name = obj.GetKind() + " " + ns + "/" + obj.GetName()
+	}
+	return name
+}
@@ -0,0 +1,85 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type testIdempotencyMutator struct {
+	testWebhook
+}
+
+func (a *testIdempotencyMutator) Mutate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest, obj *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	switch obj.Name {
+	case "labeled":
+		obj.Labels = map[string]string{"labeled": "true"}
+	case "counted":
+		count, _ := strconv.Atoi(obj.Annotations["count"])
+		obj.Annotations = map[string]string{"count": strconv.Itoa(count + 1)}
+	case "denied":
+		return nil, errors.New("no")
+	}
+	return obj, nil
+}
+
+func newTestConfigMap(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+	}}
+}
+
+func TestCheckIdempotency(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewTypedMutatingHook[*corev1.ConfigMap](scheme, &testIdempotencyMutator{})
+
+	results, err := CheckIdempotency(context.Background(), hook, admissionv1.Create,
+		newTestConfigMap("unchanged"),
+		newTestConfigMap("labeled"),
+		newTestConfigMap("counted"),
+		newTestConfigMap("denied"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+	for _, result := range results[:2] {
+		if !result.Idempotent() || len(result.Denied) > 0 {
+			t.Errorf("%s: expected idempotency, got %#v", result.Object.GetName(), result)
+		}
+	}
+
+	counted := results[2]
+	if counted.Idempotent() {
+		t.Fatalf("expected counted not to be idempotent")
+	}
+	want := []FieldDiff{{Operation: "replace", Path: "/metadata/annotations/count", Before: "1", After: "2"}}
+	if !reflect.DeepEqual(counted.Diff, want) {
+		t.Errorf("expected diff %#v, got %#v", want, counted.Diff)
+	}
+	if s := counted.Diff[0].String(); s != `/metadata/annotations/count: "1" -> "2"` {
+		t.Errorf("unexpected diff string %q", s)
+	}
+
+	if denied := results[3]; denied.Denied != "no" || !denied.Idempotent() {
+		t.Errorf("expected a denial, got %#v", denied)
+	}
+
+	if _, err := CheckIdempotency(context.Background(), hook, admissionv1.Delete); err == nil {
+		t.Errorf("expected an error for DELETE")
+	}
+}
@@ -0,0 +1,231 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/predicates/namespace"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/predicates/object"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/predicates/rules"
+	"k8s.io/apiserver/pkg/cel/environment"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// MatchCriteria select the admission requests an admission hook handles, with the semantics of the fields of the same
+// name of a webhook. Empty fields match all requests.
+type MatchCriteria struct {
+	// Rules match the operation and the resource of the request. The resource is the one the request is sent for.
+	Rules []admissionregistrationv1.RuleWithOperations
+	// NamespaceSelector matches the labels of the namespace of the request. Requests for cluster-scoped resources
+	// other than namespaces always match.
+	NamespaceSelector *metav1.LabelSelector
+	// ObjectSelector matches the labels of the object or of the old object of the request.
+	ObjectSelector *metav1.LabelSelector
+	// MatchConditions are CEL expressions which must all evaluate to true. The authorizer variable is not available.
+	MatchConditions []admissionregistrationv1.MatchCondition
+}
+
+// AdmissionHookWithMatchCriteria can be implemented by admission hooks to declare the requests they handle. The server
+// allows the other requests without calling the hook, in case the webhook configuration sends them nonetheless, and
+// counts them in the generic_admission_server_hook_unmatched_requests_total metric. The criteria replace the match
+// fields of the webhooks registered for the hook, and hooks declaring criteria are registered without implementing
+// AdmissionHookWithValidatingWebhook or AdmissionHookWithMutatingWebhook. Errors evaluating the criteria deny the
+// request, unless the failure policy of the webhook of the hook is Ignore and a match condition failed to evaluate.
+type AdmissionHookWithMatchCriteria interface {
+	MatchCriteria() MatchCriteria
+}
+
+var (
+	conditionCompilerOnce sync.Once
+	conditionCompiler     cel.ConditionCompiler
+)
+
+// matchConditionCompiler returns the compiler of match conditions of the API server version this server is built
+// with.
+func matchConditionCompiler() cel.ConditionCompiler {
+	conditionCompilerOnce.Do(func() {
+		conditionCompiler = cel.NewConditionCompiler(environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion()))
+	})
+	return conditionCompiler
+}
+
+// requestMatcher evaluates match criteria against admission requests.
+type requestMatcher struct {
+	criteria          MatchCriteria
+	namespaceSelector labels.Selector
+	objectSelector    labels.Selector
+	conditions        matchconditions.Matcher
+
+	// namespaces looks up the labels of namespaces. Namespace selectors are not evaluated without, e.g. when
+	// reviewing requests in process.
+	namespaces *namespace.Matcher
+}
+
+var (
+	_ namespace.NamespaceSelectorProvider = &requestMatcher{}
+	_ object.ObjectSelectorProvider       = &requestMatcher{}
+)
+
+// newRequestMatcher parses the selectors and compiles the match conditions of the criteria. The failure policy
+// decides about requests for which match conditions fail to evaluate, the name identifies the hook in metrics.
+func newRequestMatcher(criteria MatchCriteria, failurePolicy *admissionregistrationv1.FailurePolicyType, hookType admissionreview.HookType, name string) (*requestMatcher, error) {
+	m := &requestMatcher{criteria: criteria}
+	var errs []error
+	var err error
+	if m.namespaceSelector, err = labelSelectorAsSelector(criteria.NamespaceSelector); err != nil {
+		errs = append(errs, fmt.Errorf("namespaceSelector: %w", err))
+	}
+	if m.objectSelector, err = labelSelectorAsSelector(criteria.ObjectSelector); err != nil {
+		errs = append(errs, fmt.Errorf("objectSelector: %w", err))
+	}
+	if len(criteria.MatchConditions) > 0 {
+		accessors := make([]cel.ExpressionAccessor, len(criteria.MatchConditions))
+		for i := range criteria.MatchConditions {
+			accessors[i] = (*matchconditions.MatchCondition)(&criteria.MatchConditions[i])
+		}
+		evaluator := matchConditionCompiler().CompileCondition(accessors, cel.OptionalVariableDeclarations{}, environment.StoredExpressions)
+		for _, err := range evaluator.CompilationErrors() {
+			errs = append(errs, fmt.Errorf("matchConditions: %w", err))
+		}
+		matcherType := "validate"
+		if hookType == admissionreview.HookTypeMutating {
+			matcherType = "admit"
+		}
+		m.conditions = matchconditions.NewMatcher(evaluator, failurePolicy, "webhook", matcherType, name)
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	return m, nil
+}
+
+// labelSelectorAsSelector parses the selector, which matches everything if nil like the defaulted selectors of
+// webhooks.
+func labelSelectorAsSelector(selector *metav1.LabelSelector) (labels.Selector, error) {
+	if selector == nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(selector)
+}
+
+func (m *requestMatcher) GetParsedNamespaceSelector() (labels.Selector, error) {
+	return m.namespaceSelector, nil
+}
+
+func (m *requestMatcher) GetParsedObjectSelector() (labels.Selector, error) {
+	return m.objectSelector, nil
+}
+
+// Match tells whether the request matches the criteria.
+func (m *requestMatcher) Match(ctx context.Context, request *admissionv1.AdmissionRequest) (bool, error) {
+	attributes, err := VersionedAttributes(request)
+	if err != nil {
+		return false, apierrors.NewBadRequest(err.Error())
+	}
+
+	if len(m.criteria.Rules) > 0 {
+		matches := false
+		for _, rule := range m.criteria.Rules {
+			if (&rules.Matcher{Rule: rule, Attr: attributes}).Matches() {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+	if m.namespaces != nil {
+		if matches, err := m.namespaces.MatchNamespaceSelector(m, attributes); err != nil {
+			return false, err
+		} else if !matches {
+			return false, nil
+		}
+	}
+	if matches, err := (&object.Matcher{}).MatchObjectSelector(m, attributes); err != nil {
+		return false, err
+	} else if !matches {
+		return false, nil
+	}
+	if m.conditions != nil {
+		result := m.conditions.Match(ctx, attributes, nil, nil)
+		if result.Error != nil {
+			return false, apierrors.NewInternalError(fmt.Errorf("failed to evaluate match conditions: %w", result.Error))
+		}
+		return result.Matches, nil
+	}
+	return true, nil
+}
+
+// hookMatcher returns the matcher of the criteria of the hook of the given type, or nil if it declares none.
+func hookMatcher(hook AdmissionHook, hookType admissionreview.HookType, name string) (*requestMatcher, error) {
+	h, ok := hookAs[AdmissionHookWithMatchCriteria](hook)
+	if !ok {
+		return nil, nil
+	}
+	var failurePolicy *admissionregistrationv1.FailurePolicyType
+	switch hookType {
+	case admissionreview.HookTypeValidating:
+		if w, ok := hookAs[AdmissionHookWithValidatingWebhook](hook); ok {
+			failurePolicy = w.ValidatingWebhook().FailurePolicy
+		}
+	case admissionreview.HookTypeMutating:
+		if w, ok := hookAs[AdmissionHookWithMutatingWebhook](hook); ok {
+			failurePolicy = w.MutatingWebhook().FailurePolicy
+		}
+	}
+	return newRequestMatcher(h.MatchCriteria(), failurePolicy, hookType, name)
+}
+
+// NeedsNamespaces tells whether any of the hooks selects requests by the labels of their namespace, for which the
+// server lists and watches namespaces.
+func NeedsNamespaces(admissionHooks ...AdmissionHook) bool {
+	for _, hook := range admissionHooks {
+		if h, ok := hookAs[AdmissionHookWithMatchCriteria](hook); ok && h.MatchCriteria().NamespaceSelector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// applyToValidatingWebhook sets the match fields of the webhook which the criteria declare.
+func (c MatchCriteria) applyToValidatingWebhook(webhook *admissionregistrationv1.ValidatingWebhook) {
+	if len(c.Rules) > 0 {
+		webhook.Rules = c.Rules
+	}
+	if c.NamespaceSelector != nil {
+		webhook.NamespaceSelector = c.NamespaceSelector
+	}
+	if c.ObjectSelector != nil {
+		webhook.ObjectSelector = c.ObjectSelector
+	}
+	if len(c.MatchConditions) > 0 {
+		webhook.MatchConditions = c.MatchConditions
+	}
+}
+
+// applyToMutatingWebhook sets the match fields of the webhook which the criteria declare.
+func (c MatchCriteria) applyToMutatingWebhook(webhook *admissionregistrationv1.MutatingWebhook) {
+	if len(c.Rules) > 0 {
+		webhook.Rules = c.Rules
+	}
+	if c.NamespaceSelector != nil {
+		webhook.NamespaceSelector = c.NamespaceSelector
+	}
+	if c.ObjectSelector != nil {
+		webhook.ObjectSelector = c.ObjectSelector
+	}
+	if len(c.MatchConditions) > 0 {
+		webhook.MatchConditions = c.MatchConditions
+	}
+}
@@ -0,0 +1,208 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/predicates/namespace"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+var podCriteria = MatchCriteria{
+	Rules: []admissionregistrationv1.RuleWithOperations{{
+		Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+		Rule:       admissionregistrationv1.Rule{APIGroups: []string{""}, APIVersions: []string{"v1"}, Resources: []string{"pods"}},
+	}},
+	NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+	ObjectSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "exempt", Operator: metav1.LabelSelectorOpDoesNotExist},
+	}},
+	MatchConditions: []admissionregistrationv1.MatchCondition{
+		{Name: "not-privileged", Expression: "!has(object.spec.privileged) || !object.spec.privileged"},
+	},
+}
+
+type testMatchingWebhook struct {
+	testWebhook
+
+	criteria MatchCriteria
+	calls    int
+}
+
+func (a *testMatchingWebhook) Validate(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	a.calls++
+	return &admissionv1.AdmissionResponse{Allowed: false}
+}
+
+func (a *testMatchingWebhook) Admit(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	a.calls++
+	return &admissionv1.AdmissionResponse{Allowed: false}
+}
+
+func (a *testMatchingWebhook) MatchCriteria() MatchCriteria {
+	return a.criteria
+}
+
+func podRequest(t *testing.T, operation admissionv1.Operation, namespace string, labels map[string]string, privileged bool) *admissionv1.AdmissionRequest {
+	t.Helper()
+	metadata := map[string]interface{}{"name": "pod", "namespace": namespace}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+	raw, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   metadata,
+		"spec":       map[string]interface{}{"privileged": privileged},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Name:      "pod",
+		Namespace: namespace,
+		Operation: operation,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+func TestRequestMatcher(t *testing.T) {
+	client := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"env": "dev"}}},
+	)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	lister := informerFactory.Core().V1().Namespaces().Lister()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	informerFactory.Start(stopCh)
+	informerFactory.WaitForCacheSync(stopCh)
+
+	matcher, err := newRequestMatcher(podCriteria, nil, admissionreview.HookTypeValidating, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matcher.namespaces = &namespace.Matcher{NamespaceLister: lister, Client: client}
+
+	tests := []struct {
+		name    string
+		request *admissionv1.AdmissionRequest
+		matches bool
+		err     string
+	}{
+		{name: "matching", request: podRequest(t, admissionv1.Create, "prod", nil, false), matches: true},
+		{name: "operation", request: podRequest(t, admissionv1.Update, "prod", nil, false)},
+		{name: "namespace selector", request: podRequest(t, admissionv1.Create, "dev", nil, false)},
+		{name: "object selector", request: podRequest(t, admissionv1.Create, "prod", map[string]string{"exempt": "true"}, false)},
+		{name: "match condition", request: podRequest(t, admissionv1.Create, "prod", nil, true)},
+		{name: "missing namespace", request: podRequest(t, admissionv1.Create, "missing", nil, false), err: "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := matcher.Match(context.Background(), tt.request)
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if matches != tt.matches {
+				t.Errorf("expected matches %v, got %v", tt.matches, matches)
+			}
+		})
+	}
+}
+
+func TestRequestMatcherWithoutSelectors(t *testing.T) {
+	matcher, err := newRequestMatcher(MatchCriteria{Rules: podCriteria.Rules}, nil, admissionreview.HookTypeValidating, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matcher.namespaces = &namespace.Matcher{}
+
+	matches, err := matcher.Match(context.Background(), podRequest(t, admissionv1.Create, "prod", map[string]string{"exempt": "true"}, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matches {
+		t.Errorf("expected criteria without selectors to match")
+	}
+}
+
+func TestReviewerMatchCriteria(t *testing.T) {
+	hook := &testMatchingWebhook{criteria: podCriteria}
+	reviewer, err := NewReviewer(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource, _ := hook.ValidatingResource()
+
+	// namespace selectors are not evaluated in process
+	for _, request := range []*admissionv1.AdmissionRequest{
+		podRequest(t, admissionv1.Create, "dev", nil, false),
+		podRequest(t, admissionv1.Update, "prod", nil, false),
+	} {
+		result, err := reviewer.Review(context.Background(), resource, &admissionv1.AdmissionReview{Request: request})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matching := request.Operation == admissionv1.Create; result.Review.Response.Allowed == matching {
+			t.Errorf("%s in %s: unexpected response %#v", request.Operation, request.Namespace, result.Review.Response)
+		}
+	}
+	if hook.calls != 1 {
+		t.Errorf("expected the hook to be called for the matching request only, got %d calls", hook.calls)
+	}
+}
+
+func TestValidateMatchCriteria(t *testing.T) {
+	hook := &testMatchingWebhook{criteria: MatchCriteria{
+		ObjectSelector:  &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "a", Operator: "Bogus"}}},
+		MatchConditions: []admissionregistrationv1.MatchCondition{{Name: "authz", Expression: "authorizer.group('').resource('pods').check('get').allowed()"}},
+	}}
+	err := ValidateAdmissionHooks(hook)
+	if err == nil {
+		t.Fatal("expected invalid match criteria to be rejected")
+	}
+	for _, want := range []string{"objectSelector", "matchConditions", "undeclared reference to 'authorizer'"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestBuildRegistrationObjectsMatchCriteria(t *testing.T) {
+	objects := BuildRegistrationObjects(RegistrationConfig{Name: "test"}, nil, &testMatchingWebhook{criteria: podCriteria})
+	validating := objects.ValidatingWebhookConfiguration
+	if validating == nil || len(validating.Webhooks) != 1 {
+		t.Fatalf("expected a webhook for the hook with match criteria, got %#v", validating)
+	}
+	webhook := validating.Webhooks[0]
+	if !reflect.DeepEqual(webhook.Rules, podCriteria.Rules) ||
+		!reflect.DeepEqual(webhook.NamespaceSelector, podCriteria.NamespaceSelector) ||
+		!reflect.DeepEqual(webhook.ObjectSelector, podCriteria.ObjectSelector) ||
+		!reflect.DeepEqual(webhook.MatchConditions, podCriteria.MatchConditions) {
+		t.Errorf("expected the match fields of the criteria, got %#v", webhook)
+	}
+	mutating := objects.MutatingWebhookConfiguration
+	if mutating == nil || len(mutating.Webhooks) != 1 || !reflect.DeepEqual(mutating.Webhooks[0].Rules, podCriteria.Rules) {
+		t.Errorf("expected a mutating webhook with the rules of the criteria, got %#v", mutating)
+	}
+}
@@ -0,0 +1,162 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// createPatch returns the JSONPatch from original to mutated, or nil if the two are semantically equal.
+func createPatch(original, mutated []byte) ([]byte, error) {
+	operations, err := jsonpatch.CreatePatch(original, mutated)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create patch: %w", err)
+	}
+	if len(operations) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(operations)
+}
+
+// createDecodedPatch returns the JSONPatch of the changes from decoded to mutated, applied to raw. Here decoded is raw
+// decoded and encoded again without changes, and mutated was encoded from the decoded raw after the hook changed it.
+// Diffing against decoded rather than raw keeps the changes made by decoding, like fields unknown to the decoded type,
+// defaulted empty fields or canonicalized quantities, out of the patch.
+func createDecodedPatch(raw, decoded, mutated []byte) ([]byte, error) {
+	operations, err := jsonpatch.CreatePatch(decoded, mutated)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create patch: %w", err)
+	}
+	if len(operations) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("unable to decode object: %w", err)
+	}
+	for _, operation := range operations {
+		if doc, err = applyOperation(doc, operation); err != nil {
+			return nil, fmt.Errorf("unable to apply %s of %q: %w", operation.Operation, operation.Path, err)
+		}
+	}
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return createPatch(raw, patched)
+}
+
+// pointerTokenUnescaper unescapes the reference tokens of a JSON pointer.
+var pointerTokenUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// applyOperation applies an add, replace or remove operation to the decoded JSON document doc and returns the
+// changed document. Unlike RFC 6902 it creates missing parent objects and treats a replace of a missing object member
+// as an add and a remove of a missing path as a no-op, since the operation was computed against the decoded object,
+// which may carry fields the raw object does not.
+func applyOperation(doc interface{}, operation jsonpatch.Operation) (interface{}, error) {
+	if operation.Path == "" {
+		if operation.Operation == "remove" {
+			return nil, nil
+		}
+		return operation.Value, nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(operation.Path, "/"), "/")
+	for i := range tokens {
+		tokens[i] = pointerTokenUnescaper.Replace(tokens[i])
+	}
+	return applyTokens(doc, tokens, operation)
+}
+
+// applyTokens applies the operation at the path given by tokens below node and returns the changed node.
+func applyTokens(node interface{}, tokens []string, operation jsonpatch.Operation) (interface{}, error) {
+	token, last := tokens[0], len(tokens) == 1
+	switch typed := node.(type) {
+	case nil:
+		if operation.Operation == "remove" {
+			return nil, nil
+		}
+		return applyTokens(map[string]interface{}{}, tokens, operation)
+	case map[string]interface{}:
+		if last {
+			if operation.Operation == "remove" {
+				delete(typed, token)
+			} else {
+				typed[token] = operation.Value
+			}
+			return typed, nil
+		}
+		child, ok := typed[token]
+		if !ok && operation.Operation == "remove" {
+			return typed, nil
+		}
+		child, err := applyTokens(child, tokens[1:], operation)
+		if err != nil {
+			return nil, err
+		}
+		typed[token] = child
+		return typed, nil
+	case []interface{}:
+		if last && token == "-" && operation.Operation == "add" {
+			return append(typed, operation.Value), nil
+		}
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index > len(typed) {
+			return nil, fmt.Errorf("invalid array index %q", token)
+		}
+		if index == len(typed) {
+			if last && operation.Operation == "add" {
+				return append(typed, operation.Value), nil
+			}
+			if operation.Operation == "remove" {
+				return typed, nil
+			}
+			return nil, fmt.Errorf("array index %d out of bounds", index)
+		}
+		if !last {
+			child, err := applyTokens(typed[index], tokens[1:], operation)
+			if err != nil {
+				return nil, err
+			}
+			typed[index] = child
+			return typed, nil
+		}
+		switch operation.Operation {
+		case "add":
+			return slices.Insert(typed, index, operation.Value), nil
+		case "remove":
+			return slices.Delete(typed, index, index+1), nil
+		default:
+			typed[index] = operation.Value
+			return typed, nil
+		}
+	default:
+		return nil, fmt.Errorf("cannot traverse %T at %q", node, token)
+	}
+}
+
+// patchResponse returns an allowing response carrying the given JSONPatch, if any.
+func patchResponse(patch []byte) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{Allowed: true}
+	if len(patch) > 0 {
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.Patch = patch
+		response.PatchType = &patchType
+	}
+	return response
+}
+
+// applyPatch applies the patch of an admission response to the JSON object.
+func applyPatch(obj []byte, response *admissionv1.AdmissionResponse) ([]byte, error) {
+	return admissionreview.ApplyPatch(obj, response)
+}
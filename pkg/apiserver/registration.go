@@ -0,0 +1,396 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+// AdmissionHookWithValidatingWebhook can be implemented by validating admission hooks to be registered in the
+// ValidatingWebhookConfiguration written by the server, see RegistrationConfig.
+type AdmissionHookWithValidatingWebhook interface {
+	// ValidatingWebhook returns the webhook to register for the hook. Rules, failure policy, side effects, timeout,
+	// selectors and match conditions are taken as they are, except for the match fields declared by
+	// AdmissionHookWithMatchCriteria, which replace them. The client config is set to call the hook through the
+	// Kubernetes API server. The name defaults to <resource>.<group> of the validating resource, the side effects to
+	// None and the admission review versions to v1.
+	ValidatingWebhook() admissionregistrationv1.ValidatingWebhook
+}
+
+// AdmissionHookWithMutatingWebhook can be implemented by mutating admission hooks to be registered in the
+// MutatingWebhookConfiguration written by the server, see RegistrationConfig.
+type AdmissionHookWithMutatingWebhook interface {
+	// MutatingWebhook returns the webhook to register for the hook, completed like the one of
+	// AdmissionHookWithValidatingWebhook.
+	MutatingWebhook() admissionregistrationv1.MutatingWebhook
+}
+
+var apiServiceResource = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+
+const registrationFieldManager = "generic-admission-server"
+
+// RegistrationConfig configures the registration of the admission server: an APIService for every group version
+// served, and a ValidatingWebhookConfiguration and a MutatingWebhookConfiguration with the webhooks of the hooks
+// implementing AdmissionHookWithValidatingWebhook, AdmissionHookWithMutatingWebhook or
+// AdmissionHookWithMatchCriteria.
+type RegistrationConfig struct {
+	// Name is the name of the webhook configurations.
+	Name string
+
+	// ServiceNamespace, ServiceName and ServicePort identify the Service of the admission server, which the
+	// APIServices point to.
+	ServiceNamespace string
+	ServiceName      string
+	ServicePort      int32
+
+	GroupPriorityMinimum int32
+	VersionPriority      int32
+
+	// APIServiceCA verifies the serving certificates of all replicas of the admission server. Its CA bundle is
+	// written to the APIServices, and the serving certificate of the server must be verified by it for the server
+	// to register. Providers that can be run, like dynamiccertificates.DynamicFileCAContent, are re-read on every
+	// resync and watched, so that a rotated CA is written again. If nil, the CA bundle of the APIServices is left
+	// out, e.g. to be injected by the service CA.
+	APIServiceCA dynamiccertificates.CAContentProvider
+
+	// WebhookCABundle verifies the Kubernetes API server, which the webhooks call to reach the admission server. It
+	// defaults to the CA of the client config of the server.
+	WebhookCABundle []byte
+
+	// ResyncPeriod is the period in which the objects are written again. Changes of the serving certificate are
+	// verified right away if the certificate provider notifies about them.
+	ResyncPeriod time.Duration
+}
+
+// RegistrationObjects are the objects registering an admission server.
+type RegistrationObjects struct {
+	APIServices []*unstructured.Unstructured
+	// ValidatingWebhookConfiguration is nil if no hook declares a validating webhook.
+	ValidatingWebhookConfiguration *admissionregistrationv1.ValidatingWebhookConfiguration
+	// MutatingWebhookConfiguration is nil if no hook declares a mutating webhook.
+	MutatingWebhookConfiguration *admissionregistrationv1.MutatingWebhookConfiguration
+}
+
+// BuildRegistrationObjects returns the objects registering the given admission hooks. apiServiceCABundle verifies
+// the serving certificate of the admission server. The CA bundles are left out if empty, e.g. to be injected.
+func BuildRegistrationObjects(config RegistrationConfig, apiServiceCABundle []byte, admissionHooks ...AdmissionHook) *RegistrationObjects {
+	objects := &RegistrationObjects{}
+
+	var groupVersions []schema.GroupVersion
+	for group, versions := range admissionHooksByGroupThenVersion(admissionHooks...) {
+		for version := range versions {
+			groupVersions = append(groupVersions, schema.GroupVersion{Group: group, Version: version})
+		}
+	}
+	sort.Slice(groupVersions, func(i, j int) bool { return groupVersions[i].String() < groupVersions[j].String() })
+	for _, gv := range groupVersions {
+		objects.APIServices = append(objects.APIServices, apiService(config, gv, apiServiceCABundle))
+	}
+
+	var validating []admissionregistrationv1.ValidatingWebhook
+	var mutating []admissionregistrationv1.MutatingWebhook
+	for _, hook := range admissionHooks {
+		criteria, hasCriteria := hookAs[AdmissionHookWithMatchCriteria](hook)
+		if h, ok := hook.(ValidatingAdmissionHook); ok {
+			w, hasWebhook := hookAs[AdmissionHookWithValidatingWebhook](hook)
+			if hasWebhook || hasCriteria {
+				var webhook admissionregistrationv1.ValidatingWebhook
+				if hasWebhook {
+					webhook = w.ValidatingWebhook()
+				}
+				if hasCriteria {
+					criteria.MatchCriteria().applyToValidatingWebhook(&webhook)
+				}
+				gvr, _ := h.ValidatingResource()
+				validating = append(validating, validatingWebhook(webhook, gvr, config.WebhookCABundle))
+			}
+		}
+		if h, ok := hook.(MutatingAdmissionHook); ok {
+			w, hasWebhook := hookAs[AdmissionHookWithMutatingWebhook](hook)
+			if hasWebhook || hasCriteria {
+				var webhook admissionregistrationv1.MutatingWebhook
+				if hasWebhook {
+					webhook = w.MutatingWebhook()
+				}
+				if hasCriteria {
+					criteria.MatchCriteria().applyToMutatingWebhook(&webhook)
+				}
+				gvr, _ := h.MutatingResource()
+				mutating = append(mutating, mutatingWebhook(webhook, gvr, config.WebhookCABundle))
+			}
+		}
+	}
+
+	if len(validating) > 0 {
+		objects.ValidatingWebhookConfiguration = &admissionregistrationv1.ValidatingWebhookConfiguration{
+			TypeMeta:   metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "ValidatingWebhookConfiguration"},
+			ObjectMeta: metav1.ObjectMeta{Name: config.Name},
+			Webhooks:   validating,
+		}
+	}
+	if len(mutating) > 0 {
+		objects.MutatingWebhookConfiguration = &admissionregistrationv1.MutatingWebhookConfiguration{
+			TypeMeta:   metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "MutatingWebhookConfiguration"},
+			ObjectMeta: metav1.ObjectMeta{Name: config.Name},
+			Webhooks:   mutating,
+		}
+	}
+	return objects
+}
+
+func apiService(config RegistrationConfig, gv schema.GroupVersion, caBundle []byte) *unstructured.Unstructured {
+	service := map[string]interface{}{
+		"namespace": config.ServiceNamespace,
+		"name":      config.ServiceName,
+	}
+	if config.ServicePort != 0 {
+		service["port"] = int64(config.ServicePort)
+	}
+	spec := map[string]interface{}{
+		"group":                gv.Group,
+		"version":              gv.Version,
+		"service":              service,
+		"groupPriorityMinimum": int64(config.GroupPriorityMinimum),
+		"versionPriority":      int64(config.VersionPriority),
+	}
+	if len(caBundle) > 0 {
+		spec["caBundle"] = base64.StdEncoding.EncodeToString(caBundle)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiServiceResource.GroupVersion().String(),
+		"kind":       "APIService",
+		"metadata":   map[string]interface{}{"name": gv.Version + "." + gv.Group},
+		"spec":       spec,
+	}}
+}
+
+// webhookClientConfig returns the client config calling the hook served on the given resource through the Kubernetes
+// API server.
+func webhookClientConfig(gvr schema.GroupVersionResource, caBundle []byte) admissionregistrationv1.WebhookClientConfig {
+	path := "/apis/" + gvr.Group + "/" + gvr.Version + "/" + gvr.Resource
+	return admissionregistrationv1.WebhookClientConfig{
+		Service:  &admissionregistrationv1.ServiceReference{Namespace: metav1.NamespaceDefault, Name: "kubernetes", Path: &path},
+		CABundle: caBundle,
+	}
+}
+
+func validatingWebhook(webhook admissionregistrationv1.ValidatingWebhook, gvr schema.GroupVersionResource, caBundle []byte) admissionregistrationv1.ValidatingWebhook {
+	if len(webhook.Name) == 0 {
+		webhook.Name = gvr.GroupResource().String()
+	}
+	webhook.ClientConfig = webhookClientConfig(gvr, caBundle)
+	if webhook.SideEffects == nil {
+		none := admissionregistrationv1.SideEffectClassNone
+		webhook.SideEffects = &none
+	}
+	if len(webhook.AdmissionReviewVersions) == 0 {
+		webhook.AdmissionReviewVersions = []string{admissionregistrationv1.SchemeGroupVersion.Version}
+	}
+	return webhook
+}
+
+func mutatingWebhook(webhook admissionregistrationv1.MutatingWebhook, gvr schema.GroupVersionResource, caBundle []byte) admissionregistrationv1.MutatingWebhook {
+	if len(webhook.Name) == 0 {
+		webhook.Name = gvr.GroupResource().String()
+	}
+	webhook.ClientConfig = webhookClientConfig(gvr, caBundle)
+	if webhook.SideEffects == nil {
+		none := admissionregistrationv1.SideEffectClassNone
+		webhook.SideEffects = &none
+	}
+	if len(webhook.AdmissionReviewVersions) == 0 {
+		webhook.AdmissionReviewVersions = []string{admissionregistrationv1.SchemeGroupVersion.Version}
+	}
+	return webhook
+}
+
+// clientCABundle returns the CA the client config verifies the Kubernetes API server with.
+func clientCABundle(config *restclient.Config) ([]byte, error) {
+	if len(config.TLSClientConfig.CAData) > 0 {
+		return config.TLSClientConfig.CAData, nil
+	}
+	if len(config.TLSClientConfig.CAFile) > 0 {
+		return os.ReadFile(config.TLSClientConfig.CAFile)
+	}
+	return nil, nil
+}
+
+// registrar writes the registration objects of the admission hooks. The CA bundle of the APIServices is the configured
+// one shared by all replicas, never the serving certificate of a single replica, since every replica applies the same
+// APIServices and the last one would win.
+type registrar struct {
+	config         RegistrationConfig
+	admissionHooks []AdmissionHook
+	servingCert    dynamiccertificates.CertKeyContentProvider
+
+	client        kubernetes.Interface
+	dynamicClient dynamic.Interface
+
+	changed chan struct{}
+}
+
+func newRegistrar(config RegistrationConfig, restConfig *restclient.Config, servingCert dynamiccertificates.CertKeyContentProvider, admissionHooks ...AdmissionHook) (*registrar, error) {
+	if config.WebhookCABundle == nil {
+		caBundle, err := clientCABundle(restConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA of the Kubernetes API server: %w", err)
+		}
+		config.WebhookCABundle = caBundle
+	}
+	if config.ResyncPeriod <= 0 {
+		config.ResyncPeriod = 10 * time.Minute
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &registrar{
+		config:         config,
+		admissionHooks: admissionHooks,
+		servingCert:    servingCert,
+		client:         client,
+		dynamicClient:  dynamicClient,
+		changed:        make(chan struct{}, 1),
+	}
+	if notifier, ok := servingCert.(dynamiccertificates.Notifier); ok {
+		notifier.AddListener(r)
+	}
+	if notifier, ok := config.APIServiceCA.(dynamiccertificates.Notifier); ok {
+		notifier.AddListener(r)
+	}
+	return r, nil
+}
+
+// Enqueue is called by the serving certificate and APIService CA providers when their content changes.
+func (r *registrar) Enqueue() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+// run writes the registration objects until the context is done. Failures are retried.
+func (r *registrar) run(ctx context.Context) {
+	if runner, ok := r.config.APIServiceCA.(dynamiccertificates.ControllerRunner); ok {
+		go runner.Run(ctx, 1)
+	}
+	for {
+		next := r.config.ResyncPeriod
+		if err := r.register(ctx); err != nil {
+			klog.ErrorS(err, "Failed to register admission hooks")
+			next = 10 * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.changed:
+		case <-time.After(next):
+		}
+	}
+}
+
+// register applies the registration objects with server-side apply, so that fields defaulted or set by others are
+// left alone. Nothing is applied if the serving certificate is not verified by the configured APIService CA bundle,
+// e.g. because it was self-generated by this replica.
+func (r *registrar) register(ctx context.Context) error {
+	caBundle, err := r.apiServiceCABundle(ctx)
+	if err != nil {
+		return err
+	}
+	if err := r.verifyServingCert(caBundle); err != nil {
+		return err
+	}
+	objects := BuildRegistrationObjects(r.config, caBundle, r.admissionHooks...)
+	options := metav1.PatchOptions{FieldManager: registrationFieldManager, Force: ptr.To(true)}
+
+	var errs []error
+	for _, apiService := range objects.APIServices {
+		if _, err := r.dynamicClient.Resource(apiServiceResource).Apply(ctx, apiService.GetName(), apiService, metav1.ApplyOptions{FieldManager: registrationFieldManager, Force: true}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to apply APIService %s: %w", apiService.GetName(), err))
+		}
+	}
+	if config := objects.ValidatingWebhookConfiguration; config != nil {
+		data, err := json.Marshal(config)
+		if err == nil {
+			_, err = r.client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Patch(ctx, config.Name, types.ApplyPatchType, data, options)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to apply ValidatingWebhookConfiguration %s: %w", config.Name, err))
+		}
+	}
+	if config := objects.MutatingWebhookConfiguration; config != nil {
+		data, err := json.Marshal(config)
+		if err == nil {
+			_, err = r.client.AdmissionregistrationV1().MutatingWebhookConfigurations().Patch(ctx, config.Name, types.ApplyPatchType, data, options)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to apply MutatingWebhookConfiguration %s: %w", config.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// apiServiceCABundle re-reads the APIService CA, if its provider can be run, and returns its current content.
+func (r *registrar) apiServiceCABundle(ctx context.Context) ([]byte, error) {
+	if r.config.APIServiceCA == nil {
+		return nil, nil
+	}
+	if runner, ok := r.config.APIServiceCA.(dynamiccertificates.ControllerRunner); ok {
+		if err := runner.RunOnce(ctx); err != nil {
+			return nil, fmt.Errorf("failed to read the APIService CA bundle: %w", err)
+		}
+	}
+	return r.config.APIServiceCA.CurrentCABundleContent(), nil
+}
+
+// verifyServingCert returns an error if the serving certificate is not verified by the APIService CA bundle.
+func (r *registrar) verifyServingCert(caBundle []byte) error {
+	if len(caBundle) == 0 || r.servingCert == nil {
+		return nil
+	}
+	roots, err := certutil.NewPoolFromBytes(caBundle)
+	if err != nil {
+		return fmt.Errorf("failed to parse the APIService CA bundle: %w", err)
+	}
+	certPEM, _ := r.servingCert.CurrentCertKeyContent()
+	certs, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse the serving certificate: %w", err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("serving certificate %q is not verified by the APIService CA bundle, refusing to register: %w", r.servingCert.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+)
+
+type testRegisteredWebhook struct {
+	testWebhook
+}
+
+func (*testRegisteredWebhook) ValidatingWebhook() admissionregistrationv1.ValidatingWebhook {
+	fail := admissionregistrationv1.Fail
+	return admissionregistrationv1.ValidatingWebhook{
+		Rules: []admissionregistrationv1.RuleWithOperations{{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+			Rule:       admissionregistrationv1.Rule{APIGroups: []string{""}, APIVersions: []string{"v1"}, Resources: []string{"namespaces"}},
+		}},
+		FailurePolicy: &fail,
+	}
+}
+
+func TestBuildRegistrationObjects(t *testing.T) {
+	config := RegistrationConfig{
+		Name:                 "test",
+		ServiceNamespace:     "ns",
+		ServiceName:          "admission",
+		ServicePort:          443,
+		GroupPriorityMinimum: 1000,
+		VersionPriority:      15,
+		WebhookCABundle:      []byte("kube-ca"),
+	}
+	objects := BuildRegistrationObjects(config, []byte("serving-ca"), &testRegisteredWebhook{}, &testWebhookV1{})
+
+	if len(objects.APIServices) != 1 {
+		t.Fatalf("expected one APIService, got %d", len(objects.APIServices))
+	}
+	apiService := objects.APIServices[0]
+	if apiService.GetName() != "v1.admission.openshift.io" {
+		t.Errorf("unexpected APIService name %q", apiService.GetName())
+	}
+	for field, want := range map[string]interface{}{
+		"group":    "admission.openshift.io",
+		"version":  "v1",
+		"caBundle": base64.StdEncoding.EncodeToString([]byte("serving-ca")),
+	} {
+		if got, _, _ := unstructured.NestedFieldNoCopy(apiService.Object, "spec", field); got != want {
+			t.Errorf("expected spec.%s %v, got %v", field, want, got)
+		}
+	}
+	if got, _, _ := unstructured.NestedString(apiService.Object, "spec", "service", "name"); got != "admission" {
+		t.Errorf("expected spec.service.name admission, got %q", got)
+	}
+
+	if objects.MutatingWebhookConfiguration != nil {
+		t.Errorf("expected no mutating webhook configuration without declared mutating webhooks")
+	}
+	validating := objects.ValidatingWebhookConfiguration
+	if validating == nil || validating.Name != "test" || len(validating.Webhooks) != 1 {
+		t.Fatalf("expected a validating webhook configuration test with one webhook, got %#v", validating)
+	}
+	webhook := validating.Webhooks[0]
+	if webhook.Name != "testvalidators.admission.openshift.io" {
+		t.Errorf("unexpected webhook name %q", webhook.Name)
+	}
+	wantPath := "/apis/admission.openshift.io/v1/testvalidators"
+	if s := webhook.ClientConfig.Service; s == nil || s.Namespace != "default" || s.Name != "kubernetes" || s.Path == nil || *s.Path != wantPath {
+		t.Errorf("expected the webhook to call %s of the kubernetes service, got %#v", wantPath, s)
+	}
+	if string(webhook.ClientConfig.CABundle) != "kube-ca" {
+		t.Errorf("expected the webhook CA bundle, got %q", webhook.ClientConfig.CABundle)
+	}
+	if webhook.SideEffects == nil || *webhook.SideEffects != admissionregistrationv1.SideEffectClassNone {
+		t.Errorf("expected side effects to default to None")
+	}
+	if !reflect.DeepEqual(webhook.AdmissionReviewVersions, []string{"v1"}) {
+		t.Errorf("expected admission review versions to default to v1, got %v", webhook.AdmissionReviewVersions)
+	}
+	if webhook.FailurePolicy == nil || *webhook.FailurePolicy != admissionregistrationv1.Fail || len(webhook.Rules) != 1 {
+		t.Errorf("expected the declared failure policy and rules to be kept")
+	}
+}
+
+// testCert returns a certificate and its key, signed by the given parent or self-signed if parent is nil.
+func testCert(t *testing.T, commonName string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{commonName},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func testServingCert(t *testing.T, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) dynamiccertificates.CertKeyContentProvider {
+	t.Helper()
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := certutil.EncodeCertificates(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := dynamiccertificates.NewStaticCertKeyContent(name, certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestRegistrarReplicas(t *testing.T) {
+	ca, caKey := testCert(t, "shared-ca", true, nil, nil)
+	caBundle, err := certutil.EncodeCertificates(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicaA, replicaAKey := testCert(t, "admission.ns.svc", false, ca, caKey)
+	replicaB, replicaBKey := testCert(t, "admission.ns.svc", false, ca, caKey)
+	selfSigned, selfSignedKey := testCert(t, "admission.ns.svc", false, nil, nil)
+	apiServiceCA, err := dynamiccertificates.NewStaticCAContent("shared-ca", caBundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	var appliedCABundles []string
+	dynamicClient.PrependReactor("patch", "apiservices", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		apiService := &unstructured.Unstructured{}
+		if err := json.Unmarshal(action.(clienttesting.PatchAction).GetPatch(), &apiService.Object); err != nil {
+			return true, nil, err
+		}
+		caBundle, _, _ := unstructured.NestedString(apiService.Object, "spec", "caBundle")
+		appliedCABundles = append(appliedCABundles, caBundle)
+		return true, apiService, nil
+	})
+	newTestRegistrar := func(servingCert dynamiccertificates.CertKeyContentProvider) *registrar {
+		return &registrar{
+			config:         RegistrationConfig{Name: "test", ServiceNamespace: "ns", ServiceName: "admission", APIServiceCA: apiServiceCA},
+			admissionHooks: []AdmissionHook{&testWebhookV1{}},
+			servingCert:    servingCert,
+			client:         fake.NewClientset(),
+			dynamicClient:  dynamicClient,
+		}
+	}
+
+	for _, r := range []*registrar{
+		newTestRegistrar(testServingCert(t, "replica-a", replicaA, replicaAKey)),
+		newTestRegistrar(testServingCert(t, "replica-b", replicaB, replicaBKey)),
+		newTestRegistrar(testServingCert(t, "replica-a", replicaA, replicaAKey)),
+	} {
+		if err := r.register(context.Background()); err != nil {
+			t.Fatalf("unexpected error registering: %v", err)
+		}
+	}
+	wantCABundle := base64.StdEncoding.EncodeToString(caBundle)
+	if len(appliedCABundles) != 3 {
+		t.Fatalf("expected every replica to apply the APIService, got %d applies", len(appliedCABundles))
+	}
+	for i, got := range appliedCABundles {
+		if got != wantCABundle {
+			t.Errorf("expected apply %d to write the shared CA bundle, got %q", i, got)
+		}
+	}
+
+	if err := newTestRegistrar(testServingCert(t, "self-signed", selfSigned, selfSignedKey)).register(context.Background()); err == nil {
+		t.Errorf("expected a replica with a self-signed serving certificate to refuse to register")
+	}
+	if len(appliedCABundles) != 3 {
+		t.Errorf("expected a replica with a self-signed serving certificate not to apply the APIService")
+	}
+}
+
+func TestRegistrarAPIServiceCARotation(t *testing.T) {
+	encode := func(cn string) []byte {
+		ca, _ := testCert(t, cn, true, nil, nil)
+		caBundle, err := certutil.EncodeCertificates(ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return caBundle
+	}
+	oldCABundle, newCABundle := encode("old-ca"), encode("new-ca")
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, oldCABundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	apiServiceCA, err := dynamiccertificates.NewDynamicCAContentFromFile("apiservice-ca", caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	var appliedCABundles []string
+	dynamicClient.PrependReactor("patch", "apiservices", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		apiService := &unstructured.Unstructured{}
+		if err := json.Unmarshal(action.(clienttesting.PatchAction).GetPatch(), &apiService.Object); err != nil {
+			return true, nil, err
+		}
+		caBundle, _, _ := unstructured.NestedString(apiService.Object, "spec", "caBundle")
+		appliedCABundles = append(appliedCABundles, caBundle)
+		return true, apiService, nil
+	})
+	r := &registrar{
+		config:         RegistrationConfig{Name: "test", ServiceNamespace: "ns", ServiceName: "admission", APIServiceCA: apiServiceCA},
+		admissionHooks: []AdmissionHook{&testWebhookV1{}},
+		client:         fake.NewClientset(),
+		dynamicClient:  dynamicClient,
+	}
+
+	if err := r.register(context.Background()); err != nil {
+		t.Fatalf("unexpected error registering: %v", err)
+	}
+	if err := os.WriteFile(caFile, newCABundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.register(context.Background()); err != nil {
+		t.Fatalf("unexpected error registering: %v", err)
+	}
+
+	want := []string{base64.StdEncoding.EncodeToString(oldCABundle), base64.StdEncoding.EncodeToString(newCABundle)}
+	if !reflect.DeepEqual(appliedCABundles, want) {
+		t.Errorf("expected the rewritten CA file to be applied on the next resync, got %q", appliedCABundles)
+	}
+}
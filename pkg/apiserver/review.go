@@ -0,0 +1,125 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// Reviewer runs AdmissionReviews through admission hooks in process, the same way the server does, but without
+// serving, authentication or authorization.
+type Reviewer struct {
+	storages map[schema.GroupVersionResource]*admissionreview.V1REST
+}
+
+// NewReviewer returns a Reviewer for the given admission hooks. The hooks are not initialized. Requests not matching
+// the criteria of a hook are allowed without calling it, but namespace selectors are not evaluated.
+func NewReviewer(admissionHooks ...AdmissionHook) (*Reviewer, error) {
+	if err := ValidateAdmissionHooks(admissionHooks...); err != nil {
+		return nil, err
+	}
+	r := &Reviewer{storages: map[schema.GroupVersionResource]*admissionreview.V1REST{}}
+	for _, versions := range admissionHooksByGroupThenVersion(admissionHooks...) {
+		for _, wrappers := range versions {
+			for _, wrapper := range wrappers {
+				resource, _ := wrapper.Resource()
+				storage, err := getAdmissionRest(wrapper, &ExtraConfig{}, nil)
+				if err != nil {
+					return nil, err
+				}
+				r.storages[resource] = storage.(*admissionreview.V1REST)
+			}
+		}
+	}
+	return r, nil
+}
+
+// ReviewResult is the result of an AdmissionReview.
+type ReviewResult struct {
+	// Review is the review with the response of the hook, in v1.
+	Review *admissionv1.AdmissionReview
+	// PatchedObject is the object of the request with the patch of the response applied, if there is a patch.
+	PatchedObject []byte
+}
+
+// Review runs the review through the hook served on the given resource. The user of the request is passed on to
+// the hook in the context, like the authenticated user of a webhook call.
+func (r *Reviewer) Review(ctx context.Context, resource schema.GroupVersionResource, review *admissionv1.AdmissionReview) (*ReviewResult, error) {
+	storage, ok := r.storages[resource]
+	if !ok {
+		return nil, fmt.Errorf("no admission hook is served on %s", resourceName(resource))
+	}
+	if review.Request == nil {
+		return nil, fmt.Errorf("the AdmissionReview has no request")
+	}
+
+	in := review.DeepCopy()
+	in.APIVersion = admissionv1.SchemeGroupVersion.String()
+	in.Kind = "AdmissionReview"
+	in.Response = nil
+
+	out, err := storage.Create(withRequestUser(ctx, in.Request), in, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &ReviewResult{Review: out.(*admissionv1.AdmissionReview)}
+	if response := result.Review.Response; response != nil && len(response.Patch) > 0 {
+		result.PatchedObject, err = applyPatch(in.Request.Object.Raw, response)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Verify calls the hook served on the given resource with the request and returns the violations of the admission
+// protocol by its response, which the server fixes up or denies the request for depending on its conformance mode.
+func (r *Reviewer) Verify(ctx context.Context, resource schema.GroupVersionResource, request *admissionv1.AdmissionRequest) ([]admissionreview.Violation, error) {
+	storage, ok := r.storages[resource]
+	if !ok {
+		return nil, fmt.Errorf("no admission hook is served on %s", resourceName(resource))
+	}
+	if request == nil {
+		return nil, fmt.Errorf("no request to verify")
+	}
+	return storage.Verify(withRequestUser(ctx, request), request.DeepCopy()), nil
+}
+
+// Resources returns the resources the hooks are served on.
+func (r *Reviewer) Resources() []schema.GroupVersionResource {
+	resources := make([]schema.GroupVersionResource, 0, len(r.storages))
+	for resource := range r.storages {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resourceName(resources[i]) < resourceName(resources[j])
+	})
+	return resources
+}
+
+// withRequestUser returns the context with the user of the request, like the authenticated user of a webhook call.
+func withRequestUser(ctx context.Context, request *admissionv1.AdmissionRequest) context.Context {
+	userInfo := request.UserInfo
+	extra := map[string][]string{}
+	for k, v := range userInfo.Extra {
+		extra[k] = []string(v)
+	}
+	return genericapirequest.WithUser(ctx, &user.DefaultInfo{Name: userInfo.Username, UID: userInfo.UID, Groups: userInfo.Groups, Extra: extra})
+}
+
+// ParseResourcePath parses the path of an admission hook in the form /apis/<group>/<version>/<resource>.
+func ParseResourcePath(path string) (schema.GroupVersionResource, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "apis" || len(parts[1]) == 0 || len(parts[2]) == 0 || len(parts[3]) == 0 {
+		return schema.GroupVersionResource{}, fmt.Errorf("invalid admission hook path %q, must be of the form /apis/<group>/<version>/<resource>", path)
+	}
+	return schema.GroupVersionResource{Group: parts[1], Version: parts[2], Resource: parts[3]}, nil
+}
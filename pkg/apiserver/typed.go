@@ -0,0 +1,205 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// TypedValidatingHook is a validating admission hook for objects of type T. Use NewTypedValidatingHook to serve it.
+// Returned errors deny the request like those of ValidatingAdmissionHookV1WithError, returned warnings are passed on
+// in either case.
+type TypedValidatingHook[T runtime.Object] interface {
+	ValidatingAdmissionHook
+
+	// ValidateCreate is called for CREATE requests with the object to be created.
+	ValidateCreate(ctx context.Context, obj T) (warnings []string, err error)
+	// ValidateUpdate is called for UPDATE requests with the existing and the updated object.
+	ValidateUpdate(ctx context.Context, oldObj, obj T) (warnings []string, err error)
+	// ValidateDelete is called for DELETE requests with the object to be deleted.
+	ValidateDelete(ctx context.Context, oldObj T) (warnings []string, err error)
+}
+
+// NewTypedValidatingHook returns a v1 validating admission hook serving hook. Object and OldObject of the
+// admission requests are decoded with the given scheme, which must know the type T. Requests whose objects cannot
+// be decoded into T are denied as bad requests without calling hook, CONNECT requests are allowed.
+func NewTypedValidatingHook[T runtime.Object](scheme *runtime.Scheme, hook TypedValidatingHook[T]) ValidatingAdmissionHookV1WithError {
+	return &typedValidatingHook[T]{
+		hook:    hook,
+		decoder: newTypedDecoder[T](scheme),
+	}
+}
+
+type typedValidatingHook[T runtime.Object] struct {
+	hook    TypedValidatingHook[T]
+	decoder typedDecoder[T]
+}
+
+var _ wrappedAdmissionHook = &typedValidatingHook[runtime.Object]{}
+
+func (h *typedValidatingHook[T]) Initialize(kubeClientConfig *restclient.Config, stopCh <-chan struct{}) error {
+	return h.hook.Initialize(kubeClientConfig, stopCh)
+}
+
+func (h *typedValidatingHook[T]) ValidatingResource() (plural schema.GroupVersionResource, singular string) {
+	return h.hook.ValidatingResource()
+}
+
+func (h *typedValidatingHook[T]) unwrap() AdmissionHook {
+	return h.hook
+}
+
+func (h *typedValidatingHook[T]) Validate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	var warnings []string
+	var err error
+
+	switch admissionSpec.Operation {
+	case admissionv1.Create:
+		obj, decodeErr := h.decoder.decode("object", admissionSpec.Object)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		warnings, err = h.hook.ValidateCreate(ctx, obj)
+	case admissionv1.Update:
+		obj, decodeErr := h.decoder.decode("object", admissionSpec.Object)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		oldObj, decodeErr := h.decoder.decode("oldObject", admissionSpec.OldObject)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		warnings, err = h.hook.ValidateUpdate(ctx, oldObj, obj)
+	case admissionv1.Delete:
+		oldObj, decodeErr := h.decoder.decode("oldObject", admissionSpec.OldObject)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		warnings, err = h.hook.ValidateDelete(ctx, oldObj)
+	}
+
+	if err != nil {
+		return &admissionv1.AdmissionResponse{
+			Allowed:  false,
+			Result:   admissionreview.StatusForError(schema.GroupKind{Group: admissionSpec.Kind.Group, Kind: admissionSpec.Kind.Kind}, admissionSpec.Name, err),
+			Warnings: warnings,
+		}, nil
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true, Warnings: warnings}, nil
+}
+
+// TypedMutatingHook is a mutating admission hook for objects of type T. Use NewTypedMutatingHook to serve it.
+type TypedMutatingHook[T runtime.Object] interface {
+	MutatingAdmissionHook
+
+	// Mutate is called for CREATE and UPDATE requests with the object about to be persisted. It may change obj in
+	// place or return a modified copy, a nil return value stands for obj. Returned errors deny the request like those
+	// of MutatingAdmissionHookV1WithError.
+	Mutate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest, obj T) (T, error)
+}
+
+// NewTypedMutatingHook returns a v1 mutating admission hook serving hook. Object of the admission requests is
+// decoded with the given scheme, which must know the type T, and the JSONPatch from Object to the object returned
+// by hook is computed for the response. Fields of Object which T does not know are kept. No patch is returned if hook
+// did not change the object. Requests whose
+// object cannot be decoded into T are denied as bad requests without calling hook, DELETE and CONNECT requests are
+// allowed.
+func NewTypedMutatingHook[T runtime.Object](scheme *runtime.Scheme, hook TypedMutatingHook[T]) MutatingAdmissionHookV1WithError {
+	return &typedMutatingHook[T]{
+		hook:    hook,
+		decoder: newTypedDecoder[T](scheme),
+	}
+}
+
+type typedMutatingHook[T runtime.Object] struct {
+	hook    TypedMutatingHook[T]
+	decoder typedDecoder[T]
+}
+
+var _ wrappedAdmissionHook = &typedMutatingHook[runtime.Object]{}
+
+func (h *typedMutatingHook[T]) Initialize(kubeClientConfig *restclient.Config, stopCh <-chan struct{}) error {
+	return h.hook.Initialize(kubeClientConfig, stopCh)
+}
+
+func (h *typedMutatingHook[T]) MutatingResource() (plural schema.GroupVersionResource, singular string) {
+	return h.hook.MutatingResource()
+}
+
+func (h *typedMutatingHook[T]) unwrap() AdmissionHook {
+	return h.hook
+}
+
+func (h *typedMutatingHook[T]) Admit(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	if admissionSpec.Operation != admissionv1.Create && admissionSpec.Operation != admissionv1.Update {
+		return &admissionv1.AdmissionResponse{Allowed: true}, nil
+	}
+
+	obj, err := h.decoder.decode("object", admissionSpec.Object)
+	if err != nil {
+		return nil, err
+	}
+	// the object as we would have encoded it without changes, to tell whether the hook changed anything
+	original, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	mutated, err := h.hook.Mutate(ctx, admissionSpec, obj)
+	if err != nil {
+		return nil, err
+	}
+	if v := reflect.ValueOf(mutated); !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()) {
+		mutated = obj
+	}
+	mutatedJSON, err := json.Marshal(mutated)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(original, mutatedJSON) {
+		return &admissionv1.AdmissionResponse{Allowed: true}, nil
+	}
+
+	patch, err := createDecodedPatch(admissionSpec.Object.Raw, original, mutatedJSON)
+	if err != nil {
+		return nil, err
+	}
+	return patchResponse(patch), nil
+}
+
+// typedDecoder decodes the objects of admission requests into T.
+type typedDecoder[T runtime.Object] struct {
+	decoder runtime.Decoder
+}
+
+func newTypedDecoder[T runtime.Object](scheme *runtime.Scheme) typedDecoder[T] {
+	return typedDecoder[T]{decoder: serializer.NewCodecFactory(scheme).UniversalDeserializer()}
+}
+
+// decode returns the object in raw as T, or a BadRequest error naming the field of the admission request.
+func (d typedDecoder[T]) decode(fieldName string, raw runtime.RawExtension) (T, error) {
+	var zero T
+	if len(raw.Raw) == 0 {
+		return zero, apierrors.NewBadRequest(fmt.Sprintf("admission request has no %s", fieldName))
+	}
+	obj, _, err := d.decoder.Decode(raw.Raw, nil, nil)
+	if err != nil {
+		return zero, apierrors.NewBadRequest(fmt.Sprintf("unable to decode %s: %v", fieldName, err))
+	}
+	typed, ok := obj.(T)
+	if !ok {
+		return zero, apierrors.NewBadRequest(fmt.Sprintf("unable to decode %s: expected %T, got %T", fieldName, zero, obj))
+	}
+	return typed, nil
+}
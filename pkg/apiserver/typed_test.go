@@ -0,0 +1,314 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type testTypedValidator struct {
+	testWebhook
+}
+
+func (a *testTypedValidator) ValidateCreate(ctx context.Context, obj *corev1.ConfigMap) ([]string, error) {
+	if _, ok := obj.Data["forbidden"]; ok {
+		return []string{"create"}, errors.New("forbidden key")
+	}
+	return []string{"create"}, nil
+}
+
+func (a *testTypedValidator) ValidateUpdate(ctx context.Context, oldObj, obj *corev1.ConfigMap) ([]string, error) {
+	if oldObj.Data["immutable"] != obj.Data["immutable"] {
+		return nil, errors.New("immutable key changed")
+	}
+	return nil, nil
+}
+
+func (a *testTypedValidator) ValidateDelete(ctx context.Context, oldObj *corev1.ConfigMap) ([]string, error) {
+	if oldObj.Name == "keep" {
+		return nil, errors.New("cannot delete")
+	}
+	return nil, nil
+}
+
+func TestTypedValidatingHook(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, NewTypedValidatingHook[*corev1.ConfigMap](scheme, &testTypedValidator{}))
+	defer server.Close()
+
+	configMap := func(name string, data map[string]string) runtime.RawExtension {
+		return runtime.RawExtension{Object: &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Data:       data,
+		}}
+	}
+
+	cases := []struct {
+		name         string
+		request      *admissionv1.AdmissionRequest
+		wantAllowed  bool
+		wantCode     int32
+		wantWarnings int
+	}{
+		{
+			name:         "create allowed",
+			request:      &admissionv1.AdmissionRequest{Operation: admissionv1.Create, Object: configMap("a", nil)},
+			wantAllowed:  true,
+			wantWarnings: 1,
+		},
+		{
+			name:         "create denied",
+			request:      &admissionv1.AdmissionRequest{Operation: admissionv1.Create, Object: configMap("a", map[string]string{"forbidden": ""})},
+			wantCode:     http.StatusForbidden,
+			wantWarnings: 1,
+		},
+		{
+			name:        "update allowed",
+			request:     &admissionv1.AdmissionRequest{Operation: admissionv1.Update, Object: configMap("a", nil), OldObject: configMap("a", nil)},
+			wantAllowed: true,
+		},
+		{
+			name:     "update denied",
+			request:  &admissionv1.AdmissionRequest{Operation: admissionv1.Update, Object: configMap("a", nil), OldObject: configMap("a", map[string]string{"immutable": "x"})},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "delete denied",
+			request:  &admissionv1.AdmissionRequest{Operation: admissionv1.Delete, OldObject: configMap("keep", nil)},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "undecodable object",
+			request:  &admissionv1.AdmissionRequest{Operation: admissionv1.Create, Object: runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"Secret"}`)}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "missing object",
+			request:  &admissionv1.AdmissionRequest{Operation: admissionv1.Update, Object: configMap("a", nil)},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.request.Kind = metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+			response := postV1Review(t, server.URL+validatorPath, c.request)
+			if response == nil {
+				t.Fatalf("expect review response but get nil")
+			}
+			if response.Allowed != c.wantAllowed {
+				t.Errorf("expect allowed=%v, got %v", c.wantAllowed, response)
+			}
+			if !c.wantAllowed && (response.Result == nil || response.Result.Code != c.wantCode) {
+				t.Errorf("expect result code %d, got %v", c.wantCode, response.Result)
+			}
+			if len(response.Warnings) != c.wantWarnings {
+				t.Errorf("expect %d warnings, got %v", c.wantWarnings, response.Warnings)
+			}
+		})
+	}
+}
+
+type testTypedMutator struct {
+	testWebhook
+}
+
+func (a *testTypedMutator) Mutate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest, obj *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	switch obj.Name {
+	case "in-place":
+		obj.Labels = map[string]string{"mutated": "true"}
+		return nil, nil
+	case "copy":
+		obj = obj.DeepCopy()
+		obj.Data["added"] = "value"
+		return obj, nil
+	case "denied":
+		return nil, errors.New("denied")
+	}
+	return obj, nil
+}
+
+func TestTypedMutatingHook(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, NewTypedMutatingHook[*corev1.ConfigMap](scheme, &testTypedMutator{}))
+	defer server.Close()
+
+	cases := []struct {
+		name        string
+		operation   admissionv1.Operation
+		extraFields string
+		wantAllowed bool
+		wantObject  string
+	}{
+		{name: "in-place", operation: admissionv1.Create, wantAllowed: true, wantObject: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"in-place","labels":{"mutated":"true"}},"data":{"key":"value"}}`},
+		{name: "copy", operation: admissionv1.Update, wantAllowed: true, wantObject: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"copy"},"data":{"key":"value","added":"value"}}`},
+		{name: "in-place", operation: admissionv1.Update, extraFields: `,"futureField":"value"`, wantAllowed: true, wantObject: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"in-place","labels":{"mutated":"true"}},"data":{"key":"value"},"futureField":"value"}`},
+		{name: "unchanged", operation: admissionv1.Create, wantAllowed: true},
+		{name: "unchanged", operation: admissionv1.Update, extraFields: `,"futureField":"value"`, wantAllowed: true},
+		{name: "denied", operation: admissionv1.Create, wantAllowed: false},
+		{name: "denied", operation: admissionv1.Delete, wantAllowed: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name+"-"+string(c.operation), func(t *testing.T) {
+			raw := []byte(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"` + c.name + `"},"data":{"key":"value"}` + c.extraFields + `}`)
+			response := postV1Review(t, server.URL+mutatorPath, &admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+				Operation: c.operation,
+				Object:    runtime.RawExtension{Raw: raw},
+				OldObject: runtime.RawExtension{Raw: raw},
+			})
+			if response == nil {
+				t.Fatalf("expect review response but get nil")
+			}
+			if response.Allowed != c.wantAllowed {
+				t.Fatalf("expect allowed=%v, got %v", c.wantAllowed, response)
+			}
+			if len(c.wantObject) == 0 {
+				if len(response.Patch) != 0 || response.PatchType != nil {
+					t.Errorf("expect no patch, got %s", response.Patch)
+				}
+				return
+			}
+
+			if response.PatchType == nil || *response.PatchType != admissionv1.PatchTypeJSONPatch {
+				t.Errorf("expect patch type %q, got %v", admissionv1.PatchTypeJSONPatch, response.PatchType)
+			}
+			patch, err := jsonpatch.DecodePatch(response.Patch)
+			if err != nil {
+				t.Fatalf("unexpected error decoding patch %s: %v", response.Patch, err)
+			}
+			patched, err := patch.Apply(raw)
+			if err != nil {
+				t.Fatalf("unexpected error applying patch %s: %v", response.Patch, err)
+			}
+			var got, want map[string]interface{}
+			if err := json.Unmarshal(patched, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(c.wantObject), &want); err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("expect patched object %s, got %s", wantJSON, gotJSON)
+			}
+		})
+	}
+}
+
+type testTypedPodMutator struct {
+	testWebhook
+}
+
+func (a *testTypedPodMutator) Mutate(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest, obj *corev1.Pod) (*corev1.Pod, error) {
+	if obj.Name == "labeled" {
+		obj.Labels = map[string]string{"mutated": "true"}
+	}
+	return obj, nil
+}
+
+func TestTypedMutatingHookPatchesOnlyHookChanges(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, NewTypedMutatingHook[*corev1.Pod](scheme, &testTypedPodMutator{}))
+	defer server.Close()
+
+	cases := []struct {
+		name      string
+		wantPatch string
+	}{
+		{name: "unchanged"},
+		{name: "labeled", wantPatch: `[{"op":"add","path":"/metadata/labels","value":{"mutated":"true"}}]`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// decoding canonicalizes the quantity to "1" and adds metadata.creationTimestamp and status
+			raw := []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"` + c.name + `"},"spec":{"containers":[{"name":"c","image":"i","resources":{"requests":{"cpu":"1000m"}}}]}}`)
+			response := postV1Review(t, server.URL+mutatorPath, &admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			})
+			if response == nil {
+				t.Fatalf("expect review response but get nil")
+			}
+			if !response.Allowed {
+				t.Fatalf("expect allowed, got %v", response)
+			}
+			if string(response.Patch) != c.wantPatch {
+				t.Errorf("expect patch %s, got %s", c.wantPatch, response.Patch)
+			}
+		})
+	}
+}
+
+func TestCreateDecodedPatch(t *testing.T) {
+	cases := []struct {
+		name      string
+		raw       string
+		decoded   string
+		mutated   string
+		wantPatch string
+	}{
+		{
+			name:    "decoding changes only",
+			raw:     `{"metadata":{"name":"a"},"spec":{"cpu":"1000m"},"unknown":"value"}`,
+			decoded: `{"metadata":{"name":"a","creationTimestamp":null},"spec":{"cpu":"1"},"status":{}}`,
+			mutated: `{"metadata":{"name":"a","creationTimestamp":null},"spec":{"cpu":"1"},"status":{}}`,
+		},
+		{
+			name:      "replace of a field added by decoding",
+			raw:       `{"metadata":{"name":"a"}}`,
+			decoded:   `{"metadata":{"name":"a","creationTimestamp":null},"status":{}}`,
+			mutated:   `{"metadata":{"name":"a","creationTimestamp":null},"status":{"phase":"Pending"}}`,
+			wantPatch: `[{"op":"add","path":"/status","value":{"phase":"Pending"}}]`,
+		},
+		{
+			name:      "remove of a field",
+			raw:       `{"metadata":{"name":"a","labels":{"a":"b"}},"spec":{"cpu":"1000m"}}`,
+			decoded:   `{"metadata":{"name":"a","labels":{"a":"b"}},"spec":{"cpu":"1"}}`,
+			mutated:   `{"metadata":{"name":"a"},"spec":{"cpu":"1"}}`,
+			wantPatch: `[{"op":"remove","path":"/metadata/labels"}]`,
+		},
+		{
+			name:      "array element",
+			raw:       `{"items":[{"name":"a","unknown":"value"},{"name":"b"}]}`,
+			decoded:   `{"items":[{"name":"a"},{"name":"b"}]}`,
+			mutated:   `{"items":[{"name":"a"},{"name":"c"}]}`,
+			wantPatch: `[{"op":"replace","path":"/items/1/name","value":"c"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			patch, err := createDecodedPatch([]byte(c.raw), []byte(c.decoded), []byte(c.mutated))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(patch) != c.wantPatch {
+				t.Errorf("expect patch %s, got %s", c.wantPatch, patch)
+			}
+		})
+	}
+}
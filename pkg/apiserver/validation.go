@@ -0,0 +1,123 @@
+package apiserver
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// ValidateAdmissionHooks checks that the admission hooks can be served together: every validating or mutating hook
+// must implement one of the Validate or Admit variants, and every hook resource needs a group, a version and a
+// lowercase plural name. The resources must be unique, and so must be the singular names within a group version.
+// Match criteria must have valid selectors and match conditions which compile.
+func ValidateAdmissionHooks(admissionHooks ...AdmissionHook) error {
+	var errs []error
+	resources := map[schema.GroupVersionResource]string{}
+	names := map[schema.GroupVersion]map[string]string{}
+
+	register := func(description string, resource schema.GroupVersionResource, singular string) {
+		if len(resource.Group) == 0 {
+			errs = append(errs, fmt.Errorf("%s: group must not be empty", description))
+		} else if msgs := validation.IsDNS1123Subdomain(resource.Group); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("%s: invalid group %q: %s", description, resource.Group, strings.Join(msgs, ", ")))
+		}
+		if len(resource.Version) == 0 {
+			errs = append(errs, fmt.Errorf("%s: version must not be empty", description))
+		} else if msgs := validation.IsDNS1035Label(resource.Version); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("%s: invalid version %q: %s", description, resource.Version, strings.Join(msgs, ", ")))
+		}
+		if len(resource.Resource) == 0 {
+			errs = append(errs, fmt.Errorf("%s: resource must not be empty", description))
+		} else if strings.ToLower(resource.Resource) != resource.Resource {
+			errs = append(errs, fmt.Errorf("%s: resource %q must be lowercase", description, resource.Resource))
+		}
+		if strings.ToLower(singular) != singular {
+			errs = append(errs, fmt.Errorf("%s: singular name %q must be lowercase", description, singular))
+		}
+
+		if other, ok := resources[resource]; ok {
+			errs = append(errs, fmt.Errorf("%s: resource is already served by %s", description, other))
+			return
+		}
+		resources[resource] = description
+
+		// plural and singular names share one namespace per group version, like in discovery
+		gvNames, ok := names[resource.GroupVersion()]
+		if !ok {
+			gvNames = map[string]string{}
+			names[resource.GroupVersion()] = gvNames
+		}
+		if other, ok := gvNames[resource.Resource]; ok {
+			errs = append(errs, fmt.Errorf("%s: resource %q clashes with the singular name of %s", description, resource.Resource, other))
+		}
+		gvNames[resource.Resource] = description
+		if len(singular) > 0 && singular != resource.Resource {
+			if other, ok := gvNames[singular]; ok {
+				errs = append(errs, fmt.Errorf("%s: singular name %q clashes with %s", description, singular, other))
+			}
+			gvNames[singular] = description
+		}
+	}
+
+	for i, hook := range admissionHooks {
+		if mutatingHook, ok := hook.(MutatingAdmissionHook); ok {
+			resource, singular := mutatingHook.MutatingResource()
+			description := fmt.Sprintf("admission hook %d (%T) mutating %s", i, hook, resourceName(resource))
+			if _, ok := mutatingAdmission(hook); !ok {
+				errs = append(errs, fmt.Errorf("%s: no supported Admit method", description))
+			}
+			if _, err := hookMatcher(hook, admissionreview.HookTypeMutating, resourceName(resource)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid match criteria: %w", description, err))
+			}
+			register(description, resource, singular)
+		}
+		if validatingHook, ok := hook.(ValidatingAdmissionHook); ok {
+			resource, singular := validatingHook.ValidatingResource()
+			description := fmt.Sprintf("admission hook %d (%T) validating %s", i, hook, resourceName(resource))
+			if _, ok := validatingAdmission(hook); !ok {
+				errs = append(errs, fmt.Errorf("%s: no supported Validate method", description))
+			}
+			if _, err := hookMatcher(hook, admissionreview.HookTypeValidating, resourceName(resource)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid match criteria: %w", description, err))
+			}
+			register(description, resource, singular)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+func resourceName(gvr schema.GroupVersionResource) string {
+	return fmt.Sprintf("%s.%s.%s", gvr.Resource, gvr.Version, gvr.Group)
+}
+
+// validateEnforcementModes checks that enforcement modes are only set for resources served by the admission hooks.
+func validateEnforcementModes(modes map[schema.GroupVersionResource]admissionreview.EnforcementMode, admissionHooks ...AdmissionHook) error {
+	served := map[schema.GroupVersionResource]bool{}
+	for _, hook := range admissionHooks {
+		if h, ok := hook.(ValidatingAdmissionHook); ok {
+			gvr, _ := h.ValidatingResource()
+			served[gvr] = true
+		}
+		if h, ok := hook.(MutatingAdmissionHook); ok {
+			gvr, _ := h.MutatingResource()
+			served[gvr] = true
+		}
+	}
+
+	var errs []error
+	for gvr, mode := range modes {
+		if !served[gvr] {
+			errs = append(errs, fmt.Errorf("enforcement mode %q is set for %s, which is not served by any admission hook", mode, resourceName(gvr)))
+		}
+		if _, err := admissionreview.ParseEnforcementMode(string(mode)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", resourceName(gvr), err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
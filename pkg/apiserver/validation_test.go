@@ -0,0 +1,139 @@
+package apiserver
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+type testResourceHook struct {
+	testWebhookV1
+
+	validating, mutating schema.GroupVersionResource
+	singular             string
+}
+
+func (h *testResourceHook) ValidatingResource() (schema.GroupVersionResource, string) {
+	return h.validating, h.singular
+}
+
+func (h *testResourceHook) MutatingResource() (schema.GroupVersionResource, string) {
+	return h.mutating, h.singular + "mutation"
+}
+
+type testValidatingOnlyResourceHook struct {
+	testWebhook
+}
+
+func TestValidateAdmissionHooks(t *testing.T) {
+	gvr := func(group, version, resource string) schema.GroupVersionResource {
+		return schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+	}
+
+	cases := []struct {
+		name    string
+		hooks   []AdmissionHook
+		wantErr []string
+	}{
+		{
+			name:  "test webhooks",
+			hooks: []AdmissionHook{&testWebhookV1{}},
+		},
+		{
+			name: "distinct resources",
+			hooks: []AdmissionHook{
+				&testResourceHook{validating: gvr("a.io", "v1", "foos"), mutating: gvr("a.io", "v1", "bars"), singular: "foo"},
+				&testResourceHook{validating: gvr("a.io", "v2", "foos"), mutating: gvr("b.io", "v1", "bars"), singular: "foo"},
+			},
+		},
+		{
+			name:    "same resource for validation and mutation",
+			hooks:   []AdmissionHook{&testResourceHook{validating: gvr("a.io", "v1", "foos"), mutating: gvr("a.io", "v1", "foos")}},
+			wantErr: []string{"validating foos.v1.a.io: resource is already served by admission hook 0 (*apiserver.testResourceHook) mutating foos.v1.a.io"},
+		},
+		{
+			name: "duplicate resource",
+			hooks: []AdmissionHook{
+				&testResourceHook{validating: gvr("a.io", "v1", "foos"), mutating: gvr("a.io", "v1", "bars")},
+				&testResourceHook{validating: gvr("a.io", "v1", "foos"), mutating: gvr("a.io", "v1", "bazs")},
+			},
+			wantErr: []string{"admission hook 1 (*apiserver.testResourceHook) validating foos.v1.a.io: resource is already served by admission hook 0"},
+		},
+		{
+			name:  "invalid resources",
+			hooks: []AdmissionHook{&testResourceHook{validating: gvr("", "", "Foos"), mutating: gvr("a.io", "v1", "")}},
+			wantErr: []string{
+				"mutating .v1.a.io: resource must not be empty",
+				"group must not be empty",
+				"version must not be empty",
+				`resource "Foos" must be lowercase`,
+			},
+		},
+		{
+			name: "clashing singular names",
+			hooks: []AdmissionHook{
+				&testResourceHook{validating: gvr("a.io", "v1", "foos"), mutating: gvr("a.io", "v1", "bars"), singular: "foo"},
+				&testResourceHook{validating: gvr("a.io", "v1", "others"), mutating: gvr("a.io", "v1", "foomutations"), singular: "foo"},
+			},
+			wantErr: []string{
+				`mutating foomutations.v1.a.io: singular name "foomutation" clashes with admission hook 0`,
+				`validating others.v1.a.io: singular name "foo" clashes with admission hook 0`,
+			},
+		},
+		{
+			name:    "no validate method",
+			hooks:   []AdmissionHook{&testValidatingOnlyResourceHook{}},
+			wantErr: []string{"no supported Validate method"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateAdmissionHooks(c.hooks...)
+			if len(c.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			for _, want := range c.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateEnforcementModes(t *testing.T) {
+	hook := &testResourceHook{
+		validating: schema.GroupVersionResource{Group: "a.io", Version: "v1", Resource: "foos"},
+		mutating:   schema.GroupVersionResource{Group: "a.io", Version: "v1", Resource: "bars"},
+	}
+
+	if err := validateEnforcementModes(map[schema.GroupVersionResource]admissionreview.EnforcementMode{
+		hook.validating: admissionreview.EnforcementModeWarn,
+		hook.mutating:   admissionreview.EnforcementModeAudit,
+	}, hook); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := validateEnforcementModes(map[schema.GroupVersionResource]admissionreview.EnforcementMode{
+		{Group: "a.io", Version: "v2", Resource: "foos"}: admissionreview.EnforcementModeWarn,
+		hook.validating: "block",
+	}, hook)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, want := range []string{"foos.v2.a.io, which is not served by any admission hook", `foos.v1.a.io: unknown enforcement mode "block"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %v", want, err)
+		}
+	}
+}
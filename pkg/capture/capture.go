@@ -0,0 +1,173 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+// Capturer writes sampled AdmissionReviews with the responses of the hooks to a directory, as
+// <dir>/<resource.version.group>/<uid>.json of the hook resource. The files are v1 AdmissionReviews, which the review
+// command replays and compares against. A nil Capturer captures nothing.
+type Capturer struct {
+	dir        string
+	sampleRate float64
+	maxBytes   int64
+	redactor   *Redactor
+
+	lock  sync.Mutex
+	files []capturedFile
+	size  int64
+}
+
+type capturedFile struct {
+	path string
+	size int64
+}
+
+// Config configures a Capturer.
+type Config struct {
+	Dir string
+	// SampleRate is the fraction of reviews captured, between 0 and 1.
+	SampleRate float64
+	// MaxBytes bounds the size of all captured files. The oldest files are removed to stay within the bound. 0 means
+	// unbounded.
+	MaxBytes int64
+	// RedactionRules are applied to the objects and patches of the captured reviews.
+	RedactionRules []RedactionRule
+}
+
+// NewCapturer returns a Capturer writing to the directory of the config. Files already in the directory count
+// towards MaxBytes, oldest first.
+func NewCapturer(config Config) (*Capturer, error) {
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+	c := &Capturer{
+		dir:        config.Dir,
+		sampleRate: config.SampleRate,
+		maxBytes:   config.MaxBytes,
+		redactor:   NewRedactor(config.RedactionRules...),
+	}
+	if err := c.scan(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// scan collects the files already captured, oldest first.
+func (c *Capturer) scan() error {
+	type file struct {
+		capturedFile
+		modTime int64
+	}
+	var files []file
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, file{capturedFile{path: path, size: info.Size()}, info.ModTime().UnixNano()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime < files[j].modTime })
+	for _, f := range files {
+		c.files = append(c.files, f.capturedFile)
+		c.size += f.size
+	}
+	return nil
+}
+
+// Capture captures the review of the hook served on the given resource, if it is sampled. Failures are logged.
+func (c *Capturer) Capture(hook schema.GroupVersionResource, request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse) {
+	if c == nil || request == nil {
+		return
+	}
+	if c.sampleRate < 1 && rand.Float64() >= c.sampleRate {
+		return
+	}
+	if err := c.capture(hook, request, response); err != nil {
+		klog.ErrorS(err, "Failed to capture admission review", "hook", hook.String(), "uid", request.UID)
+	}
+}
+
+func (c *Capturer) capture(hook schema.GroupVersionResource, request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse) error {
+	review := &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request:  request.DeepCopy(),
+		Response: response.DeepCopy(),
+	}
+	if err := c.redactor.Redact(review); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(review, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	dir := filepath.Join(c.dir, hook.Resource+"."+hook.Version+"."+hook.Group)
+	path := filepath.Join(dir, fileName(string(request.UID))+".json")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// reinvoked requests have the same UID, the file of the earlier invocation is replaced
+	if i := slices.IndexFunc(c.files, func(f capturedFile) bool { return f.path == path }); i >= 0 {
+		c.size -= c.files[i].size
+		c.files = slices.Delete(c.files, i, i+1)
+	}
+	c.files = append(c.files, capturedFile{path: path, size: int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+	return nil
+}
+
+// evict removes the oldest files until the captured files fit into MaxBytes.
+func (c *Capturer) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	for c.size > c.maxBytes && len(c.files) > 0 {
+		oldest := c.files[0]
+		c.files = c.files[1:]
+		c.size -= oldest.size
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			klog.ErrorS(err, "Failed to remove captured admission review", "path", oldest.path)
+		}
+	}
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// fileName returns a file name for the request UID, which is sent by the caller and must not escape the directory.
+func fileName(uid string) string {
+	name := unsafeFileNameChars.ReplaceAllString(uid, "_")
+	if len(name) == 0 || name == "." || name == ".." {
+		return fmt.Sprintf("review-%d", rand.Int64())
+	}
+	return name
+}
@@ -0,0 +1,181 @@
+package capture
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var testHook = schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "checks"}
+
+func secretRequest(uid string) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:       types.UID(uid),
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Secret"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "secrets"},
+		Operation: admissionv1.Create,
+		Namespace: "ns",
+		Name:      "foo",
+		Object:    runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"foo","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"data\":{\"password\":\"c2VjcmV0\"}}"}},"data":{"password":"c2VjcmV0"},"type":"Opaque"}`)},
+	}
+}
+
+func readReview(t *testing.T, path string) *admissionv1.AdmissionReview {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(data, review); err != nil {
+		t.Fatal(err)
+	}
+	return review
+}
+
+func TestCapture(t *testing.T) {
+	dir := t.TempDir()
+	rules := []RedactionRule{}
+	for _, r := range DefaultRedactionRules() {
+		rule, err := ParseRedactionRule(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	capturer, err := NewCapturer(Config{Dir: dir, SampleRate: 1, RedactionRules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capturer.Capture(testHook, secretRequest("../uid"), &admissionv1.AdmissionResponse{
+		UID:     "../uid",
+		Allowed: true,
+		Patch:   []byte(`[{"op":"add","path":"/data/token","value":"dG9rZW4="},{"op":"add","path":"/metadata/labels","value":{"a":"b"}}]`),
+	})
+
+	path := filepath.Join(dir, "checks.v1.admission.example.com", ".._uid.json")
+	review := readReview(t, path)
+	if review.APIVersion != "admission.k8s.io/v1" || review.Kind != "AdmissionReview" {
+		t.Errorf("expected a v1 AdmissionReview, got %s %s", review.APIVersion, review.Kind)
+	}
+	if review.Request.UID != "../uid" || review.Response == nil || !review.Response.Allowed {
+		t.Errorf("expected the request and the response to be captured, got %#v", review)
+	}
+
+	object := string(review.Request.Object.Raw)
+	if strings.Contains(object, "c2VjcmV0") || !strings.Contains(object, `"password": "REDACTED"`) ||
+		!strings.Contains(object, `"kubectl.kubernetes.io/last-applied-configuration": "REDACTED"`) || !strings.Contains(object, `"type": "Opaque"`) {
+		t.Errorf("expected the secret data to be redacted, got %s", object)
+	}
+	patch := string(review.Response.Patch)
+	if strings.Contains(patch, "dG9rZW4=") || !strings.Contains(patch, `"value":{"a":"b"}`) {
+		t.Errorf("expected the patch of the secret data to be redacted, got %s", patch)
+	}
+}
+
+func TestRedactPatchAboveRedactedFields(t *testing.T) {
+	var rules []RedactionRule
+	for _, r := range DefaultRedactionRules() {
+		rule, err := ParseRedactionRule(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	review := &admissionv1.AdmissionReview{
+		Request: secretRequest("uid"),
+		Response: &admissionv1.AdmissionResponse{
+			UID:     "uid",
+			Allowed: true,
+			Patch: []byte(`[` +
+				`{"op":"replace","path":"","value":{"kind":"Secret","data":{"password":"c2VjcmV0"}}},` +
+				`{"op":"replace","path":"/","value":{"kind":"Secret","stringData":{"password":"secret"}}},` +
+				`{"op":"add","path":"/metadata","value":{"name":"foo","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"data\":{\"password\":\"c2VjcmV0\"}}"}}},` +
+				`{"op":"add","path":"/dat","value":{"password":"plain"}}` +
+				`]`),
+		},
+	}
+	if err := NewRedactor(rules...).Redact(review); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := string(review.Response.Patch)
+	for _, leaked := range []string{"c2VjcmV0", `"secret"`} {
+		if strings.Contains(patch, leaked) {
+			t.Errorf("expected the secret data replaced by an ancestor operation to be redacted, got %s", patch)
+		}
+	}
+	for _, kept := range []string{`"kind":"Secret"`, `"name":"foo"`, `"password":"plain"`} {
+		if !strings.Contains(patch, kept) {
+			t.Errorf("expected %s to be kept, got %s", kept, patch)
+		}
+	}
+}
+
+func TestCaptureRing(t *testing.T) {
+	dir := t.TempDir()
+	capturer, err := NewCapturer(Config{Dir: dir, SampleRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the captures of this test differ in size only by the length of their UIDs
+	capturer.Capture(testHook, secretRequest("uid-0"), &admissionv1.AdmissionResponse{Allowed: true})
+	size := capturer.size
+
+	capturer, err = NewCapturer(Config{Dir: dir, SampleRate: 1, MaxBytes: 2*size + 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capturer.size != size {
+		t.Fatalf("expected the existing capture to be counted, got %d bytes", capturer.size)
+	}
+	for _, uid := range []string{"uid-a", "uid-b"} {
+		capturer.Capture(testHook, secretRequest(uid), &admissionv1.AdmissionResponse{Allowed: true})
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "checks.v1.admission.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "uid-a.json,uid-b.json" {
+		t.Errorf("expected the oldest capture to be removed, got %v", names)
+	}
+
+	// a reinvocation replaces the capture of its request
+	capturer.Capture(testHook, secretRequest("uid-b"), &admissionv1.AdmissionResponse{Allowed: true})
+	if capturer.size != 2*size || len(capturer.files) != 2 {
+		t.Errorf("expected the replaced capture to be counted once, got %d bytes in %d files", capturer.size, len(capturer.files))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "checks.v1.admission.example.com", "uid-a.json")); err != nil {
+		t.Errorf("expected the other capture to be kept: %v", err)
+	}
+}
+
+func TestParseRedactionRule(t *testing.T) {
+	for s, want := range map[string]RedactionRule{
+		"/spec/password":                {Path: "/spec/password"},
+		"secrets:/data":                 {Resource: schema.GroupResource{Resource: "secrets"}, Path: "/data"},
+		"widgets.example.com:/spec/key": {Resource: schema.GroupResource{Group: "example.com", Resource: "widgets"}, Path: "/spec/key"},
+	} {
+		got, err := ParseRedactionRule(s)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %v, got %v (%v)", s, want, got, err)
+		}
+	}
+	if _, err := ParseRedactionRule("secrets:data"); err == nil {
+		t.Errorf("expected an error for a path without leading slash")
+	}
+}
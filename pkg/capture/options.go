@@ -0,0 +1,68 @@
+package capture
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// Options are the command line options of request capture.
+type Options struct {
+	Dir            string
+	SampleRate     float64
+	MaxBytes       int64
+	RedactionRules []string
+}
+
+// NewOptions returns the default options, which capture nothing.
+func NewOptions() *Options {
+	return &Options{
+		SampleRate:     0.01,
+		RedactionRules: DefaultRedactionRules(),
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+	fs.StringVar(&o.Dir, "capture-dir", o.Dir, "Capture sampled AdmissionReviews with the responses of the hooks to this directory, as <resource.version.group>/<uid>.json of the hook resource. The files can be replayed with the review command.")
+	fs.Float64Var(&o.SampleRate, "capture-sample-rate", o.SampleRate, "The fraction of AdmissionReviews captured, between 0 and 1.")
+	fs.Int64Var(&o.MaxBytes, "capture-max-bytes", o.MaxBytes, "The maximum size of all captured files in bytes. The oldest files are removed to stay within it. 0 means unbounded.")
+	fs.StringSliceVar(&o.RedactionRules, "capture-redact", o.RedactionRules, "Fields redacted from captured objects and patches, in the form [<resource>[.<group>]:]<JSON pointer>.")
+}
+
+func (o *Options) Validate() []error {
+	if o == nil || len(o.Dir) == 0 {
+		return nil
+	}
+	var errs []error
+	if o.SampleRate < 0 || o.SampleRate > 1 {
+		errs = append(errs, fmt.Errorf("--capture-sample-rate must be between 0 and 1, got %v", o.SampleRate))
+	}
+	if o.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("--capture-max-bytes must not be negative"))
+	}
+	for _, r := range o.RedactionRules {
+		if _, err := ParseRedactionRule(r); err != nil {
+			errs = append(errs, fmt.Errorf("--capture-redact: %w", err))
+		}
+	}
+	return errs
+}
+
+// NewCapturer returns the capturer configured by the options, or nil if nothing is captured.
+func (o *Options) NewCapturer() (*Capturer, error) {
+	if o == nil || len(o.Dir) == 0 {
+		return nil, nil
+	}
+	config := Config{Dir: o.Dir, SampleRate: o.SampleRate, MaxBytes: o.MaxBytes}
+	for _, r := range o.RedactionRules {
+		rule, err := ParseRedactionRule(r)
+		if err != nil {
+			return nil, err
+		}
+		config.RedactionRules = append(config.RedactionRules, rule)
+	}
+	return NewCapturer(config)
+}
@@ -0,0 +1,190 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// RedactedValue replaces redacted values. It is valid base64, so that redacted Secret data still decodes.
+const RedactedValue = "REDACTED"
+
+// RedactionRule redacts a field of the objects of a resource, and the values of patch operations on it.
+type RedactionRule struct {
+	// Resource is the resource whose objects the rule applies to. The empty resource matches all resources.
+	Resource schema.GroupResource
+	// Path is the JSON pointer of the redacted field, e.g. /data.
+	Path string
+}
+
+// ParseRedactionRule parses a rule of the form [<resource>[.<group>]:]<JSON pointer>, e.g. secrets:/data.
+func ParseRedactionRule(s string) (RedactionRule, error) {
+	rule := RedactionRule{Path: s}
+	if i := strings.Index(s, ":"); i >= 0 {
+		rule.Resource = schema.ParseGroupResource(s[:i])
+		rule.Path = s[i+1:]
+	}
+	if !strings.HasPrefix(rule.Path, "/") {
+		return RedactionRule{}, fmt.Errorf("invalid redaction rule %q, the path must be a JSON pointer starting with /", s)
+	}
+	return rule, nil
+}
+
+// DefaultRedactionRules redact the data of Secrets, including the copy kubectl apply keeps in an annotation.
+func DefaultRedactionRules() []string {
+	return []string{
+		"secrets:/data",
+		"secrets:/stringData",
+		"secrets:/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration",
+	}
+}
+
+// Redactor applies redaction rules to AdmissionReviews.
+type Redactor struct {
+	rules []RedactionRule
+}
+
+func NewRedactor(rules ...RedactionRule) *Redactor {
+	return &Redactor{rules: rules}
+}
+
+// Redact replaces the values of the redacted fields in the objects of the request with RedactedValue, and the values
+// of patch operations on, below or above them.
+func (r *Redactor) Redact(review *admissionv1.AdmissionReview) error {
+	if review.Request == nil {
+		return nil
+	}
+	resource := schema.GroupResource{Group: review.Request.Resource.Group, Resource: review.Request.Resource.Resource}
+	var paths []string
+	for _, rule := range r.rules {
+		if rule.Resource.Empty() || rule.Resource == resource {
+			paths = append(paths, rule.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	for _, raw := range []*[]byte{&review.Request.Object.Raw, &review.Request.OldObject.Raw} {
+		if len(*raw) == 0 {
+			continue
+		}
+		var obj interface{}
+		if err := json.Unmarshal(*raw, &obj); err != nil {
+			return fmt.Errorf("failed to redact object: %w", err)
+		}
+		for _, path := range paths {
+			obj = redactPath(obj, splitPointer(path))
+		}
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		*raw = data
+		review.Request.Object.Object = nil
+		review.Request.OldObject.Object = nil
+	}
+
+	if review.Response != nil && len(review.Response.Patch) > 0 {
+		var operations []map[string]interface{}
+		if err := json.Unmarshal(review.Response.Patch, &operations); err != nil {
+			// not a JSON patch, which is rejected by the API server anyway; drop it rather than leak it
+			review.Response.Patch = nil
+			return nil
+		}
+		for _, op := range operations {
+			value, ok := op["value"]
+			if !ok {
+				continue
+			}
+			opPath, _ := op["path"].(string)
+			opTokens := splitPointer(opPath)
+			for _, path := range paths {
+				pathTokens := splitPointer(path)
+				switch {
+				case hasTokenPrefix(opTokens, pathTokens):
+					// on or below the redacted field
+					value = redactValue(value)
+				case hasTokenPrefix(pathTokens, opTokens):
+					// above the redacted field, e.g. replacing the whole object
+					value = redactPath(value, pathTokens[len(opTokens):])
+				}
+			}
+			op["value"] = value
+		}
+		data, err := json.Marshal(operations)
+		if err != nil {
+			return err
+		}
+		review.Response.Patch = data
+	}
+	return nil
+}
+
+// splitPointer returns the unescaped tokens of a JSON pointer. The root is addressed by "" and, as patches of
+// whole objects commonly use it, by "/".
+func splitPointer(path string) []string {
+	if path == "" || path == "/" {
+		return nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens
+}
+
+// hasTokenPrefix returns whether the pointer tokens start with the prefix tokens.
+func hasTokenPrefix(tokens, prefix []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if tokens[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// redactPath redacts the value at the given path of obj, if it exists.
+func redactPath(obj interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return redactValue(obj)
+	}
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		if v, ok := o[path[0]]; ok {
+			o[path[0]] = redactPath(v, path[1:])
+		}
+	case []interface{}:
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(o) {
+			o[i] = redactPath(o[i], path[1:])
+		}
+	}
+	return obj
+}
+
+// redactValue replaces all scalar values in v with RedactedValue, keeping the structure of maps and lists.
+func redactValue(v interface{}) interface{} {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		for k := range o {
+			o[k] = redactValue(o[k])
+		}
+		return o
+	case []interface{}:
+		for i := range o {
+			o[i] = redactValue(o[i])
+		}
+		return o
+	case nil:
+		return nil
+	default:
+		return RedactedValue
+	}
+}
@@ -0,0 +1,150 @@
+package celadmission
+
+import (
+	"fmt"
+	"sync"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/mutating"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/mutating/patch"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
+	"k8s.io/apiserver/pkg/cel/environment"
+)
+
+var (
+	baseEnvSetOnce sync.Once
+	baseEnvSet     *environment.EnvSet
+)
+
+// compositionEnvSet returns the CEL environment of the admission plugins of the API server version this server is
+// built with.
+func compositionEnvSet() *environment.EnvSet {
+	baseEnvSetOnce.Do(func() {
+		baseEnvSet = environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion())
+	})
+	return baseEnvSet
+}
+
+// compileValidatingPolicy compiles the validations, match conditions, audit annotations and variables of the policy
+// like the ValidatingAdmissionPolicy plugin of the API server does. The authorizer variable is not declared, as
+// there is no authorizer to evaluate it with. The returned error aggregates all compilation errors, in which case
+// the validator denies or admits every request according to the failure policy.
+func compileValidatingPolicy(policy *admissionregistrationv1.ValidatingAdmissionPolicy) (validating.Validator, error) {
+	optionalVars := cel.OptionalVariableDeclarations{HasParams: policy.Spec.ParamKind != nil}
+	failurePolicy := policy.Spec.FailurePolicy
+
+	compiler, err := cel.NewCompositedCompiler(compositionEnvSet())
+	if err != nil {
+		return validating.NewValidator(nil, nil, nil, nil, failurePolicy, err), err
+	}
+	var errs []error
+	for i, variable := range policy.Spec.Variables {
+		result := compiler.CompileAndStoreVariable(&validating.Variable{Name: variable.Name, Expression: variable.Expression}, optionalVars, environment.StoredExpressions)
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("variables[%d].expression: %s", i, result.Error.Detail))
+		}
+	}
+
+	var matcher matchconditions.Matcher
+	if conditions := policy.Spec.MatchConditions; len(conditions) > 0 {
+		accessors := make([]cel.ExpressionAccessor, len(conditions))
+		for i := range conditions {
+			accessors[i] = (*matchconditions.MatchCondition)(&conditions[i])
+		}
+		evaluator := compiler.CompileCondition(accessors, optionalVars, environment.StoredExpressions)
+		errs = append(errs, compilationErrors(compiler, "matchConditions", "expression", accessors, optionalVars)...)
+		matcher = matchconditions.NewMatcher(evaluator, failurePolicy, "policy", "validate", policy.Name)
+	}
+
+	validations := make([]cel.ExpressionAccessor, len(policy.Spec.Validations))
+	messageExpressions := make([]cel.ExpressionAccessor, len(policy.Spec.Validations))
+	for i, validation := range policy.Spec.Validations {
+		validations[i] = &validating.ValidationCondition{Expression: validation.Expression, Message: validation.Message, Reason: validation.Reason}
+		if len(validation.MessageExpression) > 0 {
+			messageExpressions[i] = &validating.MessageExpressionCondition{MessageExpression: validation.MessageExpression}
+		}
+	}
+	auditAnnotations := make([]cel.ExpressionAccessor, len(policy.Spec.AuditAnnotations))
+	for i, annotation := range policy.Spec.AuditAnnotations {
+		auditAnnotations[i] = &validating.AuditAnnotationCondition{Key: annotation.Key, ValueExpression: annotation.ValueExpression}
+	}
+
+	validationEvaluator := compiler.CompileCondition(validations, optionalVars, environment.StoredExpressions)
+	messageEvaluator := compiler.CompileCondition(messageExpressions, optionalVars, environment.StoredExpressions)
+	auditAnnotationEvaluator := compiler.CompileCondition(auditAnnotations, optionalVars, environment.StoredExpressions)
+	errs = append(errs, compilationErrors(compiler, "validations", "expression", validations, optionalVars)...)
+	errs = append(errs, compilationErrors(compiler, "validations", "messageExpression", messageExpressions, optionalVars)...)
+	errs = append(errs, compilationErrors(compiler, "auditAnnotations", "valueExpression", auditAnnotations, optionalVars)...)
+
+	validator := validating.NewValidator(validationEvaluator, matcher, auditAnnotationEvaluator, messageEvaluator, failurePolicy, nil)
+	return validator, utilerrors.NewAggregate(errs)
+}
+
+// compileMutatingPolicy compiles the match conditions, variables and mutations of the policy like the
+// MutatingAdmissionPolicy plugin of the API server does, without the authorizer variable. The returned error
+// aggregates all compilation errors. Mutations must have the expression of their patch type.
+func compileMutatingPolicy(policy *admissionregistrationv1.MutatingAdmissionPolicy) (mutating.PolicyEvaluator, error) {
+	optionalVars := cel.OptionalVariableDeclarations{HasParams: policy.Spec.ParamKind != nil}
+	compiler, err := cel.NewCompositedCompiler(compositionEnvSet())
+	if err != nil {
+		return mutating.PolicyEvaluator{Error: err}, err
+	}
+	var errs []error
+	for i, variable := range policy.Spec.Variables {
+		result := compiler.CompileAndStoreVariable(&validating.Variable{Name: variable.Name, Expression: variable.Expression}, optionalVars, environment.StoredExpressions)
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("variables[%d].expression: %s", i, result.Error.Detail))
+		}
+	}
+
+	var matcher matchconditions.Matcher
+	if conditions := policy.Spec.MatchConditions; len(conditions) > 0 {
+		accessors := make([]cel.ExpressionAccessor, len(conditions))
+		for i := range conditions {
+			accessors[i] = (*matchconditions.MatchCondition)(&conditions[i])
+		}
+		matcher = matchconditions.NewMatcher(compiler.CompileCondition(accessors, optionalVars, environment.StoredExpressions), policy.Spec.FailurePolicy, "policy", "mutate", policy.Name)
+		errs = append(errs, compilationErrors(compiler, "matchConditions", "expression", accessors, optionalVars)...)
+	}
+
+	patchVars := optionalVars
+	patchVars.HasPatchTypes = true
+	mutators := make([]patch.Patcher, 0, len(policy.Spec.Mutations))
+	for i, mutation := range policy.Spec.Mutations {
+		var field string
+		var accessor cel.ExpressionAccessor
+		var newPatcher func(cel.MutatingEvaluator) patch.Patcher
+		switch {
+		case mutation.PatchType == admissionregistrationv1.PatchTypeJSONPatch && mutation.JSONPatch != nil:
+			field, accessor, newPatcher = "jsonPatch", &patch.JSONPatchCondition{Expression: mutation.JSONPatch.Expression}, patch.NewJSONPatcher
+		case mutation.PatchType == admissionregistrationv1.PatchTypeApplyConfiguration && mutation.ApplyConfiguration != nil:
+			field, accessor, newPatcher = "applyConfiguration", &patch.ApplyConfigurationCondition{Expression: mutation.ApplyConfiguration.Expression}, patch.NewApplyConfigurationPatcher
+		default:
+			errs = append(errs, fmt.Errorf("mutations[%d]: patchType must be %s with jsonPatch or %s with applyConfiguration", i, admissionregistrationv1.PatchTypeJSONPatch, admissionregistrationv1.PatchTypeApplyConfiguration))
+			continue
+		}
+		if result := compiler.CompileCELExpression(accessor, patchVars, environment.StoredExpressions); result.Error != nil {
+			errs = append(errs, fmt.Errorf("mutations[%d].%s.expression: %s", i, field, result.Error.Detail))
+		}
+		mutators = append(mutators, newPatcher(compiler.CompileMutatingEvaluator(accessor, patchVars, environment.StoredExpressions)))
+	}
+	return mutating.PolicyEvaluator{Matcher: matcher, Mutators: mutators, CompositedCompiler: compiler}, utilerrors.NewAggregate(errs)
+}
+
+// compilationErrors returns the errors compiling the expressions, naming the field of each, as the evaluators
+// report them without it.
+func compilationErrors(compiler *cel.CompositedCompiler, field, expressionField string, accessors []cel.ExpressionAccessor, optionalVars cel.OptionalVariableDeclarations) []error {
+	var errs []error
+	for i, accessor := range accessors {
+		if accessor == nil {
+			continue
+		}
+		if result := compiler.CompileCELExpression(accessor, optionalVars, environment.StoredExpressions); result.Error != nil {
+			errs = append(errs, fmt.Errorf("%s[%d].%s: %s", field, i, expressionField, result.Error.Detail))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,318 @@
+package celadmission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/generic"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/matching"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/mutating"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/mutating/patch"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+)
+
+// DefaultMutationsKey is the key of the mutating policies in ConfigMap sources by default.
+const DefaultMutationsKey = "mutations.yaml"
+
+var mutatingPolicyGVK = admissionregistrationv1.SchemeGroupVersion.WithKind("MutatingAdmissionPolicy")
+
+// ParseMutatingPolicies parses MutatingAdmissionPolicies of admissionregistration.k8s.io/v1 in YAML or JSON, which
+// may contain several documents and lists. The policies apply to the requests matching their matchConstraints
+// without bindings, so they cannot have params. They are defaulted like the API server does.
+func ParseMutatingPolicies(data []byte) ([]*admissionregistrationv1.MutatingAdmissionPolicy, error) {
+	objects, err := decodeObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]*admissionregistrationv1.MutatingAdmissionPolicy, 0, len(objects))
+	for _, obj := range objects {
+		if obj.GroupVersionKind() != mutatingPolicyGVK {
+			return nil, fmt.Errorf("%s %s: only %s objects are supported", obj.GetKind(), obj.GetName(), mutatingPolicyGVK.Kind)
+		}
+		policy := &admissionregistrationv1.MutatingAdmissionPolicy{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(obj.Object, policy, true); err != nil {
+			return nil, fmt.Errorf("MutatingAdmissionPolicy %s: %w", obj.GetName(), err)
+		}
+		switch {
+		case len(policy.Name) == 0:
+			return nil, fmt.Errorf("MutatingAdmissionPolicy without a name")
+		case len(policy.Spec.Mutations) == 0:
+			return nil, fmt.Errorf("MutatingAdmissionPolicy %s: mutations are required", policy.Name)
+		case policy.Spec.ParamKind != nil:
+			return nil, fmt.Errorf("MutatingAdmissionPolicy %s: paramKind is not supported without bindings", policy.Name)
+		}
+		if policy.Spec.FailurePolicy == nil {
+			failurePolicy := admissionregistrationv1.Fail
+			policy.Spec.FailurePolicy = &failurePolicy
+		}
+		if policy.Spec.MatchConstraints == nil {
+			policy.Spec.MatchConstraints = &admissionregistrationv1.MatchResources{}
+		}
+		defaultMatchResources(policy.Spec.MatchConstraints)
+		policies = append(policies, policy)
+	}
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("no MutatingAdmissionPolicy found")
+	}
+	return policies, nil
+}
+
+// MutatingHookConfig configures a MutatingHook.
+type MutatingHookConfig struct {
+	// Resource is the resource the hook is served on.
+	Resource schema.GroupVersionResource
+	// Singular is the singular name of the resource, the resource without a trailing "s" by default.
+	Singular string
+	// Source is where the MutatingAdmissionPolicies are loaded from.
+	Source Source
+}
+
+// MutatingHook is a mutating admission hook applying the mutations of MutatingAdmissionPolicies loaded from a file or
+// ConfigMap, and returning the changes as JSONPatch. The policies are applied in order to the requests matching
+// their matchConstraints and matchConditions, and reloaded when the source changes. When they fail to load, the
+// hook keeps the last policies which did, and reports the error on readyz. Until policies are loaded, requests are
+// denied.
+//
+// ApplyConfigurations are merged with the schemas the cluster publishes as OpenAPI. Objects without a schema are
+// merged as if all their fields were maps, so ApplyConfigurations setting lists of them are rejected.
+type MutatingHook struct {
+	config MutatingHookConfig
+
+	lock           sync.RWMutex
+	policies       []mutatingPolicy
+	loadErr        error
+	matcher        generic.PolicyMatcher
+	typeConverters patch.TypeConverterManager
+}
+
+var _ interface {
+	apiserver.MutatingAdmissionHookV1WithContext
+	apiserver.AdmissionHookWithReadyzChecks
+} = &MutatingHook{}
+
+type mutatingPolicy struct {
+	policy    *admissionregistrationv1.MutatingAdmissionPolicy
+	evaluator mutating.PolicyEvaluator
+}
+
+// deducedTypeConverter merges objects without a schema.
+var deducedTypeConverter = managedfields.NewDeducedTypeConverter()
+
+// NewMutatingHook returns a hook serving the MutatingAdmissionPolicies of the source on the resource of the config.
+func NewMutatingHook(config MutatingHookConfig) *MutatingHook {
+	if len(config.Singular) == 0 {
+		config.Singular = singular(config.Resource.Resource)
+	}
+	return &MutatingHook{config: config, loadErr: fmt.Errorf("%s: the policies are not loaded yet", config.Source)}
+}
+
+// Initialize starts loading the policies from the source, and the namespaces and schemas they are applied with.
+func (h *MutatingHook) Initialize(kubeClientConfig *restclient.Config, stopCh <-chan struct{}) error {
+	client, err := kubernetes.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	typeConverters := patch.NewTypeConverterManager(nil, client.Discovery().OpenAPIV3())
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go typeConverters.Run(ctx)
+	return h.start(kubeClientConfig, client, typeConverters, stopCh)
+}
+
+func (h *MutatingHook) start(kubeClientConfig *restclient.Config, client kubernetes.Interface, typeConverters patch.TypeConverterManager, stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	h.lock.Lock()
+	h.matcher = generic.NewPolicyMatcher(matching.NewMatcher(factory.Core().V1().Namespaces().Lister(), client))
+	h.typeConverters = typeConverters
+	h.lock.Unlock()
+	factory.Start(stopCh)
+	return h.config.Source.watch(kubeClientConfig, stopCh, h.load)
+}
+
+func (h *MutatingHook) MutatingResource() (plural schema.GroupVersionResource, singular string) {
+	return h.config.Resource, h.config.Singular
+}
+
+// Admit applies the mutations of the policies matching the request to its object. Errors of a policy deny the
+// request if its failure policy is Fail, and skip the policy otherwise.
+func (h *MutatingHook) Admit(ctx context.Context, request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	h.lock.RLock()
+	policies, matcher, typeConverters := h.policies, h.matcher, h.typeConverters
+	h.lock.RUnlock()
+	if policies == nil || matcher == nil {
+		h.lock.RLock()
+		loadErr := h.loadErr
+		h.lock.RUnlock()
+		return errorResponse(request, apierrors.NewInternalError(loadErr))
+	}
+
+	versioned, err := apiserver.VersionedAttributes(request)
+	if err != nil {
+		return errorResponse(request, apierrors.NewBadRequest(err.Error()))
+	}
+	if versioned.VersionedObject == nil {
+		// there is nothing to mutate
+		return &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	}
+
+	namespace, statusErr := namespaceObject(ctx, matcher, request)
+	if statusErr != nil {
+		return errorResponse(request, statusErr)
+	}
+	typeConverter := deducedTypeConverter
+	if typeConverters != nil {
+		if c := typeConverters.GetTypeConverter(versioned.VersionedKind); c != nil {
+			typeConverter = c
+		}
+	}
+
+	v := &verdict{}
+	for _, p := range policies {
+		policyErr := func(err error) {
+			if *p.policy.Spec.FailurePolicy == admissionregistrationv1.Ignore {
+				klog.V(2).InfoS("Ignoring error of MutatingAdmissionPolicy", "resource", h.config.Resource.String(), "policy", p.policy.Name, "err", err)
+				return
+			}
+			v.deny(fmt.Sprintf("policy %q denied request: %v", p.policy.Name, err), metav1.StatusReasonInvalid)
+		}
+
+		matches, matchedResource, _, err := matcher.DefinitionMatches(versioned.Attributes, objectInterfaces, mutating.NewMutatingAdmissionPolicyAccessor(p.policy))
+		if err != nil {
+			policyErr(err)
+			continue
+		}
+		if !matches {
+			continue
+		}
+		policyCtx := p.evaluator.CompositedCompiler.CreateContext(ctx)
+		if p.evaluator.Matcher != nil {
+			result := p.evaluator.Matcher.Match(policyCtx, versioned, nil, nil)
+			if result.Error != nil {
+				policyErr(result.Error)
+				continue
+			}
+			if !result.Matches {
+				continue
+			}
+		}
+		// a failing mutation abandons the whole policy, like in the API server, so that it is never partly applied
+		unmutated := versioned.VersionedObject
+		for _, mutator := range p.evaluator.Mutators {
+			mutated, err := mutator.Patch(policyCtx, patch.Request{
+				MatchedResource:     matchedResource,
+				VersionedAttributes: versioned,
+				ObjectInterfaces:    objectInterfaces,
+				OptionalVariables:   cel.OptionalVariableBindings{},
+				Namespace:           namespace,
+				TypeConverter:       typeConverter,
+			}, celconfig.RuntimeCELCostBudget)
+			if err != nil {
+				versioned.VersionedObject = unmutated
+				policyErr(err)
+				break
+			}
+			versioned.VersionedObject = mutated
+		}
+	}
+	if len(v.denials) > 0 {
+		return v.response(request)
+	}
+
+	response := v.response(request)
+	if response.Patch, err = objectPatch(request.Object.Raw, versioned.VersionedObject); err != nil {
+		return errorResponse(request, apierrors.NewInternalError(err))
+	}
+	if len(response.Patch) > 0 {
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.PatchType = &patchType
+	}
+	return response
+}
+
+// ReadyzChecks reports the error loading the policies, if the last attempt failed.
+func (h *MutatingHook) ReadyzChecks() []healthz.HealthChecker {
+	gvr := h.config.Resource
+	return []healthz.HealthChecker{
+		healthz.NamedCheck("cel-mutations-"+gvr.Resource+"."+gvr.Version+"."+gvr.Group, func(*http.Request) error {
+			h.lock.RLock()
+			defer h.lock.RUnlock()
+			return h.loadErr
+		}),
+	}
+}
+
+// load compiles the policies and serves them if they compile.
+func (h *MutatingHook) load(data []byte, err error) {
+	var policies []mutatingPolicy
+	if err == nil {
+		policies, err = compileMutatingPolicies(data)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if err != nil {
+		h.loadErr = fmt.Errorf("%s: failed to load policies: %w", h.config.Source, err)
+		klog.ErrorS(err, "Failed to load MutatingAdmissionPolicies, keeping the last ones", "resource", h.config.Resource.String(), "source", h.config.Source.String())
+		return
+	}
+	klog.InfoS("Loaded MutatingAdmissionPolicies", "resource", h.config.Resource.String(), "source", h.config.Source.String(), "policies", len(policies))
+	h.policies, h.loadErr = policies, nil
+}
+
+func compileMutatingPolicies(data []byte) ([]mutatingPolicy, error) {
+	parsed, err := ParseMutatingPolicies(data)
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]mutatingPolicy, 0, len(parsed))
+	for _, policy := range parsed {
+		evaluator, err := compileMutatingPolicy(policy)
+		if err != nil {
+			return nil, fmt.Errorf("MutatingAdmissionPolicy %s: %w", policy.Name, err)
+		}
+		policies = append(policies, mutatingPolicy{policy: policy, evaluator: evaluator})
+	}
+	return policies, nil
+}
+
+// objectPatch returns the JSONPatch from the original JSON object to the mutated object, or nil if they are equal.
+func objectPatch(original []byte, mutated runtime.Object) ([]byte, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(mutated)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	operations, err := jsonpatch.CreatePatch(original, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create patch: %w", err)
+	}
+	if len(operations) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(operations)
+}
@@ -0,0 +1,272 @@
+package celadmission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+const deploymentMutations = `
+apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingAdmissionPolicy
+metadata:
+  name: owner-label
+spec:
+  matchConstraints:
+    resourceRules:
+    - apiGroups: ["apps"]
+      apiVersions: ["v1"]
+      operations: ["CREATE"]
+      resources: ["deployments"]
+  matchConditions:
+  - name: not-exempt
+    expression: "!has(object.metadata.labels) || !('exempt' in object.metadata.labels)"
+  reinvocationPolicy: IfNeeded
+  mutations:
+  - patchType: JSONPatch
+    jsonPatch:
+      expression: >
+        has(object.metadata.labels) ? [
+          JSONPatch{op: "add", path: "/metadata/labels/owner", value: request.userInfo.username}
+        ] : [
+          JSONPatch{op: "add", path: "/metadata/labels", value: {"owner": request.userInfo.username}}
+        ]
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingAdmissionPolicy
+metadata:
+  name: min-replicas
+spec:
+  failurePolicy: FAILURE_POLICY
+  matchConstraints:
+    resourceRules:
+    - apiGroups: ["apps"]
+      apiVersions: ["v1"]
+      operations: ["CREATE", "UPDATE"]
+      resources: ["deployments"]
+  reinvocationPolicy: Never
+  mutations:
+  - patchType: ApplyConfiguration
+    applyConfiguration:
+      expression: >
+        object.spec.replicas < 2 ? Object{spec: Object.spec{replicas: 2}} : Object{}
+  - patchType: JSONPatch
+    jsonPatch:
+      expression: "has(object.metadata.labels) && 'broken' in object.metadata.labels ? [JSONPatch{op: 'remove', path: '/spec/missing'}] : []"
+`
+
+var mutatorsGVR = schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "deploymentmutators"}
+
+func writeMutations(t *testing.T, path, failurePolicy string) {
+	t.Helper()
+	writeFile(t, path, strings.ReplaceAll(deploymentMutations, "FAILURE_POLICY", failurePolicy))
+}
+
+func startMutatingHook(t *testing.T, path string) *MutatingHook {
+	t.Helper()
+	client := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	hook := NewMutatingHook(MutatingHookConfig{Resource: mutatorsGVR, Source: Source{File: path, ReloadInterval: 10 * time.Millisecond}})
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := hook.start(nil, client, nil, stopCh); err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+func TestMutatingHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mutations.yaml")
+	writeMutations(t, path, "Fail")
+	hook := startMutatingHook(t, path)
+
+	if gvr, singular := hook.MutatingResource(); gvr != mutatorsGVR || singular != "deploymentmutator" {
+		t.Errorf("unexpected resource %v %q", gvr, singular)
+	}
+	if name := hook.ReadyzChecks()[0].Name(); name != "cel-mutations-deploymentmutators.v1.admission.example.com" {
+		t.Errorf("unexpected readyz check name %q", name)
+	}
+	if err := hook.ReadyzChecks()[0].Check(nil); err != nil {
+		t.Fatalf("unexpected readyz error: %v", err)
+	}
+
+	withUser := func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionRequest {
+		request.UserInfo.Username = "alice"
+		return request
+	}
+	tests := []struct {
+		name     string
+		request  *admissionv1.AdmissionRequest
+		denied   string
+		labels   map[string]interface{}
+		replicas int64
+	}{
+		{
+			name:     "json patch and apply configuration",
+			request:  withUser(deploymentRequest(t, admissionv1.Create, 1, nil, 0)),
+			labels:   map[string]interface{}{"owner": "alice"},
+			replicas: 2,
+		},
+		{
+			name:     "existing labels",
+			request:  withUser(deploymentRequest(t, admissionv1.Create, 3, map[string]string{"app": "web"}, 0)),
+			labels:   map[string]interface{}{"app": "web", "owner": "alice"},
+			replicas: 3,
+		},
+		{
+			name:     "match condition",
+			request:  withUser(deploymentRequest(t, admissionv1.Create, 1, map[string]string{"exempt": "true"}, 0)),
+			labels:   map[string]interface{}{"exempt": "true"},
+			replicas: 2,
+		},
+		{
+			name:     "match constraints",
+			request:  withUser(deploymentRequest(t, admissionv1.Update, 5, nil, 1)),
+			replicas: 5,
+		},
+		{
+			name:    "failure policy fail",
+			request: withUser(deploymentRequest(t, admissionv1.Create, 1, map[string]string{"broken": "true"}, 0)),
+			denied:  `policy "min-replicas" denied request`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := hook.Admit(context.Background(), tt.request)
+			if response.UID != tt.request.UID {
+				t.Errorf("unexpected UID %q", response.UID)
+			}
+			if len(tt.denied) > 0 {
+				if response.Allowed || !strings.Contains(response.Result.Message, tt.denied) || len(response.Patch) > 0 {
+					t.Fatalf("expected a denial containing %q, got %#v", tt.denied, response)
+				}
+				return
+			}
+			if !response.Allowed {
+				t.Fatalf("expected the request to be allowed, got %v", response.Result)
+			}
+			if violations := admissionreview.VerifyResponse(admissionreview.HookTypeMutating, tt.request, response); len(violations) > 0 {
+				t.Fatalf("unexpected violations %v", violations)
+			}
+			patched, err := admissionreview.ApplyPatch(tt.request.Object.Raw, response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var obj struct {
+				Metadata struct {
+					Labels map[string]interface{} `json:"labels"`
+				} `json:"metadata"`
+				Spec struct {
+					Replicas int64 `json:"replicas"`
+				} `json:"spec"`
+			}
+			if err := json.Unmarshal(patched, &obj); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(obj.Metadata.Labels, tt.labels) || obj.Spec.Replicas != tt.replicas {
+				t.Errorf("unexpected labels %v and replicas %d of %s", obj.Metadata.Labels, obj.Spec.Replicas, patched)
+			}
+		})
+	}
+
+	// nothing to change, no patch
+	request := withUser(deploymentRequest(t, admissionv1.Update, 5, nil, 1))
+	if response := hook.Admit(context.Background(), request); !response.Allowed || response.Patch != nil || response.PatchType != nil {
+		t.Errorf("expected no patch, got %#v", response)
+	}
+}
+
+func TestMutatingHookReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mutations.yaml")
+	writeMutations(t, path, "Fail")
+	hook := startMutatingHook(t, path)
+	request := deploymentRequest(t, admissionv1.Create, 1, map[string]string{"broken": "true"}, 0)
+	request.UserInfo.Username = "alice"
+	if response := hook.Admit(context.Background(), request); response.Allowed {
+		t.Fatal("expected the failing mutation to deny the request")
+	}
+
+	writeMutations(t, path, "Ignore")
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		return hook.Admit(ctx, request).Allowed, nil
+	}); err != nil {
+		t.Fatal("the ignored failing mutation still denies the request")
+	}
+	// the mutations of the failed policy before the failing one are rolled back, the other policies are applied
+	response := hook.Admit(context.Background(), request)
+	patched, err := admissionreview.ApplyPatch(request.Object.Raw, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Spec struct {
+			Replicas int64 `json:"replicas"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(patched, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Spec.Replicas != 1 || obj.Metadata.Labels["owner"] != "alice" {
+		t.Errorf("expected only the owner label to be applied, got %s", patched)
+	}
+
+	// a policy which does not compile is reported on readyz, the last policies keep being served
+	writeFile(t, path, strings.ReplaceAll(deploymentMutations, "request.userInfo.username", "request.userInfo.unknown"))
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return hook.ReadyzChecks()[0].Check(nil) != nil, nil
+	}); err != nil {
+		t.Fatal("the broken policy was not reported on readyz")
+	}
+	if err := hook.ReadyzChecks()[0].Check(nil); !strings.Contains(err.Error(), "mutations[0].jsonPatch.expression") {
+		t.Errorf("unexpected readyz error %v", err)
+	}
+	if response := hook.Admit(context.Background(), request); !response.Allowed {
+		t.Errorf("expected the last policies to be served, got %v", response.Result)
+	}
+}
+
+func TestParseMutatingPolicies(t *testing.T) {
+	policies, err := ParseMutatingPolicies([]byte(strings.ReplaceAll(deploymentMutations, "FAILURE_POLICY", "Ignore")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 2 || policies[0].Name != "owner-label" || *policies[0].Spec.FailurePolicy != "Fail" || *policies[1].Spec.FailurePolicy != "Ignore" {
+		t.Errorf("unexpected policies %v", policies)
+	}
+
+	for data, message := range map[string]string{
+		"": "no MutatingAdmissionPolicy found",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n":                                                                                                                                          "only MutatingAdmissionPolicy objects are supported",
+		"apiVersion: admissionregistration.k8s.io/v1\nkind: MutatingAdmissionPolicy\nmetadata:\n  name: x\nspec: {}\n":                                                                                     "mutations are required",
+		"apiVersion: admissionregistration.k8s.io/v1\nkind: MutatingAdmissionPolicy\nmetadata:\n  name: x\nspec:\n  paramKind: {kind: ConfigMap, apiVersion: v1}\n  mutations: [{patchType: JSONPatch}]\n": "paramKind is not supported",
+		"apiVersion: admissionregistration.k8s.io/v1\nkind: MutatingAdmissionPolicy\nmetadata:\n  name: x\nspec:\n  unknown: true\n":                                                                       "unknown field",
+	} {
+		if _, err := ParseMutatingPolicies([]byte(data)); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q: expected an error containing %q, got %v", data, message, err)
+		}
+	}
+}
+
+func TestMutatingHookNotLoaded(t *testing.T) {
+	hook := NewMutatingHook(MutatingHookConfig{Resource: mutatorsGVR, Source: Source{File: "mutations.yaml"}})
+	response := hook.Admit(context.Background(), deploymentRequest(t, admissionv1.Create, 1, nil, 0))
+	if response.Allowed || response.Result.Code != http.StatusInternalServerError {
+		t.Errorf("expected an internal error, got %#v", response)
+	}
+}
@@ -0,0 +1,125 @@
+package celadmission
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+)
+
+// Options are the command line options of the built-in CEL admission hooks.
+type Options struct {
+	// Validations are the sources of CEL validating hooks by the resource they are served on, in the form
+	// resource.version.group.
+	Validations map[string]string
+	// Policies are the sources of ValidatingAdmissionPolicy hooks by the resource they are served on, a directory or
+	// cluster.
+	Policies map[string]string
+	// Mutations are the sources of CEL mutating hooks by the resource they are served on.
+	Mutations      map[string]string
+	ReloadInterval time.Duration
+}
+
+// NewOptions returns the default options, which serve no hooks.
+func NewOptions() *Options {
+	return &Options{
+		Validations:    map[string]string{},
+		Policies:       map[string]string{},
+		Mutations:      map[string]string{},
+		ReloadInterval: DefaultReloadInterval,
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+	fs.StringToStringVar(&o.Validations, "cel-validations", o.Validations, "Serve a validating admission hook evaluating the CEL validations of a source in the form resource.version.group=source. The source is a YAML file, or configmap:<namespace>/<name>[/<key>] with the key "+DefaultValidationsKey+" by default. The validations are reloaded when the source changes.")
+	fs.StringToStringVar(&o.Policies, "validating-admission-policies", o.Policies, "Serve a validating admission hook evaluating ValidatingAdmissionPolicies and their bindings in the form resource.version.group=source. The source is a directory of YAML files with the policies, or "+PolicySourceCluster+" to evaluate the ones of the cluster. Params are resolved in the cluster.")
+	fs.StringToStringVar(&o.Mutations, "cel-mutations", o.Mutations, "Serve a mutating admission hook applying the mutations of MutatingAdmissionPolicies of a source in the form resource.version.group=source. The source is a YAML file, or configmap:<namespace>/<name>[/<key>] with the key "+DefaultMutationsKey+" by default. The policies apply to the requests matching their matchConstraints, without bindings and params, and are reloaded when the source changes.")
+	fs.DurationVar(&o.ReloadInterval, "cel-reload-interval", o.ReloadInterval, "How often files and directories of CEL admission hooks are checked for changes. ConfigMaps and cluster objects are watched.")
+}
+
+func (o *Options) Validate() []error {
+	if o == nil {
+		return nil
+	}
+	var errs []error
+	if o.ReloadInterval <= 0 {
+		errs = append(errs, fmt.Errorf("--cel-reload-interval must be positive"))
+	}
+	if _, err := o.AdmissionHooks(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// AdmissionHooks returns the CEL admission hooks configured by the options, ordered by resource.
+func (o *Options) AdmissionHooks() ([]apiserver.AdmissionHook, error) {
+	if o == nil {
+		return nil, nil
+	}
+	names := make([]string, 0, len(o.Validations))
+	for name := range o.Validations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var hooks []apiserver.AdmissionHook
+	for _, name := range names {
+		gvr, _ := schema.ParseResourceArg(name)
+		if gvr == nil {
+			return nil, fmt.Errorf("--cel-validations: invalid hook resource %q, must be of the form resource.version.group", name)
+		}
+		source, err := ParseSource(o.Validations[name], DefaultValidationsKey)
+		if err != nil {
+			return nil, fmt.Errorf("--cel-validations: %s: %w", name, err)
+		}
+		source.ReloadInterval = o.ReloadInterval
+		hooks = append(hooks, NewValidatingHook(ValidatingHookConfig{Resource: *gvr, Source: source}))
+	}
+
+	names = names[:0]
+	for name := range o.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		gvr, _ := schema.ParseResourceArg(name)
+		if gvr == nil {
+			return nil, fmt.Errorf("--validating-admission-policies: invalid hook resource %q, must be of the form resource.version.group", name)
+		}
+		config := PolicyHookConfig{Resource: *gvr, ReloadInterval: o.ReloadInterval}
+		switch source := o.Policies[name]; source {
+		case "":
+			return nil, fmt.Errorf("--validating-admission-policies: %s: the source must be a directory or %s", name, PolicySourceCluster)
+		case PolicySourceCluster:
+		default:
+			config.Dir = source
+		}
+		hooks = append(hooks, NewPolicyHook(config))
+	}
+
+	names = names[:0]
+	for name := range o.Mutations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		gvr, _ := schema.ParseResourceArg(name)
+		if gvr == nil {
+			return nil, fmt.Errorf("--cel-mutations: invalid hook resource %q, must be of the form resource.version.group", name)
+		}
+		source, err := ParseSource(o.Mutations[name], DefaultMutationsKey)
+		if err != nil {
+			return nil, fmt.Errorf("--cel-mutations: %s: %w", name, err)
+		}
+		source.ReloadInterval = o.ReloadInterval
+		hooks = append(hooks, NewMutatingHook(MutatingHookConfig{Resource: *gvr, Source: source}))
+	}
+	return hooks, nil
+}
@@ -0,0 +1,115 @@
+package celadmission
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	initialParamKindBackoff = time.Second
+	maxParamKindBackoff     = 5 * time.Minute
+)
+
+// paramInformers are the informers of the params of policies by their kind. They are started when a policy first
+// references their kind, and run until the stop channel is closed. Kinds which cannot be resolved are tried again
+// with an exponential backoff, since every attempt resets the discovery of the mapper. The policies referencing them
+// are set again once the backoff passed, see PolicyHook.setPolicies.
+type paramInformers struct {
+	client     dynamic.Interface
+	restMapper meta.RESTMapper
+	stopCh     <-chan struct{}
+	now        func() time.Time
+
+	lock      sync.Mutex
+	informers map[schema.GroupVersionKind]paramInformer
+	failures  map[schema.GroupVersionKind]paramKindFailure
+}
+
+// paramKindFailure is the error resolving a kind, which is returned until retryAt.
+type paramKindFailure struct {
+	err     error
+	retryAt time.Time
+	backoff time.Duration
+}
+
+type paramInformer struct {
+	informer informers.GenericInformer
+	scope    meta.RESTScope
+}
+
+func newParamInformers(client dynamic.Interface, restMapper meta.RESTMapper, stopCh <-chan struct{}) *paramInformers {
+	return &paramInformers{
+		client:     client,
+		restMapper: restMapper,
+		stopCh:     stopCh,
+		now:        time.Now,
+		informers:  map[schema.GroupVersionKind]paramInformer{},
+		failures:   map[schema.GroupVersionKind]paramKindFailure{},
+	}
+}
+
+// informerFor returns the informer of the params of the kind, and their scope.
+func (p *paramInformers) informerFor(paramKind *admissionregistrationv1.ParamKind) (informers.GenericInformer, meta.RESTScope, error) {
+	gv, err := schema.ParseGroupVersion(paramKind.APIVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid paramKind apiVersion %q: %w", paramKind.APIVersion, err)
+	}
+	gvk := gv.WithKind(paramKind.Kind)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if i, ok := p.informers[gvk]; ok {
+		return i.informer, i.scope, nil
+	}
+	failure, failed := p.failures[gvk]
+	if failed && p.now().Before(failure.retryAt) {
+		return nil, nil, failure.err
+	}
+	mapping, err := p.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if resettable, ok := p.restMapper.(meta.ResettableRESTMapper); ok {
+			// the kind may be a CRD created after the mapper discovered the API
+			resettable.Reset()
+			mapping, err = p.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+		if err != nil {
+			failure.backoff = min(max(2*failure.backoff, initialParamKindBackoff), maxParamKindBackoff)
+			failure.retryAt = p.now().Add(failure.backoff)
+			failure.err = fmt.Errorf("failed to find resource referenced by paramKind: '%v'", gvk)
+			p.failures[gvk] = failure
+			return nil, nil, failure.err
+		}
+	}
+	delete(p.failures, gvk)
+	informer := dynamicinformer.NewFilteredDynamicInformer(p.client, mapping.Resource, metav1.NamespaceAll, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil)
+	go informer.Informer().Run(p.stopCh)
+	p.informers[gvk] = paramInformer{informer: informer, scope: mapping.Scope}
+	return informer, mapping.Scope, nil
+}
+
+// retryDelay returns how long it is until the first of the kinds which failed to resolve may be tried again, and
+// whether any failed.
+func (p *paramInformers) retryDelay() (time.Duration, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var retryAt time.Time
+	for _, failure := range p.failures {
+		if retryAt.IsZero() || failure.retryAt.Before(retryAt) {
+			retryAt = failure.retryAt
+		}
+	}
+	if retryAt.IsZero() {
+		return 0, false
+	}
+	return max(retryAt.Sub(p.now()), 0), true
+}
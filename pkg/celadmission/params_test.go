@@ -0,0 +1,58 @@
+package celadmission
+
+import (
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// resettableRESTMapper counts the resets of its discovery.
+type resettableRESTMapper struct {
+	*meta.DefaultRESTMapper
+	resets int
+}
+
+func (m *resettableRESTMapper) Reset() {
+	m.resets++
+}
+
+func TestParamInformersBackoff(t *testing.T) {
+	restMapper := &resettableRESTMapper{DefaultRESTMapper: meta.NewDefaultRESTMapper(nil)}
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	params := newParamInformers(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), restMapper, stopCh)
+	now := time.Now()
+	params.now = func() time.Time { return now }
+	paramKind := &admissionregistrationv1.ParamKind{APIVersion: "example.com/v1", Kind: "Limits"}
+
+	expectResets := func(resets int, resolved bool) {
+		t.Helper()
+		_, _, err := params.informerFor(paramKind)
+		if resolved != (err == nil) {
+			t.Fatalf("expected resolved=%v, got error %v", resolved, err)
+		}
+		if restMapper.resets != resets {
+			t.Fatalf("expected %d discovery resets, got %d", resets, restMapper.resets)
+		}
+	}
+
+	expectResets(1, false)
+	// the failure is returned again without discovery until the backoff passed
+	expectResets(1, false)
+	now = now.Add(initialParamKindBackoff)
+	expectResets(2, false)
+	now = now.Add(initialParamKindBackoff)
+	expectResets(2, false)
+	now = now.Add(initialParamKindBackoff)
+	expectResets(3, false)
+
+	restMapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Limits"}, meta.RESTScopeNamespace)
+	now = now.Add(4 * initialParamKindBackoff)
+	expectResets(3, true)
+	expectResets(3, true)
+}
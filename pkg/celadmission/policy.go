@@ -0,0 +1,397 @@
+package celadmission
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/generic"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/matching"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/apiserver/pkg/warning"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	admissionregistrationlisters "k8s.io/client-go/listers/admissionregistration/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+)
+
+// PolicySourceCluster is the source of a PolicyHook evaluating the ValidatingAdmissionPolicies of the cluster.
+const PolicySourceCluster = "cluster"
+
+// validationFailureAnnotation is the audit annotation the ValidatingAdmissionPolicy plugin publishes validation
+// failures of bindings with the Audit action under.
+const validationFailureAnnotation = "validation.policy.admission.k8s.io/validation_failure"
+
+// PolicyHookConfig configures a PolicyHook.
+type PolicyHookConfig struct {
+	// Resource is the resource the hook is served on.
+	Resource schema.GroupVersionResource
+	// Singular is the singular name of the resource, the resource without a trailing "s" by default.
+	Singular string
+	// Dir is a directory of YAML or JSON files with the ValidatingAdmissionPolicies and bindings to evaluate. The
+	// ones of the cluster are evaluated if it is empty.
+	Dir string
+	// ReloadInterval is how often the directory is checked for changes, DefaultReloadInterval if zero.
+	ReloadInterval time.Duration
+}
+
+// PolicyHook is a validating admission hook evaluating ValidatingAdmissionPolicies and their bindings with the
+// ValidatingAdmissionPolicy plugin of the API server, for clusters which cannot run the plugin themselves. The
+// policies and bindings are loaded from a directory or watched in the cluster. Params are always resolved in the
+// cluster, so the same policies work natively.
+//
+// Policies are evaluated against the objects in the version the webhook receives. Rules match the resource of that
+// version, equivalent resources of other versions are not matched. Expressions using the authorizer do not compile.
+// Policies loaded from files without matchConstraints match every request the hook receives.
+type PolicyHook struct {
+	config PolicyHookConfig
+
+	// loadLock serializes loading the policies, which is done without holding lock. It guards the last loaded
+	// policies and bindings, which are set again by paramRetry while the kinds of params fail to resolve.
+	loadLock   sync.Mutex
+	policies   []*admissionregistrationv1.ValidatingAdmissionPolicy
+	bindings   []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	paramRetry *time.Timer
+
+	lock       sync.RWMutex
+	dispatcher generic.Dispatcher[validating.PolicyHook]
+	hooks      []validating.PolicyHook
+	compiled   map[string]compiledPolicy
+	loadErr    error
+
+	params *paramInformers
+}
+
+var _ interface {
+	apiserver.ValidatingAdmissionHookV1WithContext
+	apiserver.AdmissionHookWithReadyzChecks
+} = &PolicyHook{}
+
+type compiledPolicy struct {
+	spec      admissionregistrationv1.ValidatingAdmissionPolicySpec
+	validator validating.Validator
+}
+
+// NewPolicyHook returns a hook serving the ValidatingAdmissionPolicies of the config on its resource.
+func NewPolicyHook(config PolicyHookConfig) *PolicyHook {
+	if len(config.Singular) == 0 {
+		config.Singular = singular(config.Resource.Resource)
+	}
+	return &PolicyHook{
+		config:   config,
+		compiled: map[string]compiledPolicy{},
+		loadErr:  fmt.Errorf("%s: the policies are not loaded yet", config.source()),
+	}
+}
+
+func (c PolicyHookConfig) source() string {
+	if len(c.Dir) == 0 {
+		return PolicySourceCluster
+	}
+	return c.Dir
+}
+
+// Initialize starts loading the policies and their bindings, and the namespaces and params they are evaluated with.
+func (h *PolicyHook) Initialize(kubeClientConfig *restclient.Config, stopCh <-chan struct{}) error {
+	client, err := kubernetes.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	restMapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	return h.start(client, dynamicClient, restMapper, stopCh)
+}
+
+func (h *PolicyHook) start(client kubernetes.Interface, dynamicClient dynamic.Interface, restMapper meta.RESTMapper, stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	matcher := generic.NewPolicyMatcher(matching.NewMatcher(factory.Core().V1().Namespaces().Lister(), client))
+	h.lock.Lock()
+	h.dispatcher = validating.NewDispatcher(nil, matcher)
+	h.params = newParamInformers(dynamicClient, restMapper, stopCh)
+	h.lock.Unlock()
+
+	if len(h.config.Dir) > 0 {
+		factory.Start(stopCh)
+		h.watchDir(stopCh)
+		return nil
+	}
+
+	policies := factory.Admissionregistration().V1().ValidatingAdmissionPolicies()
+	bindings := factory.Admissionregistration().V1().ValidatingAdmissionPolicyBindings()
+	synced := []cache.InformerSynced{policies.Informer().HasSynced, bindings.Informer().HasSynced}
+	refresh := func() {
+		for _, hasSynced := range synced {
+			if !hasSynced() {
+				return
+			}
+		}
+		h.refreshFromListers(policies.Lister(), bindings.Lister())
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { refresh() },
+		UpdateFunc: func(interface{}, interface{}) { refresh() },
+		DeleteFunc: func(interface{}) { refresh() },
+	}
+	if _, err := policies.Informer().AddEventHandler(handler); err != nil {
+		return err
+	}
+	if _, err := bindings.Informer().AddEventHandler(handler); err != nil {
+		return err
+	}
+	factory.Start(stopCh)
+	go func() {
+		if cache.WaitForCacheSync(stopCh, synced...) {
+			refresh()
+		}
+	}()
+	return nil
+}
+
+func (h *PolicyHook) ValidatingResource() (plural schema.GroupVersionResource, singular string) {
+	return h.config.Resource, h.config.Singular
+}
+
+// Validate evaluates the policies bound to the request, with the validation actions of their bindings: denials
+// of Deny bindings deny the request, the ones of Warn bindings are returned as warnings, and the ones of Audit
+// bindings are added to the audit annotations.
+func (h *PolicyHook) Validate(ctx context.Context, request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	h.lock.RLock()
+	dispatcher, hooks := h.dispatcher, h.hooks
+	h.lock.RUnlock()
+	if dispatcher == nil {
+		return errorResponse(request, apierrors.NewInternalError(fmt.Errorf("the admission hook for %s is not initialized", h.config.Resource.GroupResource())))
+	}
+
+	versioned, err := apiserver.VersionedAttributes(request)
+	if err != nil {
+		return errorResponse(request, apierrors.NewBadRequest(err.Error()))
+	}
+	attributes := &annotatedAttributes{Attributes: versioned.Attributes}
+	recorder := &warningRecorder{}
+	// the warnings go into the response, not the headers of the webhook call
+	ctx = warning.WithWarningRecorder(ctx, recorder)
+
+	err = dispatcher.Dispatch(ctx, attributes, objectInterfaces, hooks)
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	if err != nil {
+		var statusErr *apierrors.StatusError
+		if !errors.As(err, &statusErr) {
+			statusErr = apierrors.NewInternalError(err)
+		}
+		response = errorResponse(request, statusErr)
+	}
+	response.Warnings, response.AuditAnnotations = recorder.warnings, attributes.annotations
+	return response
+}
+
+// ReadyzChecks reports the error loading the policies, if the last attempt failed.
+func (h *PolicyHook) ReadyzChecks() []healthz.HealthChecker {
+	gvr := h.config.Resource
+	return []healthz.HealthChecker{
+		healthz.NamedCheck("validating-admission-policies-"+gvr.Resource+"."+gvr.Version+"."+gvr.Group, func(*http.Request) error {
+			h.lock.RLock()
+			defer h.lock.RUnlock()
+			return h.loadErr
+		}),
+	}
+}
+
+// watchDir loads the policies of the directory, and again whenever its files change.
+func (h *PolicyHook) watchDir(stopCh <-chan struct{}) {
+	interval := h.config.ReloadInterval
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	var last []byte
+	load := func() {
+		data, err := readPolicyDir(h.config.Dir)
+		if err == nil && last != nil && bytes.Equal(data, last) {
+			return
+		}
+		last = data
+		if err != nil {
+			h.setLoadError(err)
+			return
+		}
+		policies, bindings, err := parsePolicies(data)
+		if err != nil {
+			h.setLoadError(err)
+			return
+		}
+		h.setPolicies(policies, bindings)
+	}
+	load()
+	go wait.Until(load, interval, stopCh)
+}
+
+func (h *PolicyHook) refreshFromListers(policyLister admissionregistrationlisters.ValidatingAdmissionPolicyLister, bindingLister admissionregistrationlisters.ValidatingAdmissionPolicyBindingLister) {
+	policies, err := policyLister.List(labels.Everything())
+	if err != nil {
+		h.setLoadError(err)
+		return
+	}
+	bindings, err := bindingLister.List(labels.Everything())
+	if err != nil {
+		h.setLoadError(err)
+		return
+	}
+	h.setPolicies(policies, bindings)
+}
+
+func (h *PolicyHook) setLoadError(err error) {
+	h.loadLock.Lock()
+	defer h.loadLock.Unlock()
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.loadErr = fmt.Errorf("%s: failed to load policies: %w", h.config.source(), err)
+	klog.ErrorS(err, "Failed to load ValidatingAdmissionPolicies, keeping the last ones", "resource", h.config.Resource.String(), "source", h.config.source())
+}
+
+// setPolicies compiles the policies and serves them with their bindings. Policies without bindings are not
+// evaluated. Policies are only compiled again when their spec changed. Compilation errors and params of unknown
+// kinds are configuration errors of the policy, handled by its failure policy. Compiling the policies and resolving
+// the kinds of their params, which may take discovery round trips, is done before the policies are swapped in, so that
+// requests are not held up meanwhile. While the kinds of params fail to resolve, e.g. because their CRD is not
+// installed yet, the policies are set again once the backoff of the kinds passed.
+func (h *PolicyHook) setPolicies(policies []*admissionregistrationv1.ValidatingAdmissionPolicy, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) {
+	h.loadLock.Lock()
+	defer h.loadLock.Unlock()
+	h.setPoliciesLocked(policies, bindings)
+}
+
+// retryParams sets the last loaded policies again, to resolve the kinds of their params which failed before.
+func (h *PolicyHook) retryParams() {
+	h.loadLock.Lock()
+	defer h.loadLock.Unlock()
+	h.setPoliciesLocked(h.policies, h.bindings)
+}
+
+func (h *PolicyHook) setPoliciesLocked(policies []*admissionregistrationv1.ValidatingAdmissionPolicy, bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding) {
+	h.policies, h.bindings = policies, bindings
+	if h.paramRetry != nil {
+		h.paramRetry.Stop()
+		h.paramRetry = nil
+	}
+
+	bindingsByPolicy := map[string][]*admissionregistrationv1.ValidatingAdmissionPolicyBinding{}
+	for _, binding := range bindings {
+		bindingsByPolicy[binding.Spec.PolicyName] = append(bindingsByPolicy[binding.Spec.PolicyName], binding)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+
+	h.lock.RLock()
+	previous, params := h.compiled, h.params
+	h.lock.RUnlock()
+
+	compiled := make(map[string]compiledPolicy, len(policies))
+	hooks := make([]validating.PolicyHook, 0, len(policies))
+	paramsFailed := false
+	for _, policy := range policies {
+		c, ok := previous[policy.Name]
+		if !ok || !equality.Semantic.DeepEqual(c.spec, policy.Spec) {
+			validator, err := compileValidatingPolicy(policy)
+			if err != nil {
+				klog.InfoS("ValidatingAdmissionPolicy does not compile", "resource", h.config.Resource.String(), "policy", policy.Name, "err", err)
+			}
+			c = compiledPolicy{spec: policy.Spec, validator: validator}
+		}
+		compiled[policy.Name] = c
+
+		policyBindings := bindingsByPolicy[policy.Name]
+		if len(policyBindings) == 0 {
+			continue
+		}
+		sort.Slice(policyBindings, func(i, j int) bool { return policyBindings[i].Name < policyBindings[j].Name })
+		hook := validating.PolicyHook{Policy: policy, Bindings: policyBindings, Evaluator: c.validator}
+		if paramKind := policy.Spec.ParamKind; paramKind != nil {
+			hook.ParamInformer, hook.ParamScope, hook.ConfigurationError = params.informerFor(paramKind)
+			paramsFailed = paramsFailed || hook.ConfigurationError != nil
+		}
+		hooks = append(hooks, hook)
+	}
+	if delay, ok := params.retryDelay(); ok && paramsFailed {
+		h.paramRetry = time.AfterFunc(delay, func() {
+			select {
+			case <-params.stopCh:
+			default:
+				h.retryParams()
+			}
+		})
+	}
+
+	h.lock.Lock()
+	h.compiled, h.hooks, h.loadErr = compiled, hooks, nil
+	h.lock.Unlock()
+	klog.InfoS("Loaded ValidatingAdmissionPolicies", "resource", h.config.Resource.String(), "source", h.config.source(), "policies", len(policies), "bound", len(hooks))
+}
+
+// objectInterfaces convert nothing, the objects are evaluated in the version of the request.
+var objectInterfaces = admission.NewObjectInterfacesFromScheme(runtime.NewScheme())
+
+// annotatedAttributes collect the audit annotations added while dispatching a request, to return them in the
+// response. The API server prefixes the keys with the name of the webhook, so they must not have a prefix
+// themselves: validation failures are published as validation_failure, and the annotations of a policy as
+// <policy>.<key>.
+type annotatedAttributes struct {
+	admission.Attributes
+	annotations map[string]string
+}
+
+func (a *annotatedAttributes) AddAnnotation(key, value string) error {
+	if key == validationFailureAnnotation {
+		key = "validation_failure"
+	} else {
+		key = strings.Replace(key, "/", ".", 1)
+	}
+	if a.annotations == nil {
+		a.annotations = map[string]string{}
+	}
+	a.annotations[key] = value
+	return nil
+}
+
+func (a *annotatedAttributes) AddAnnotationWithLevel(key, value string, _ auditinternal.Level) error {
+	return a.AddAnnotation(key, value)
+}
+
+// warningRecorder collects the warnings added while dispatching a request.
+type warningRecorder struct {
+	warnings []string
+}
+
+func (r *warningRecorder) AddWarning(_, text string) {
+	r.warnings = append(r.warnings, text)
+}
@@ -0,0 +1,355 @@
+package celadmission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const replicaPolicy = `
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: max-replicas
+spec:
+  paramKind:
+    apiVersion: v1
+    kind: ConfigMap
+  matchConstraints:
+    resourceRules:
+    - apiGroups: ["apps"]
+      apiVersions: ["v1"]
+      operations: ["CREATE", "UPDATE"]
+      resources: ["deployments"]
+  validations:
+  - expression: "object.spec.replicas <= int(params.data.maxReplicas)"
+    messageExpression: "'replicas must be at most ' + params.data.maxReplicas"
+  auditAnnotations:
+  - key: replicas
+    valueExpression: "string(object.spec.replicas)"
+`
+
+const replicaBindings = `
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: enforce
+spec:
+  policyName: max-replicas
+  validationActions: [Deny]
+  paramRef:
+    name: PARAM
+    namespace: policies
+    parameterNotFoundAction: Deny
+  matchResources:
+    namespaceSelector:
+      matchLabels:
+        env: prod
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: warn
+spec:
+  policyName: max-replicas
+  validationActions: [Warn, Audit]
+  paramRef:
+    name: limits
+    namespace: policies
+  matchResources:
+    namespaceSelector:
+      matchLabels:
+        env: dev
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: limits
+  namespace: policies
+data:
+  maxReplicas: "5"
+`
+
+var policiesGVR = schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "policyvalidators"}
+
+func startPolicyHook(t *testing.T, dir string) *PolicyHook {
+	t.Helper()
+	restMapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	return startPolicyHookWithRESTMapper(t, dir, restMapper)
+}
+
+func startPolicyHookWithRESTMapper(t *testing.T, dir string, restMapper meta.RESTMapper) *PolicyHook {
+	t.Helper()
+	client := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"env": "dev"}}},
+	)
+	params := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "limits", "namespace": "policies"},
+		"data":       map[string]interface{}{"maxReplicas": "5"},
+	}}
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{configMaps: "ConfigMapList"}, params)
+
+	hook := NewPolicyHook(PolicyHookConfig{Resource: policiesGVR, Dir: dir, ReloadInterval: 10 * time.Millisecond})
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := hook.start(client, dynamicClient, restMapper, stopCh); err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+func writePolicies(t *testing.T, dir, param string) {
+	t.Helper()
+	writeFile(t, filepath.Join(dir, "policy.yaml"), replicaPolicy)
+	writeFile(t, filepath.Join(dir, "bindings.yml"), strings.ReplaceAll(replicaBindings, "PARAM", param))
+}
+
+func policyRequest(t *testing.T, namespace string, replicas int) *admissionv1.AdmissionRequest {
+	t.Helper()
+	request := deploymentRequest(t, admissionv1.Create, replicas, nil, 0)
+	request.UID = types.UID("uid-" + namespace)
+	request.Namespace = namespace
+	var obj map[string]interface{}
+	if err := json.Unmarshal(request.Object.Raw, &obj); err != nil {
+		t.Fatal(err)
+	}
+	obj["metadata"].(map[string]interface{})["namespace"] = namespace
+	request.Object.Raw, _ = json.Marshal(obj)
+	return request
+}
+
+func TestPolicyHook(t *testing.T) {
+	dir := t.TempDir()
+	writePolicies(t, dir, "limits")
+	hook := startPolicyHook(t, dir)
+	if err := hook.ReadyzChecks()[0].Check(nil); err != nil {
+		t.Fatalf("unexpected readyz error: %v", err)
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		response := hook.Validate(context.Background(), policyRequest(t, "prod", 3))
+		if !response.Allowed {
+			t.Fatalf("expected the request to be allowed, got %v", response.Result)
+		}
+		if response.AuditAnnotations["max-replicas.replicas"] != "3" {
+			t.Errorf("unexpected audit annotations %v", response.AuditAnnotations)
+		}
+	})
+	t.Run("deny", func(t *testing.T) {
+		request := policyRequest(t, "prod", 8)
+		response := hook.Validate(context.Background(), request)
+		if response.Allowed || response.UID != request.UID {
+			t.Fatalf("expected the request to be denied, got %#v", response)
+		}
+		expected := "ValidatingAdmissionPolicy 'max-replicas' with binding 'enforce' denied request: replicas must be at most 5"
+		if !strings.Contains(response.Result.Message, expected) || response.Result.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected %q, got %d %q", expected, response.Result.Code, response.Result.Message)
+		}
+		if len(response.Warnings) > 0 {
+			t.Errorf("unexpected warnings %v", response.Warnings)
+		}
+	})
+	t.Run("warn and audit", func(t *testing.T) {
+		response := hook.Validate(context.Background(), policyRequest(t, "dev", 8))
+		if !response.Allowed {
+			t.Fatalf("expected the request to be allowed, got %v", response.Result)
+		}
+		expected := []string{"Validation failed for ValidatingAdmissionPolicy 'max-replicas' with binding 'warn': replicas must be at most 5"}
+		if strings.Join(response.Warnings, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("expected warnings %q, got %q", expected, response.Warnings)
+		}
+		if failure := response.AuditAnnotations["validation_failure"]; !strings.Contains(failure, `"binding":"warn"`) {
+			t.Errorf("expected a validation failure of the warn binding, got %v", response.AuditAnnotations)
+		}
+	})
+	t.Run("not bound", func(t *testing.T) {
+		response := hook.Validate(context.Background(), policyRequest(t, "default", 8))
+		if !response.Allowed || len(response.Warnings) > 0 || len(response.AuditAnnotations) > 0 {
+			t.Errorf("expected the request to be allowed without annotations, got %#v", response)
+		}
+	})
+	t.Run("not matching", func(t *testing.T) {
+		request := policyRequest(t, "prod", 8)
+		request.Resource.Resource = "statefulsets"
+		if response := hook.Validate(context.Background(), request); !response.Allowed {
+			t.Errorf("expected the request to be allowed, got %v", response.Result)
+		}
+	})
+}
+
+func TestPolicyHookReload(t *testing.T) {
+	dir := t.TempDir()
+	writePolicies(t, dir, "limits")
+	hook := startPolicyHook(t, dir)
+	request := policyRequest(t, "prod", 3)
+	if response := hook.Validate(context.Background(), request); !response.Allowed {
+		t.Fatalf("expected the request to be allowed, got %v", response.Result)
+	}
+
+	writePolicies(t, dir, "missing")
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		response := hook.Validate(ctx, request)
+		return !response.Allowed && strings.Contains(response.Result.Message, "no params found"), nil
+	}); err != nil {
+		t.Fatal("the binding without params did not deny the request")
+	}
+
+	// a broken file is reported on readyz, the last policies keep being served
+	writeFile(t, filepath.Join(dir, "broken.yaml"), "apiVersion: admissionregistration.k8s.io/v1\nkind: ValidatingAdmissionPolicyBinding\nmetadata:\n  name: broken\nspec:\n  policyName: max-replicas\n")
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return hook.ReadyzChecks()[0].Check(nil) != nil, nil
+	}); err != nil {
+		t.Fatal("the broken binding was not reported on readyz")
+	}
+	if err := hook.ReadyzChecks()[0].Check(nil); !strings.Contains(err.Error(), "validationActions is required") {
+		t.Errorf("unexpected readyz error %v", err)
+	}
+	if response := hook.Validate(context.Background(), request); response.Allowed {
+		t.Error("expected the last policies to be served")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "broken.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return hook.ReadyzChecks()[0].Check(nil) == nil, nil
+	}); err != nil {
+		t.Fatal("the fixed policies were not loaded")
+	}
+}
+
+// blockingRESTMapper blocks the first mapping until released, like a slow discovery.
+type blockingRESTMapper struct {
+	meta.RESTMapper
+	once     sync.Once
+	entered  chan struct{}
+	released chan struct{}
+}
+
+func (m *blockingRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	m.once.Do(func() {
+		close(m.entered)
+		<-m.released
+	})
+	return m.RESTMapper.RESTMapping(gk, versions...)
+}
+
+func TestPolicyHookResolvesParamsWithoutBlocking(t *testing.T) {
+	defaultRESTMapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	defaultRESTMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	restMapper := &blockingRESTMapper{RESTMapper: defaultRESTMapper, entered: make(chan struct{}), released: make(chan struct{})}
+	dir := t.TempDir()
+	hook := startPolicyHookWithRESTMapper(t, dir, restMapper)
+
+	writePolicies(t, dir, "limits")
+	select {
+	case <-restMapper.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the param kind of the policy was not resolved")
+	}
+	request := policyRequest(t, "prod", 8)
+	validated := make(chan *admissionv1.AdmissionResponse)
+	go func() {
+		validated <- hook.Validate(context.Background(), request)
+	}()
+	select {
+	case response := <-validated:
+		if !response.Allowed {
+			t.Errorf("expected the request to be allowed before the policies are loaded, got %v", response.Result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("validation is blocked while the param kind is resolved")
+	}
+
+	close(restMapper.released)
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		return !hook.Validate(ctx, request).Allowed, nil
+	}); err != nil {
+		t.Fatal("the policies were not loaded")
+	}
+}
+
+// installingRESTMapper maps the kinds added with install after its discovery is reset, like a CRD installed later.
+type installingRESTMapper struct {
+	*meta.DefaultRESTMapper
+	lock    sync.Mutex
+	pending []schema.GroupVersionKind
+}
+
+func (m *installingRESTMapper) install(gvk schema.GroupVersionKind) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.pending = append(m.pending, gvk)
+}
+
+func (m *installingRESTMapper) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, gvk := range m.pending {
+		m.DefaultRESTMapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	m.pending = nil
+}
+
+func (m *installingRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.DefaultRESTMapper.RESTMapping(gk, versions...)
+}
+
+func TestPolicyHookResolvesParamKindInstalledLater(t *testing.T) {
+	restMapper := &installingRESTMapper{DefaultRESTMapper: meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})}
+	dir := t.TempDir()
+	hook := startPolicyHookWithRESTMapper(t, dir, restMapper)
+
+	writePolicies(t, dir, "limits")
+	request := policyRequest(t, "prod", 3)
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		response := hook.Validate(ctx, request)
+		return !response.Allowed && strings.Contains(response.Result.Message, "paramKind"), nil
+	}); err != nil {
+		t.Fatal("expected the policy to fail while the kind of its params is not installed")
+	}
+
+	restMapper.install(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	if err := wait.PollUntilContextTimeout(context.Background(), 50*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		return hook.Validate(ctx, request).Allowed, nil
+	}); err != nil {
+		t.Fatal("expected the kind of the params to be resolved once it is installed, without the policies changing")
+	}
+}
+
+func TestPolicyHookNotInitialized(t *testing.T) {
+	hook := NewPolicyHook(PolicyHookConfig{Resource: policiesGVR, Dir: t.TempDir()})
+	response := hook.Validate(context.Background(), policyRequest(t, "prod", 3))
+	if response.Allowed || response.Result.Code != http.StatusInternalServerError {
+		t.Errorf("expected an internal error, got %#v", response)
+	}
+	if err := hook.ReadyzChecks()[0].Check(nil); err == nil {
+		t.Error("expected a readyz error before the policies are loaded")
+	}
+}
@@ -0,0 +1,168 @@
+package celadmission
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+)
+
+var (
+	policyGVK        = admissionregistrationv1.SchemeGroupVersion.WithKind("ValidatingAdmissionPolicy")
+	policyBindingGVK = admissionregistrationv1.SchemeGroupVersion.WithKind("ValidatingAdmissionPolicyBinding")
+)
+
+// readPolicyDir returns the content of the YAML and JSON files of the directory, in the order of their names.
+func readPolicyDir(dir string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var content bytes.Buffer
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		// documents of different files must not run into each other
+		content.WriteString("\n---\n")
+		content.Write(data)
+	}
+	return content.Bytes(), nil
+}
+
+// parsePolicies parses the ValidatingAdmissionPolicies and bindings of admissionregistration.k8s.io/v1 in YAML or
+// JSON, which may contain several documents and lists. Other objects, like params applied together with the
+// policies, are skipped. The policies and bindings are defaulted like the API server does.
+func parsePolicies(data []byte) ([]*admissionregistrationv1.ValidatingAdmissionPolicy, []*admissionregistrationv1.ValidatingAdmissionPolicyBinding, error) {
+	objects, err := decodeObjects(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var policies []*admissionregistrationv1.ValidatingAdmissionPolicy
+	var bindings []*admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	for _, obj := range objects {
+		switch obj.GroupVersionKind() {
+		case policyGVK:
+			policy := &admissionregistrationv1.ValidatingAdmissionPolicy{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(obj.Object, policy, true); err != nil {
+				return nil, nil, fmt.Errorf("ValidatingAdmissionPolicy %s: %w", obj.GetName(), err)
+			}
+			if len(policy.Name) == 0 {
+				return nil, nil, fmt.Errorf("ValidatingAdmissionPolicy without a name")
+			}
+			defaultPolicy(policy)
+			policies = append(policies, policy)
+		case policyBindingGVK:
+			binding := &admissionregistrationv1.ValidatingAdmissionPolicyBinding{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(obj.Object, binding, true); err != nil {
+				return nil, nil, fmt.Errorf("ValidatingAdmissionPolicyBinding %s: %w", obj.GetName(), err)
+			}
+			switch {
+			case len(binding.Name) == 0:
+				return nil, nil, fmt.Errorf("ValidatingAdmissionPolicyBinding without a name")
+			case len(binding.Spec.PolicyName) == 0:
+				return nil, nil, fmt.Errorf("ValidatingAdmissionPolicyBinding %s: policyName is required", binding.Name)
+			case len(binding.Spec.ValidationActions) == 0:
+				return nil, nil, fmt.Errorf("ValidatingAdmissionPolicyBinding %s: validationActions is required", binding.Name)
+			}
+			defaultBinding(binding)
+			bindings = append(bindings, binding)
+		default:
+			klog.V(4).InfoS("Skipping object which is neither a ValidatingAdmissionPolicy nor a binding", "kind", obj.GetKind(), "name", obj.GetName())
+		}
+	}
+	return policies, bindings, nil
+}
+
+// decodeObjects decodes the objects of YAML or JSON, which may contain several documents and lists.
+func decodeObjects(data []byte) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if strings.HasSuffix(obj.GetKind(), "List") && obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, err
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// defaultPolicy sets the defaults of the API server for a policy loaded from a file.
+func defaultPolicy(policy *admissionregistrationv1.ValidatingAdmissionPolicy) {
+	if policy.Spec.FailurePolicy == nil {
+		failurePolicy := admissionregistrationv1.Fail
+		policy.Spec.FailurePolicy = &failurePolicy
+	}
+	if policy.Spec.MatchConstraints == nil {
+		policy.Spec.MatchConstraints = &admissionregistrationv1.MatchResources{}
+	}
+	defaultMatchResources(policy.Spec.MatchConstraints)
+}
+
+// defaultBinding sets the defaults of the API server for a binding loaded from a file.
+func defaultBinding(binding *admissionregistrationv1.ValidatingAdmissionPolicyBinding) {
+	if binding.Spec.MatchResources != nil {
+		defaultMatchResources(binding.Spec.MatchResources)
+	}
+}
+
+func defaultMatchResources(resources *admissionregistrationv1.MatchResources) {
+	if resources.NamespaceSelector == nil {
+		resources.NamespaceSelector = &metav1.LabelSelector{}
+	}
+	if resources.ObjectSelector == nil {
+		resources.ObjectSelector = &metav1.LabelSelector{}
+	}
+	if resources.MatchPolicy == nil {
+		matchPolicy := admissionregistrationv1.Equivalent
+		resources.MatchPolicy = &matchPolicy
+	}
+	for _, rules := range [][]admissionregistrationv1.NamedRuleWithOperations{resources.ResourceRules, resources.ExcludeResourceRules} {
+		for i := range rules {
+			if rules[i].Scope == nil {
+				scope := admissionregistrationv1.AllScopes
+				rules[i].Scope = &scope
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package celadmission
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultReloadInterval is how often file sources are checked for changes by default.
+const DefaultReloadInterval = 10 * time.Second
+
+// Source is where a hook loads its configuration from, a file or the key of a ConfigMap. ConfigMaps are watched,
+// files are checked for changes at the reload interval.
+type Source struct {
+	// File is the path of the file, if the source is a file.
+	File string
+	// ConfigMap is the ConfigMap, if the source is a ConfigMap.
+	ConfigMap types.NamespacedName
+	// Key is the key of the ConfigMap data holding the configuration.
+	Key string
+	// ReloadInterval is how often the file is checked for changes, DefaultReloadInterval if zero.
+	ReloadInterval time.Duration
+}
+
+// ParseSource parses a source in the form configmap:<namespace>/<name>[/<key>] or a file path. The key of ConfigMaps
+// defaults to the given one.
+func ParseSource(s, defaultKey string) (Source, error) {
+	ref, ok := strings.CutPrefix(s, "configmap:")
+	if !ok {
+		if len(s) == 0 {
+			return Source{}, fmt.Errorf("the source must be a file or configmap:<namespace>/<name>[/<key>]")
+		}
+		return Source{File: s}, nil
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) < 2 || len(parts) > 3 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return Source{}, fmt.Errorf("invalid source %q, must be configmap:<namespace>/<name>[/<key>]", s)
+	}
+	source := Source{ConfigMap: types.NamespacedName{Namespace: parts[0], Name: parts[1]}, Key: defaultKey}
+	if len(parts) == 3 {
+		if len(parts[2]) == 0 {
+			return Source{}, fmt.Errorf("invalid source %q, the key must not be empty", s)
+		}
+		source.Key = parts[2]
+	}
+	return source, nil
+}
+
+func (s Source) String() string {
+	if len(s.File) > 0 {
+		return s.File
+	}
+	return fmt.Sprintf("configmap:%s/%s", s.ConfigMap, s.Key)
+}
+
+// isConfigMap tells whether the source is a ConfigMap, which needs a client to be loaded.
+func (s Source) isConfigMap() bool {
+	return len(s.File) == 0
+}
+
+// watch calls the handler with the content of the source, or the error loading it, and again whenever it changes,
+// until the stop channel is closed. File sources are loaded once before watch returns.
+func (s Source) watch(kubeClientConfig *restclient.Config, stopCh <-chan struct{}, handler func(data []byte, err error)) error {
+	if !s.isConfigMap() {
+		interval := s.ReloadInterval
+		if interval <= 0 {
+			interval = DefaultReloadInterval
+		}
+		var last []byte
+		var lastErr error
+		load := func() {
+			data, err := os.ReadFile(s.File)
+			if err == nil && lastErr == nil && last != nil && bytes.Equal(data, last) {
+				return
+			}
+			if err != nil && lastErr != nil && err.Error() == lastErr.Error() {
+				return
+			}
+			last, lastErr = data, err
+			handler(data, err)
+		}
+		load()
+		go wait.Until(load, interval, stopCh)
+		return nil
+	}
+
+	if kubeClientConfig == nil {
+		return fmt.Errorf("%s: a client config is required to load ConfigMaps", s)
+	}
+	client, err := kubernetes.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	update := func(obj interface{}) {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		data, ok := configMap.Data[s.Key]
+		if !ok {
+			handler(nil, fmt.Errorf("%s: the ConfigMap has no key %q", s, s.Key))
+			return
+		}
+		handler([]byte(data), nil)
+	}
+	_, controller := cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: cache.NewListWatchFromClient(client.CoreV1().RESTClient(), "configmaps", s.ConfigMap.Namespace, fields.OneTermEqualSelector("metadata.name", s.ConfigMap.Name)),
+		ObjectType:    &corev1.ConfigMap{},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    update,
+			UpdateFunc: func(_, obj interface{}) { update(obj) },
+			DeleteFunc: func(interface{}) { handler(nil, fmt.Errorf("%s: the ConfigMap was deleted", s)) },
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go controller.RunWithContext(ctx)
+	return nil
+}
@@ -0,0 +1,226 @@
+package celadmission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/matching"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+)
+
+// DefaultValidationsKey is the key of the validations in ConfigMap sources by default.
+const DefaultValidationsKey = "validations.yaml"
+
+// Validations are the CEL validations of a ValidatingHook, in the YAML or JSON form of the fields of the spec of
+// a ValidatingAdmissionPolicy. The expressions are evaluated against object, oldObject, request, namespaceObject and
+// the variables. There are no params.
+type Validations struct {
+	// FailurePolicy is how errors evaluating the expressions are handled, Fail by default.
+	FailurePolicy *admissionregistrationv1.FailurePolicyType `json:"failurePolicy,omitempty"`
+	// MatchConditions must all be true for the validations to be evaluated. Other requests are allowed.
+	MatchConditions []admissionregistrationv1.MatchCondition `json:"matchConditions,omitempty"`
+	// Variables are named expressions available to the other expressions as variables.<name>.
+	Variables []admissionregistrationv1.Variable `json:"variables,omitempty"`
+	// Validations must all be true for the request to be allowed.
+	Validations []admissionregistrationv1.Validation `json:"validations,omitempty"`
+	// AuditAnnotations are added to the audit event of the request.
+	AuditAnnotations []admissionregistrationv1.AuditAnnotation `json:"auditAnnotations,omitempty"`
+}
+
+// ParseValidations parses validations in YAML or JSON. Unknown fields are rejected.
+func ParseValidations(data []byte) (*Validations, error) {
+	validations := &Validations{}
+	if err := yaml.UnmarshalStrict(data, validations); err != nil {
+		return nil, err
+	}
+	if len(validations.Validations) == 0 && len(validations.AuditAnnotations) == 0 {
+		return nil, fmt.Errorf("at least one of validations or auditAnnotations is required")
+	}
+	return validations, nil
+}
+
+// Compile compiles the expressions of the validations, returning all compilation errors.
+func (v *Validations) Compile(name string) (validating.Validator, error) {
+	return compileValidatingPolicy(&admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			FailurePolicy:    v.FailurePolicy,
+			MatchConditions:  v.MatchConditions,
+			Variables:        v.Variables,
+			Validations:      v.Validations,
+			AuditAnnotations: v.AuditAnnotations,
+		},
+	})
+}
+
+// ValidatingHookConfig configures a ValidatingHook.
+type ValidatingHookConfig struct {
+	// Resource is the resource the hook is served on.
+	Resource schema.GroupVersionResource
+	// Singular is the singular name of the resource, the resource without a trailing "s" by default.
+	Singular string
+	// Source is where the validations are loaded from.
+	Source Source
+}
+
+// ValidatingHook is a validating admission hook evaluating CEL validations loaded from a file or ConfigMap. The
+// validations are reloaded when the source changes. When they fail to load, the hook keeps the last validations
+// which did, and reports the error on readyz. Until validations are loaded, requests are denied.
+type ValidatingHook struct {
+	config ValidatingHookConfig
+
+	lock       sync.RWMutex
+	validator  validating.Validator
+	loadErr    error
+	namespaces *matching.Matcher
+}
+
+var _ interface {
+	apiserver.ValidatingAdmissionHookV1WithContext
+	apiserver.AdmissionHookWithReadyzChecks
+} = &ValidatingHook{}
+
+// NewValidatingHook returns a hook serving the validations of the source on the resource of the config.
+func NewValidatingHook(config ValidatingHookConfig) *ValidatingHook {
+	if len(config.Singular) == 0 {
+		config.Singular = singular(config.Resource.Resource)
+	}
+	return &ValidatingHook{config: config, loadErr: fmt.Errorf("%s: the validations are not loaded yet", config.Source)}
+}
+
+// Initialize starts loading the validations from the source, and the namespaces they are evaluated with.
+func (h *ValidatingHook) Initialize(kubeClientConfig *restclient.Config, stopCh <-chan struct{}) error {
+	client, err := kubernetes.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	return h.start(kubeClientConfig, client, stopCh)
+}
+
+func (h *ValidatingHook) start(kubeClientConfig *restclient.Config, client kubernetes.Interface, stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	h.lock.Lock()
+	h.namespaces = matching.NewMatcher(factory.Core().V1().Namespaces().Lister(), client)
+	h.lock.Unlock()
+	factory.Start(stopCh)
+	return h.config.Source.watch(kubeClientConfig, stopCh, h.load)
+}
+
+func (h *ValidatingHook) ValidatingResource() (plural schema.GroupVersionResource, singular string) {
+	return h.config.Resource, h.config.Singular
+}
+
+// Validate evaluates the validations against the request.
+func (h *ValidatingHook) Validate(ctx context.Context, request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	h.lock.RLock()
+	validator, loadErr, namespaces := h.validator, h.loadErr, h.namespaces
+	h.lock.RUnlock()
+	if validator == nil || namespaces == nil {
+		return errorResponse(request, apierrors.NewInternalError(loadErr))
+	}
+
+	attributes, err := apiserver.VersionedAttributes(request)
+	if err != nil {
+		return errorResponse(request, apierrors.NewBadRequest(err.Error()))
+	}
+	namespace, statusErr := namespaceObject(ctx, namespaces, request)
+	if statusErr != nil {
+		return errorResponse(request, statusErr)
+	}
+	result := validator.Validate(ctx, schema.GroupVersionResource(request.Resource), attributes, nil, namespace, celconfig.RuntimeCELCostBudget, nil)
+	v := &verdict{}
+	v.addResult(result, "")
+	return v.response(request)
+}
+
+// ReadyzChecks reports the error loading the validations, if the last attempt failed.
+func (h *ValidatingHook) ReadyzChecks() []healthz.HealthChecker {
+	gvr := h.config.Resource
+	return []healthz.HealthChecker{
+		healthz.NamedCheck("cel-validations-"+gvr.Resource+"."+gvr.Version+"."+gvr.Group, func(*http.Request) error {
+			h.lock.RLock()
+			defer h.lock.RUnlock()
+			return h.loadErr
+		}),
+	}
+}
+
+// load compiles the validations and serves them if they compile.
+func (h *ValidatingHook) load(data []byte, err error) {
+	var validator validating.Validator
+	if err == nil {
+		var validations *Validations
+		if validations, err = ParseValidations(data); err == nil {
+			validator, err = validations.Compile(h.config.Resource.GroupResource().String())
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if err != nil {
+		h.loadErr = fmt.Errorf("%s: failed to load validations: %w", h.config.Source, err)
+		klog.ErrorS(err, "Failed to load CEL validations, keeping the last ones", "resource", h.config.Resource.String(), "source", h.config.Source.String())
+		return
+	}
+	klog.InfoS("Loaded CEL validations", "resource", h.config.Resource.String(), "source", h.config.Source.String())
+	h.validator, h.loadErr = validator, nil
+}
+
+// namespaceGetter gets the namespaces of requests, like the matchers of the API server.
+type namespaceGetter interface {
+	GetNamespace(ctx context.Context, name string) (*corev1.Namespace, error)
+}
+
+// namespaceObject returns the namespace of the request, which CEL expressions see as namespaceObject. Like in the API
+// server, it is nil for cluster-scoped objects and for namespaces themselves. Status errors getting the namespace,
+// like NotFound, are returned as they are, other errors as internal errors.
+func namespaceObject(ctx context.Context, namespaces namespaceGetter, request *admissionv1.AdmissionRequest) (*corev1.Namespace, *apierrors.StatusError) {
+	if len(request.Namespace) == 0 || isNamespace(request.Kind) {
+		return nil, nil
+	}
+	namespace, err := namespaces.GetNamespace(ctx, request.Namespace)
+	if err != nil {
+		var statusErr *apierrors.StatusError
+		if !errors.As(err, &statusErr) {
+			statusErr = apierrors.NewInternalError(fmt.Errorf("failed to get namespace %s: %w", request.Namespace, err))
+		}
+		return nil, statusErr
+	}
+	return namespace, nil
+}
+
+// isNamespace tells whether the kind is the one of namespaces.
+func isNamespace(kind metav1.GroupVersionKind) bool {
+	return kind.Group == "" && kind.Version == "v1" && kind.Kind == "Namespace"
+}
+
+func errorResponse(request *admissionv1.AdmissionRequest, err *apierrors.StatusError) *admissionv1.AdmissionResponse {
+	status := err.Status()
+	return &admissionv1.AdmissionResponse{UID: request.UID, Allowed: false, Result: &status}
+}
+
+// singular returns the resource without a trailing "s".
+func singular(resource string) string {
+	if len(resource) > 1 && resource[len(resource)-1] == 's' {
+		return resource[:len(resource)-1]
+	}
+	return resource
+}
@@ -0,0 +1,271 @@
+package celadmission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const replicaValidations = `
+matchConditions:
+- name: not-exempt
+  expression: "!has(object.metadata.labels) || !('exempt' in object.metadata.labels)"
+variables:
+- name: replicas
+  expression: "has(object.spec.replicas) ? object.spec.replicas : 1"
+validations:
+- expression: "variables.replicas <= 10"
+  messageExpression: "'replicas must be at most 10, got ' + string(variables.replicas)"
+- expression: "request.operation != 'UPDATE' || object.spec.replicas >= oldObject.spec.replicas"
+  message: "replicas must not be scaled down"
+  reason: Forbidden
+- expression: "!has(namespaceObject.metadata.labels) || !('frozen' in namespaceObject.metadata.labels)"
+  message: "the namespace is frozen"
+  reason: Forbidden
+auditAnnotations:
+- key: replicas
+  valueExpression: "string(variables.replicas)"
+`
+
+var deploymentsGVR = schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "deploymentvalidators"}
+
+func deploymentRequest(t *testing.T, operation admissionv1.Operation, replicas int, labels map[string]string, oldReplicas int) *admissionv1.AdmissionRequest {
+	t.Helper()
+	deployment := func(replicas int) runtime.RawExtension {
+		metadata := map[string]interface{}{"name": "web", "namespace": "default"}
+		if labels != nil {
+			metadata["labels"] = labels
+		}
+		raw, err := json.Marshal(map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   metadata,
+			"spec":       map[string]interface{}{"replicas": replicas},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: raw}
+	}
+	request := &admissionv1.AdmissionRequest{
+		UID:       types.UID("uid-" + string(operation)),
+		Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Resource:  metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		Name:      "web",
+		Namespace: "default",
+		Operation: operation,
+		Object:    deployment(replicas),
+	}
+	if operation == admissionv1.Update {
+		request.OldObject = deployment(oldReplicas)
+	}
+	return request
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func startValidatingHook(t *testing.T, path string) *ValidatingHook {
+	t.Helper()
+	hook := NewValidatingHook(ValidatingHookConfig{Resource: deploymentsGVR, Source: Source{File: path, ReloadInterval: 10 * time.Millisecond}})
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	client := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "frozen", Labels: map[string]string{"frozen": "true"}}},
+	)
+	if err := hook.start(nil, client, stopCh); err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+func readyzError(hook *ValidatingHook) error {
+	checks := hook.ReadyzChecks()
+	req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+	return checks[0].Check(req)
+}
+
+func TestValidatingHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "validations.yaml")
+	writeFile(t, path, replicaValidations)
+	hook := startValidatingHook(t, path)
+
+	if gvr, singular := hook.ValidatingResource(); gvr != deploymentsGVR || singular != "deploymentvalidator" {
+		t.Errorf("unexpected resource %v %q", gvr, singular)
+	}
+	if name := hook.ReadyzChecks()[0].Name(); name != "cel-validations-deploymentvalidators.v1.admission.example.com" {
+		t.Errorf("unexpected readyz check name %q", name)
+	}
+	if err := readyzError(hook); err != nil {
+		t.Fatalf("unexpected readyz error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		request *admissionv1.AdmissionRequest
+		allowed bool
+		message string
+		code    int32
+		audit   string
+	}{
+		{
+			name:    "allowed",
+			request: deploymentRequest(t, admissionv1.Create, 3, nil, 0),
+			allowed: true,
+			audit:   "3",
+		},
+		{
+			name:    "message expression",
+			request: deploymentRequest(t, admissionv1.Create, 11, nil, 0),
+			message: "replicas must be at most 10, got 11",
+			code:    http.StatusUnprocessableEntity,
+			audit:   "11",
+		},
+		{
+			name:    "reason",
+			request: deploymentRequest(t, admissionv1.Update, 2, nil, 3),
+			message: "replicas must not be scaled down",
+			code:    http.StatusForbidden,
+			audit:   "2",
+		},
+		{
+			name: "namespace object",
+			request: func() *admissionv1.AdmissionRequest {
+				request := deploymentRequest(t, admissionv1.Create, 3, nil, 0)
+				request.Namespace = "frozen"
+				return request
+			}(),
+			message: "the namespace is frozen",
+			code:    http.StatusForbidden,
+			audit:   "3",
+		},
+		{
+			name: "unknown namespace",
+			request: func() *admissionv1.AdmissionRequest {
+				request := deploymentRequest(t, admissionv1.Create, 3, nil, 0)
+				request.Namespace = "missing"
+				return request
+			}(),
+			message: `namespaces "missing" not found`,
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "not matching",
+			request: deploymentRequest(t, admissionv1.Create, 11, map[string]string{"exempt": "true"}, 0),
+			allowed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := hook.Validate(context.Background(), tt.request)
+			if response.UID != tt.request.UID {
+				t.Errorf("expected UID %q, got %q", tt.request.UID, response.UID)
+			}
+			if response.Allowed != tt.allowed {
+				t.Fatalf("expected allowed %v, got %#v", tt.allowed, response)
+			}
+			if !tt.allowed {
+				if response.Result.Message != tt.message || response.Result.Code != tt.code {
+					t.Errorf("expected %d %q, got %d %q", tt.code, tt.message, response.Result.Code, response.Result.Message)
+				}
+			}
+			if response.AuditAnnotations["replicas"] != tt.audit {
+				t.Errorf("expected audit annotation %q, got %v", tt.audit, response.AuditAnnotations)
+			}
+		})
+	}
+}
+
+func TestValidatingHookReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "validations.yaml")
+	writeFile(t, path, replicaValidations)
+	hook := startValidatingHook(t, path)
+
+	request := deploymentRequest(t, admissionv1.Create, 8, nil, 0)
+	if response := hook.Validate(context.Background(), request); !response.Allowed {
+		t.Fatalf("expected the request to be allowed, got %v", response.Result)
+	}
+
+	writeFile(t, path, strings.ReplaceAll(replicaValidations, "<= 10", "<= 5"))
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		return !hook.Validate(ctx, request).Allowed, nil
+	}); err != nil {
+		t.Fatal("the changed validations were not loaded")
+	}
+
+	// validations which do not compile are reported on readyz, the last ones keep being served
+	writeFile(t, path, "validations:\n- expression: \"object.spec.replicas <=\"\n")
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return readyzError(hook) != nil, nil
+	}); err != nil {
+		t.Fatal("the compile error was not reported on readyz")
+	}
+	if err := readyzError(hook); !strings.Contains(err.Error(), "validations[0]") {
+		t.Errorf("expected the readyz error to name the validation, got %v", err)
+	}
+	if response := hook.Validate(context.Background(), request); response.Allowed {
+		t.Error("expected the last validations to be served")
+	}
+
+	writeFile(t, path, replicaValidations)
+	if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return readyzError(hook) == nil, nil
+	}); err != nil {
+		t.Fatal("the fixed validations were not loaded")
+	}
+}
+
+func TestValidatingHookNotLoaded(t *testing.T) {
+	hook := startValidatingHook(t, filepath.Join(t.TempDir(), "missing.yaml"))
+	if err := readyzError(hook); err == nil {
+		t.Error("expected a readyz error for a missing file")
+	}
+	response := hook.Validate(context.Background(), deploymentRequest(t, admissionv1.Create, 1, nil, 0))
+	if response.Allowed || response.Result.Code != http.StatusInternalServerError {
+		t.Errorf("expected an internal error, got %#v", response)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected Source
+		err      bool
+	}{
+		{source: "/etc/validations.yaml", expected: Source{File: "/etc/validations.yaml"}},
+		{source: "configmap:kube-system/rules", expected: Source{ConfigMap: types.NamespacedName{Namespace: "kube-system", Name: "rules"}, Key: "default.yaml"}},
+		{source: "configmap:kube-system/rules/replicas.yaml", expected: Source{ConfigMap: types.NamespacedName{Namespace: "kube-system", Name: "rules"}, Key: "replicas.yaml"}},
+		{source: "configmap:rules", err: true},
+		{source: "configmap:kube-system/rules/", err: true},
+		{source: "", err: true},
+	}
+	for _, tt := range tests {
+		source, err := ParseSource(tt.source, "default.yaml")
+		if (err != nil) != tt.err {
+			t.Errorf("%q: unexpected error %v", tt.source, err)
+			continue
+		}
+		if source != tt.expected {
+			t.Errorf("%q: expected %#v, got %#v", tt.source, tt.expected, source)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package celadmission
+
+import (
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+)
+
+// verdict accumulates the decisions of CEL validations into an admission response.
+type verdict struct {
+	denials          []string
+	reason           metav1.StatusReason
+	warnings         []string
+	auditAnnotations map[string]string
+}
+
+// addResult adds the decisions and audit annotations of a validation result. Denials are prefixed with the prefix,
+// if any.
+func (v *verdict) addResult(result validating.ValidateResult, prefix string) {
+	for _, decision := range result.Decisions {
+		if decision.Action != validating.ActionDeny {
+			continue
+		}
+		v.deny(prefix+decisionMessage(decision), decisionReason(decision))
+	}
+	for _, annotation := range result.AuditAnnotations {
+		switch annotation.Action {
+		case validating.AuditAnnotationActionPublish:
+			v.annotate(annotation.Key, annotation.Value)
+		case validating.AuditAnnotationActionError:
+			v.deny(prefix+"failed to evaluate audit annotation "+annotation.Key+": "+annotation.Error, metav1.StatusReasonInternalError)
+		}
+	}
+}
+
+// deny adds a denial. The reason of the response is the one of the first denial.
+func (v *verdict) deny(message string, reason metav1.StatusReason) {
+	if len(v.denials) == 0 {
+		v.reason = reason
+	}
+	v.denials = append(v.denials, message)
+}
+
+func (v *verdict) warn(message string) {
+	v.warnings = append(v.warnings, message)
+}
+
+func (v *verdict) annotate(key, value string) {
+	if v.auditAnnotations == nil {
+		v.auditAnnotations = map[string]string{}
+	}
+	v.auditAnnotations[key] = value
+}
+
+// response returns the admission response to the request, denying it if there are any denials.
+func (v *verdict) response(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{
+		UID:              request.UID,
+		Allowed:          len(v.denials) == 0,
+		Warnings:         v.warnings,
+		AuditAnnotations: v.auditAnnotations,
+	}
+	if !response.Allowed {
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: strings.Join(v.denials, "; "),
+			Reason:  v.reason,
+			Code:    reasonToCode(v.reason),
+		}
+	}
+	return response
+}
+
+func decisionMessage(decision validating.PolicyDecision) string {
+	if decision.Evaluation == validating.EvalError {
+		return "failed to evaluate validation: " + decision.Message
+	}
+	return decision.Message
+}
+
+func decisionReason(decision validating.PolicyDecision) metav1.StatusReason {
+	switch {
+	case len(decision.Reason) > 0:
+		return decision.Reason
+	case decision.Evaluation == validating.EvalError:
+		return metav1.StatusReasonInternalError
+	default:
+		return metav1.StatusReasonInvalid
+	}
+}
+
+// reasonToCode returns the HTTP status code of the reason of a denial, like the ValidatingAdmissionPolicy plugin.
+func reasonToCode(reason metav1.StatusReason) int32 {
+	switch reason {
+	case metav1.StatusReasonForbidden:
+		return http.StatusForbidden
+	case metav1.StatusReasonUnauthorized:
+		return http.StatusUnauthorized
+	case metav1.StatusReasonRequestEntityTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case metav1.StatusReasonInvalid:
+		return http.StatusUnprocessableEntity
+	case metav1.StatusReasonInternalError:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// EnforcementOptions set the enforcement modes of the admission hooks by the resource they are served on, in the
+// form resource.version.group.
+type EnforcementOptions struct {
+	// ConfigFile is a YAML or JSON file of the form
+	//
+	//	enforcementModes:
+	//	  namespacereservations.v1.admission.online.openshift.io: warn
+	ConfigFile string
+	// Modes take precedence over the modes of the config file.
+	Modes map[string]string
+}
+
+// EnforcementConfig is the content of the enforcement config file.
+type EnforcementConfig struct {
+	EnforcementModes map[string]string `json:"enforcementModes"`
+}
+
+func NewEnforcementOptions() *EnforcementOptions {
+	return &EnforcementOptions{Modes: map[string]string{}}
+}
+
+func (o *EnforcementOptions) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+	fs.StringVar(&o.ConfigFile, "enforcement-config-file", o.ConfigFile, "A YAML file with the enforcement modes of the admission hooks under enforcementModes, by hook resource in the form resource.version.group.")
+	fs.StringToStringVar(&o.Modes, "enforcement-mode", o.Modes, "The enforcement mode of an admission hook in the form resource.version.group=mode. The mode is enforce, warn to turn denials into warnings, or audit to only record denials in metrics and the decision log. Overrides --enforcement-config-file.")
+}
+
+func (o *EnforcementOptions) Validate() []error {
+	if o == nil {
+		return nil
+	}
+	if _, err := o.EnforcementModes(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// EnforcementModes returns the enforcement modes of the config file and the flags.
+func (o *EnforcementOptions) EnforcementModes() (map[schema.GroupVersionResource]admissionreview.EnforcementMode, error) {
+	if o == nil {
+		return nil, nil
+	}
+	byName := map[string]string{}
+	if len(o.ConfigFile) > 0 {
+		data, err := os.ReadFile(o.ConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --enforcement-config-file: %w", err)
+		}
+		config := EnforcementConfig{}
+		if err := yaml.UnmarshalStrict(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse --enforcement-config-file %s: %w", o.ConfigFile, err)
+		}
+		for name, mode := range config.EnforcementModes {
+			byName[name] = mode
+		}
+	}
+	for name, mode := range o.Modes {
+		byName[name] = mode
+	}
+
+	modes := map[schema.GroupVersionResource]admissionreview.EnforcementMode{}
+	for name, s := range byName {
+		gvr, _ := schema.ParseResourceArg(name)
+		if gvr == nil {
+			return nil, fmt.Errorf("invalid hook resource %q for enforcement mode, must be of the form resource.version.group", name)
+		}
+		mode, err := admissionreview.ParseEnforcementMode(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		modes[*gvr] = mode
+	}
+	return modes, nil
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// ExemptionOptions exempt admission requests from all admission hooks, by namespace, user, group or service
+// account. Servers can set defaults before the flags are added, e.g. to always exempt kube-system.
+type ExemptionOptions struct {
+	Namespaces      []string
+	Users           []string
+	Groups          []string
+	ServiceAccounts []string
+}
+
+func NewExemptionOptions() *ExemptionOptions {
+	return &ExemptionOptions{}
+}
+
+func (o *ExemptionOptions) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+	fs.StringSliceVar(&o.Namespaces, "exempt-namespaces", o.Namespaces, "Allow the requests in these namespaces without calling any admission hook. Namespaces are glob patterns, like openshift-*.")
+	fs.StringSliceVar(&o.Users, "exempt-users", o.Users, "Allow the requests of these users without calling any admission hook.")
+	fs.StringSliceVar(&o.Groups, "exempt-groups", o.Groups, "Allow the requests of users in these groups without calling any admission hook.")
+	fs.StringSliceVar(&o.ServiceAccounts, "exempt-service-accounts", o.ServiceAccounts, "Allow the requests of these service accounts without calling any admission hook, in the form namespace/name. Names are glob patterns, like kube-system/*.")
+}
+
+func (o *ExemptionOptions) Validate() []error {
+	if o == nil {
+		return nil
+	}
+	if _, err := o.Exemptions(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// Exemptions returns the exemptions of the options, or nil if there are none.
+func (o *ExemptionOptions) Exemptions() (*admissionreview.Exemptions, error) {
+	if o == nil || len(o.Namespaces)+len(o.Users)+len(o.Groups)+len(o.ServiceAccounts) == 0 {
+		return nil, nil
+	}
+	exemptions := &admissionreview.Exemptions{
+		Namespaces:      o.Namespaces,
+		Users:           o.Users,
+		Groups:          o.Groups,
+		ServiceAccounts: o.ServiceAccounts,
+	}
+	if err := exemptions.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid exemptions: %w", err)
+	}
+	return exemptions, nil
+}
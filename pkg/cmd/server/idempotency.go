@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+)
+
+// IdempotencyOptions check mutating admission hooks for idempotency with a corpus of objects.
+type IdempotencyOptions struct {
+	AdmissionHooks []apiserver.AdmissionHook
+
+	ResourcePath string
+	Operation    string
+	Kubeconfig   string
+
+	Out io.Writer
+}
+
+func NewIdempotencyOptions(out io.Writer, admissionHooks ...apiserver.AdmissionHook) *IdempotencyOptions {
+	return &IdempotencyOptions{
+		AdmissionHooks: admissionHooks,
+		Operation:      string(admissionv1.Create),
+		Out:            out,
+	}
+}
+
+// NewCommandIdempotency provides the 'idempotency' command checking that a mutating admission hook does not change
+// the objects it already mutated.
+func NewCommandIdempotency(out io.Writer, admissionHooks ...apiserver.AdmissionHook) *cobra.Command {
+	o := NewIdempotencyOptions(out, admissionHooks...)
+
+	cmd := &cobra.Command{
+		Use:   "idempotency --path /apis/<group>/<version>/<resource> FILE...",
+		Short: "Check a mutating admission hook for idempotency",
+		Long: "Run the objects in the JSON or YAML files through the mutating admission hook served on the given path, " +
+			"in process, and a second time with the patch of the first run applied, like the API server does when it " +
+			"reinvokes a webhook. The command prints the changes of the second run and fails if there are any.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Validate(args); err != nil {
+				return err
+			}
+			return o.Run(c.Context(), args)
+		},
+	}
+	// a non-idempotent object is reported on its own, the usage does not help
+	cmd.SilenceUsage = true
+
+	o.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func (o *IdempotencyOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.ResourcePath, "path", o.ResourcePath, "The path of the mutating admission hook to check, /apis/<group>/<version>/<resource>.")
+	fs.StringVar(&o.Operation, "operation", o.Operation, "The operation of the admission requests, CREATE or UPDATE. Updates are from each object to itself.")
+	fs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "Initialize the admission hooks with this kubeconfig. By default the hooks are not initialized.")
+}
+
+func (o *IdempotencyOptions) Validate(args []string) error {
+	if _, err := o.mutatingHook(); err != nil {
+		return err
+	}
+	if o.Operation != string(admissionv1.Create) && o.Operation != string(admissionv1.Update) {
+		return fmt.Errorf("--operation must be CREATE or UPDATE, got %q", o.Operation)
+	}
+	return nil
+}
+
+// mutatingHook returns the mutating admission hook served on the path.
+func (o *IdempotencyOptions) mutatingHook() (apiserver.MutatingAdmissionHook, error) {
+	resource, err := apiserver.ParseResourcePath(o.ResourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("--path: %w", err)
+	}
+	for _, hook := range o.AdmissionHooks {
+		if mutatingHook, ok := hook.(apiserver.MutatingAdmissionHook); ok {
+			if gvr, _ := mutatingHook.MutatingResource(); gvr == resource {
+				return mutatingHook, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("--path: no mutating admission hook is served on %s", o.ResourcePath)
+}
+
+func (o *IdempotencyOptions) Run(ctx context.Context, files []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	hook, err := o.mutatingHook()
+	if err != nil {
+		return err
+	}
+	if len(o.Kubeconfig) > 0 {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		config, err := getClientConfig(o.Kubeconfig)
+		if err != nil {
+			return err
+		}
+		if err := hook.Initialize(config, stopCh); err != nil {
+			return fmt.Errorf("failed to initialize admission hook %T: %w", hook, err)
+		}
+	}
+
+	var objects []*unstructured.Unstructured
+	for _, file := range files {
+		objs, err := readObjects(file)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, objs...)
+	}
+
+	results, err := apiserver.CheckIdempotency(ctx, hook, admissionv1.Operation(o.Operation), objects...)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		name := result.ObjectName()
+		switch {
+		case len(result.Denied) > 0:
+			fmt.Fprintf(o.Out, "%s: denied: %s\n", name, result.Denied)
+		case result.Idempotent():
+			fmt.Fprintf(o.Out, "%s: idempotent\n", name)
+		default:
+			failed++
+			fmt.Fprintf(o.Out, "%s: not idempotent, the second run changes:\n", name)
+			for _, diff := range result.Diff {
+				fmt.Fprintf(o.Out, "  %s\n", diff)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects are not idempotent", failed, len(results))
+	}
+	return nil
+}
+
+// readObjects reads the objects of a JSON or YAML file, which may contain several YAML documents and lists.
+func readObjects(file string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	var objects []*unstructured.Unstructured
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if len(obj.GetKind()) == 0 || len(obj.GetAPIVersion()) == 0 {
+			return nil, fmt.Errorf("%s: every object must have an apiVersion and a kind", file)
+		}
+		if strings.HasSuffix(obj.GetKind(), "List") && obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+		objects = append(objects, obj)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	restclient "k8s.io/client-go/rest"
+)
+
+// testCountingHook counts its calls for an object in an annotation, which is not idempotent.
+type testCountingHook struct{}
+
+func (testCountingHook) Initialize(*restclient.Config, <-chan struct{}) error { return nil }
+
+func (testCountingHook) MutatingResource() (schema.GroupVersionResource, string) {
+	return schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "counters"}, "counter"
+}
+
+func (testCountingHook) Admit(_ context.Context, req *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	obj := struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(req.Object.Raw, &obj); err != nil {
+		return nil, err
+	}
+	count, _ := strconv.Atoi(obj.Metadata.Annotations["count"])
+	patchType := admissionv1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{
+		Allowed:   true,
+		Patch:     []byte(`[{"op":"add","path":"/metadata/annotations","value":{"count":"` + strconv.Itoa(count+1) + `"}}]`),
+		PatchType: &patchType,
+	}, nil
+}
+
+const testObjects = `apiVersion: v1
+kind: ConfigMap
+metadata: {name: foo, namespace: default}
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: bar, namespace: default}
+`
+
+func runIdempotency(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	cmd := NewCommandIdempotency(out, testMutatingHook{}, testCountingHook{}, testHook{})
+	cmd.SetArgs(args)
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestIdempotency(t *testing.T) {
+	objects := writeFile(t, "objects.yaml", testObjects)
+
+	out, err := runIdempotency("--path=/apis/admission.example.com/v1/labelers", objects)
+	if err != nil {
+		t.Fatalf("expected the labeler to be idempotent: %v\n%s", err, out)
+	}
+	if want := "ConfigMap default/foo: idempotent\nConfigMap default/bar: idempotent\n"; out != want {
+		t.Errorf("expected output %q, got %q", want, out)
+	}
+
+	out, err = runIdempotency("--path=/apis/admission.example.com/v1/counters", "--operation=UPDATE", objects)
+	if err == nil || err.Error() != "2 of 2 objects are not idempotent" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if want := `ConfigMap default/foo: not idempotent, the second run changes:
+  /metadata/annotations/count: "1" -> "2"
+`; !strings.HasPrefix(out, want) {
+		t.Errorf("expected output to start with %q, got %q", want, out)
+	}
+}
+
+func TestIdempotencyValidation(t *testing.T) {
+	objects := writeFile(t, "objects.yaml", testObjects)
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"--path=/apis/admission.example.com/v1/checks", objects}, want: "no mutating admission hook is served on /apis/admission.example.com/v1/checks"},
+		{args: []string{"--path=/apis/admission.example.com/v1/labelers", "--operation=DELETE", objects}, want: "--operation must be CREATE or UPDATE"},
+	} {
+		if _, err := runIdempotency(c.args...); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%v: expected an error containing %q, got %v", c.args, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+)
+
+const manifestsSecurePort = 8443
+
+const (
+	// servingCertSecretAnnotation makes the service CA write a serving certificate for the Service into the secret.
+	servingCertSecretAnnotation = "service.beta.openshift.io/serving-cert-secret-name"
+	// injectCABundleAnnotation makes the service CA inject its CA bundle into the APIService or ConfigMap.
+	injectCABundleAnnotation = "service.beta.openshift.io/inject-cabundle"
+
+	servingCertDir = "/var/run/serving-cert"
+	serviceCADir   = "/var/run/service-ca"
+)
+
+// ManifestsOptions render the manifests deploying the admission server with its hooks.
+type ManifestsOptions struct {
+	AdmissionHooks []apiserver.AdmissionHook
+
+	Name      string
+	Namespace string
+	Image     string
+	Replicas  int32
+
+	// Register lets the server register itself with --register instead of rendering the APIServices and webhook
+	// configurations.
+	Register bool
+
+	// WebhookCAFile is the CA bundle verifying the Kubernetes API server, which the rendered webhooks call to reach
+	// the admission server. It is required without --register, as the service CA does not inject into webhooks.
+	WebhookCAFile string
+
+	GroupPriorityMinimum int32
+	VersionPriority      int32
+
+	Out io.Writer
+}
+
+func NewManifestsOptions(out io.Writer, admissionHooks ...apiserver.AdmissionHook) *ManifestsOptions {
+	return &ManifestsOptions{
+		AdmissionHooks:       admissionHooks,
+		Replicas:             2,
+		GroupPriorityMinimum: 1000,
+		VersionPriority:      15,
+		Out:                  out,
+	}
+}
+
+// NewCommandManifests provides the 'manifests' command printing the deployment manifests of the admission hooks.
+func NewCommandManifests(out io.Writer, admissionHooks ...apiserver.AdmissionHook) *cobra.Command {
+	o := NewManifestsOptions(out, admissionHooks...)
+
+	cmd := &cobra.Command{
+		Use:   "manifests",
+		Short: "Print the manifests deploying the admission server",
+		Long: "Print the APIServices, webhook configurations, RBAC, Service and Deployment skeleton of the admission server, " +
+			"derived from its admission hooks. The serving certificate shared by all replicas and the CA bundle of the APIServices " +
+			"are provided by the OpenShift service CA. The webhooks call the Kubernetes API server, which is verified by --webhook-ca-file.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	o.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func (o *ManifestsOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Name, "name", o.Name, "The name of the admission server, used for its Deployment, Service, service account, RBAC and webhook configurations.")
+	fs.StringVar(&o.Namespace, "namespace", o.Namespace, "The namespace the admission server is deployed to.")
+	fs.StringVar(&o.Image, "image", o.Image, "The image of the admission server.")
+	fs.Int32Var(&o.Replicas, "replicas", o.Replicas, "The number of replicas of the admission server.")
+	fs.BoolVar(&o.Register, "register", o.Register, "Run the admission server with --register, which writes the APIServices and webhook configurations itself, instead of printing them.")
+	fs.StringVar(&o.WebhookCAFile, "webhook-ca-file", o.WebhookCAFile, "The CA bundle verifying the Kubernetes API server, written to the webhooks, which reach the admission server through it. Required without --register, e.g. the service account CA at /var/run/secrets/kubernetes.io/serviceaccount/ca.crt.")
+	fs.Int32Var(&o.GroupPriorityMinimum, "group-priority-minimum", o.GroupPriorityMinimum, "The group priority minimum of the APIServices.")
+	fs.Int32Var(&o.VersionPriority, "version-priority", o.VersionPriority, "The version priority of the APIServices.")
+}
+
+func (o *ManifestsOptions) Validate() error {
+	if len(o.Name) == 0 || len(o.Namespace) == 0 || len(o.Image) == 0 {
+		return fmt.Errorf("--name, --namespace and --image are required")
+	}
+	if !o.Register && len(o.WebhookCAFile) == 0 {
+		return fmt.Errorf("--webhook-ca-file is required without --register")
+	}
+	return apiserver.ValidateAdmissionHooks(o.AdmissionHooks...)
+}
+
+func (o *ManifestsOptions) Run() error {
+	objects, err := o.Objects()
+	if err != nil {
+		return err
+	}
+	for i, obj := range objects {
+		data, err := manifestYAML(obj)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := fmt.Fprintln(o.Out, "---"); err != nil {
+				return err
+			}
+		}
+		if _, err := o.Out.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Objects returns the objects deploying the admission server.
+func (o *ManifestsOptions) Objects() ([]runtime.Object, error) {
+	labels := map[string]string{"app": o.Name}
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: o.Namespace, Labels: labels}
+	}
+	serviceAccount := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: o.Namespace, Name: o.Name}
+	service := meta(o.Name)
+	service.Annotations = map[string]string{servingCertSecretAnnotation: o.servingCertName()}
+
+	objects := []runtime.Object{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: meta(o.Name),
+		},
+		// delegated authentication and authorization of the requests of the Kubernetes API server
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: o.Name + ":system:auth-delegator", Labels: labels},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "system:auth-delegator"},
+			Subjects:   []rbacv1.Subject{serviceAccount},
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta: metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      o.Name + ":extension-apiserver-authentication-reader",
+				Namespace: metav1.NamespaceSystem,
+				Labels:    labels,
+			},
+			RoleRef:  rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "extension-apiserver-authentication-reader"},
+			Subjects: []rbacv1.Subject{serviceAccount},
+		},
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: o.Name, Labels: labels},
+			Rules:      o.clusterRoleRules(),
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: o.Name, Labels: labels},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: o.Name},
+			Subjects:   []rbacv1.Subject{serviceAccount},
+		},
+		&corev1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: service,
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports: []corev1.ServicePort{{
+					Name:       "https",
+					Port:       443,
+					TargetPort: intstr.FromInt32(manifestsSecurePort),
+				}},
+			},
+		},
+	}
+
+	if o.Register {
+		// the CA bundle of the service CA, which the server writes to the APIServices it registers
+		serviceCA := meta(o.serviceCAName())
+		serviceCA.Annotations = map[string]string{injectCABundleAnnotation: "true"}
+		return append(objects,
+			&corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: serviceCA,
+			},
+			o.deployment(meta(o.Name), labels),
+		), nil
+	}
+	objects = append(objects, o.deployment(meta(o.Name), labels))
+	config, err := o.registrationConfig()
+	if err != nil {
+		return nil, err
+	}
+	registration := apiserver.BuildRegistrationObjects(config, nil, o.AdmissionHooks...)
+	for _, apiService := range registration.APIServices {
+		apiService.SetAnnotations(map[string]string{injectCABundleAnnotation: "true"})
+		objects = append(objects, apiService)
+	}
+	if registration.ValidatingWebhookConfiguration != nil {
+		objects = append(objects, registration.ValidatingWebhookConfiguration)
+	}
+	if registration.MutatingWebhookConfiguration != nil {
+		objects = append(objects, registration.MutatingWebhookConfiguration)
+	}
+	return objects, nil
+}
+
+// servingCertName is the name of the secret the service CA writes the serving certificate of all replicas to.
+func (o *ManifestsOptions) servingCertName() string {
+	return o.Name + "-serving-cert"
+}
+
+// serviceCAName is the name of the ConfigMap the service CA injects its CA bundle into.
+func (o *ManifestsOptions) serviceCAName() string {
+	return o.Name + "-service-ca"
+}
+
+func (o *ManifestsOptions) registrationConfig() (apiserver.RegistrationConfig, error) {
+	config := apiserver.RegistrationConfig{
+		Name:                 o.Name,
+		ServiceNamespace:     o.Namespace,
+		ServiceName:          o.Name,
+		ServicePort:          443,
+		GroupPriorityMinimum: o.GroupPriorityMinimum,
+		VersionPriority:      o.VersionPriority,
+	}
+	if len(o.WebhookCAFile) > 0 {
+		caBundle, err := os.ReadFile(o.WebhookCAFile)
+		if err != nil {
+			return config, fmt.Errorf("failed to read --webhook-ca-file: %w", err)
+		}
+		config.WebhookCABundle = caBundle
+	}
+	return config, nil
+}
+
+func (o *ManifestsOptions) clusterRoleRules() []rbacv1.PolicyRule {
+	rules := []rbacv1.PolicyRule{{
+		// API priority and fairness of the generic API server
+		APIGroups: []string{"flowcontrol.apiserver.k8s.io"},
+		Resources: []string{"flowschemas", "prioritylevelconfigurations"},
+		Verbs:     []string{"get", "list", "watch"},
+	}}
+	if apiserver.NeedsNamespaces(o.AdmissionHooks...) {
+		// namespace selectors of match criteria
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"namespaces"},
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+	if o.Register {
+		rules = append(rules,
+			rbacv1.PolicyRule{
+				APIGroups: []string{"apiregistration.k8s.io"},
+				Resources: []string{"apiservices"},
+				Verbs:     []string{"get", "create", "patch", "update"},
+			},
+			rbacv1.PolicyRule{
+				APIGroups: []string{"admissionregistration.k8s.io"},
+				Resources: []string{"validatingwebhookconfigurations", "mutatingwebhookconfigurations"},
+				Verbs:     []string{"get", "create", "patch", "update"},
+			},
+		)
+	}
+	return rules
+}
+
+func (o *ManifestsOptions) deployment(meta metav1.ObjectMeta, labels map[string]string) *appsv1.Deployment {
+	args := []string{
+		fmt.Sprintf("--secure-port=%d", manifestsSecurePort),
+		"--tls-cert-file=" + servingCertDir + "/tls.crt",
+		"--tls-private-key-file=" + servingCertDir + "/tls.key",
+	}
+	volumes := []corev1.Volume{{
+		Name:         "serving-cert",
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: o.servingCertName()}},
+	}}
+	volumeMounts := []corev1.VolumeMount{{Name: "serving-cert", MountPath: servingCertDir, ReadOnly: true}}
+	if o.Register {
+		args = append(args,
+			"--register",
+			"--registration-name="+o.Name,
+			"--registration-service-namespace="+o.Namespace,
+			"--registration-service-name="+o.Name,
+			"--registration-apiservice-ca-file="+serviceCADir+"/service-ca.crt",
+		)
+		volumes = append(volumes, corev1.Volume{
+			Name: "service-ca",
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: o.serviceCAName()},
+			}},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: "service-ca", MountPath: serviceCADir, ReadOnly: true})
+	}
+	probe := func(path string) *corev1.Probe {
+		return &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+			Path:   path,
+			Port:   intstr.FromInt32(manifestsSecurePort),
+			Scheme: corev1.URISchemeHTTPS,
+		}}}
+	}
+
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"},
+		ObjectMeta: meta,
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To(o.Replicas),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: o.Name,
+					Containers: []corev1.Container{{
+						Name:           "server",
+						Image:          o.Image,
+						Args:           args,
+						Ports:          []corev1.ContainerPort{{Name: "https", ContainerPort: manifestsSecurePort}},
+						VolumeMounts:   volumeMounts,
+						ReadinessProbe: probe("/readyz"),
+						LivenessProbe:  probe("/livez"),
+						SecurityContext: &corev1.SecurityContext{
+							AllowPrivilegeEscalation: ptr.To(false),
+							RunAsNonRoot:             ptr.To(true),
+							Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+						},
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+// manifestYAML returns the YAML of the object without the empty creation timestamps and status of typed objects.
+func manifestYAML(obj runtime.Object) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	delete(m, "status")
+	if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	return yaml.Marshal(m)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+type testHook struct{}
+
+func (testHook) Initialize(*restclient.Config, <-chan struct{}) error { return nil }
+
+func (testHook) ValidatingResource() (schema.GroupVersionResource, string) {
+	return schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "checks"}, "check"
+}
+
+func (testHook) Validate(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	return nil, nil
+}
+
+func (testHook) ValidatingWebhook() admissionregistrationv1.ValidatingWebhook {
+	return admissionregistrationv1.ValidatingWebhook{}
+}
+
+func renderManifests(t *testing.T, args ...string) []map[string]interface{} {
+	t.Helper()
+	out := &bytes.Buffer{}
+	cmd := NewCommandManifests(out, testHook{})
+	cmd.SetArgs(append([]string{"--name=checker", "--namespace=checks", "--image=example.com/checker:latest"}, args...))
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	var objects []map[string]interface{}
+	for _, doc := range strings.Split(out.String(), "\n---\n") {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			t.Fatalf("invalid manifest %q: %v", doc, err)
+		}
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+func kinds(objects []map[string]interface{}) []string {
+	var kinds []string
+	for _, obj := range objects {
+		kinds = append(kinds, obj["kind"].(string))
+	}
+	return kinds
+}
+
+func TestManifests(t *testing.T) {
+	caBundle := []byte("-----BEGIN CERTIFICATE-----\nkube-apiserver-ca\n-----END CERTIFICATE-----\n")
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, caBundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	objects := renderManifests(t, "--webhook-ca-file="+caFile)
+	want := "ServiceAccount ClusterRoleBinding RoleBinding ClusterRole ClusterRoleBinding Service Deployment APIService ValidatingWebhookConfiguration"
+	if got := strings.Join(kinds(objects), " "); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	apiService := objects[7]
+	if name := apiService["metadata"].(map[string]interface{})["name"]; name != "v1.admission.example.com" {
+		t.Errorf("unexpected APIService %v", name)
+	}
+	if !strings.Contains(mustYAML(t, apiService), "service.beta.openshift.io/inject-cabundle") {
+		t.Errorf("expected the APIService CA bundle to be injected by the service CA")
+	}
+	if !strings.Contains(mustYAML(t, objects[5]), "service.beta.openshift.io/serving-cert-secret-name: checker-serving-cert") {
+		t.Errorf("expected the service CA to write the serving certificate of the Service")
+	}
+	deployment := mustYAML(t, objects[6])
+	for _, want := range []string{"--tls-cert-file=/var/run/serving-cert/tls.crt", "--tls-private-key-file=/var/run/serving-cert/tls.key", "secretName: checker-serving-cert"} {
+		if !strings.Contains(deployment, want) {
+			t.Errorf("expected the deployment to serve the shared serving certificate with %s", want)
+		}
+	}
+	webhooks := objects[8]["webhooks"].([]interface{})
+	clientConfig := webhooks[0].(map[string]interface{})["clientConfig"].(map[string]interface{})
+	if path := clientConfig["service"].(map[string]interface{})["path"]; path != "/apis/admission.example.com/v1/checks" {
+		t.Errorf("unexpected webhook path %v", path)
+	}
+	if got, want := clientConfig["caBundle"], base64.StdEncoding.EncodeToString(caBundle); got != want {
+		t.Errorf("expected the webhook to verify the Kubernetes API server with the CA bundle of --webhook-ca-file, got %v", got)
+	}
+	for _, obj := range objects {
+		if _, ok := obj["status"]; ok {
+			t.Errorf("expected no status in %v", obj["kind"])
+		}
+	}
+}
+
+func TestManifestsWithRegistration(t *testing.T) {
+	objects := renderManifests(t, "--register")
+	want := "ServiceAccount ClusterRoleBinding RoleBinding ClusterRole ClusterRoleBinding Service ConfigMap Deployment"
+	if got := strings.Join(kinds(objects), " "); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if !strings.Contains(mustYAML(t, objects[6]), "service.beta.openshift.io/inject-cabundle") {
+		t.Errorf("expected the service CA to inject its CA bundle into the ConfigMap")
+	}
+	deployment := mustYAML(t, objects[7])
+	for _, want := range []string{"--register", "--registration-apiservice-ca-file=/var/run/service-ca/service-ca.crt", "name: checker-service-ca"} {
+		if !strings.Contains(deployment, want) {
+			t.Errorf("expected the deployment to run the server with %s", want)
+		}
+	}
+	if !strings.Contains(mustYAML(t, objects[3]), "apiservices") {
+		t.Errorf("expected the cluster role to allow writing APIServices")
+	}
+}
+
+func TestManifestsRequireWebhookCA(t *testing.T) {
+	cmd := NewCommandManifests(&bytes.Buffer{}, testHook{})
+	cmd.SetArgs([]string{"--name=checker", "--namespace=checks", "--image=example.com/checker:latest"})
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--webhook-ca-file") {
+		t.Errorf("expected --webhook-ca-file to be required without --register, got %v", err)
+	}
+}
+
+func mustYAML(t *testing.T, obj interface{}) string {
+	t.Helper()
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
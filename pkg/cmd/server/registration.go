@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+)
+
+// RegistrationOptions configure the registration of the server and its hooks on startup.
+type RegistrationOptions struct {
+	Enabled bool
+
+	Name             string
+	ServiceNamespace string
+	ServiceName      string
+	ServicePort      int32
+
+	GroupPriorityMinimum int32
+	VersionPriority      int32
+
+	APIServiceCAFile string
+	WebhookCAFile    string
+	ResyncPeriod     time.Duration
+}
+
+func NewRegistrationOptions() *RegistrationOptions {
+	return &RegistrationOptions{
+		ServicePort:          443,
+		GroupPriorityMinimum: 1000,
+		VersionPriority:      15,
+		ResyncPeriod:         10 * time.Minute,
+	}
+}
+
+func (o *RegistrationOptions) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+	fs.BoolVar(&o.Enabled, "register", o.Enabled, "Create or update the APIServices of the served group versions and the webhook configurations of the hooks declaring webhooks on startup, and keep them up to date.")
+	fs.StringVar(&o.Name, "registration-name", o.Name, "The name of the ValidatingWebhookConfiguration and MutatingWebhookConfiguration written with --register.")
+	fs.StringVar(&o.ServiceNamespace, "registration-service-namespace", o.ServiceNamespace, "The namespace of the Service of the server, which the APIServices point to.")
+	fs.StringVar(&o.ServiceName, "registration-service-name", o.ServiceName, "The name of the Service of the server, which the APIServices point to.")
+	fs.Int32Var(&o.ServicePort, "registration-service-port", o.ServicePort, "The port of the Service of the server, which the APIServices point to.")
+	fs.Int32Var(&o.GroupPriorityMinimum, "registration-group-priority-minimum", o.GroupPriorityMinimum, "The group priority minimum of the APIServices.")
+	fs.Int32Var(&o.VersionPriority, "registration-version-priority", o.VersionPriority, "The version priority of the APIServices.")
+	fs.StringVar(&o.APIServiceCAFile, "registration-apiservice-ca-file", o.APIServiceCAFile, "The CA bundle verifying the serving certificates of all replicas of the server, written to the APIServices. The server does not register if its serving certificate is not verified by it. If unset, the CA bundle of the APIServices is left to be injected, e.g. by the service CA.")
+	fs.StringVar(&o.WebhookCAFile, "registration-webhook-ca-file", o.WebhookCAFile, "The CA bundle verifying the Kubernetes API server, which the webhooks call back to. Defaults to the CA of the client config of the server.")
+	fs.DurationVar(&o.ResyncPeriod, "registration-resync-period", o.ResyncPeriod, "The period in which the registration objects are written again.")
+}
+
+func (o *RegistrationOptions) Validate() []error {
+	if o == nil || !o.Enabled {
+		return nil
+	}
+	var errs []error
+	if len(o.Name) == 0 {
+		errs = append(errs, fmt.Errorf("--registration-name is required with --register"))
+	}
+	if len(o.ServiceNamespace) == 0 || len(o.ServiceName) == 0 {
+		errs = append(errs, fmt.Errorf("--registration-service-namespace and --registration-service-name are required with --register"))
+	}
+	if o.ServicePort < 1 || o.ServicePort > 65535 {
+		errs = append(errs, fmt.Errorf("--registration-service-port must be a port number, got %d", o.ServicePort))
+	}
+	return errs
+}
+
+// RegistrationConfig returns the registration config of the options, or nil if registration is not enabled.
+func (o *RegistrationOptions) RegistrationConfig() (*apiserver.RegistrationConfig, error) {
+	if o == nil || !o.Enabled {
+		return nil, nil
+	}
+	config := &apiserver.RegistrationConfig{
+		Name:                 o.Name,
+		ServiceNamespace:     o.ServiceNamespace,
+		ServiceName:          o.ServiceName,
+		ServicePort:          o.ServicePort,
+		GroupPriorityMinimum: o.GroupPriorityMinimum,
+		VersionPriority:      o.VersionPriority,
+		ResyncPeriod:         o.ResyncPeriod,
+	}
+	if len(o.APIServiceCAFile) > 0 {
+		ca, err := dynamiccertificates.NewDynamicCAContentFromFile("registration-apiservice-ca", o.APIServiceCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --registration-apiservice-ca-file: %w", err)
+		}
+		config.APIServiceCA = ca
+	}
+	if len(o.WebhookCAFile) > 0 {
+		caBundle, err := os.ReadFile(o.WebhookCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --registration-webhook-ca-file: %w", err)
+		}
+		config.WebhookCABundle = caBundle
+	}
+	return config, nil
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/generic-admission-server/pkg/apiserver"
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
+)
+
+// ReviewOptions run recorded AdmissionReviews through the admission hooks in process.
+type ReviewOptions struct {
+	AdmissionHooks []apiserver.AdmissionHook
+
+	ResourcePath string
+	ExpectedFile string
+	Output       string
+	Kubeconfig   string
+
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+func NewReviewOptions(out, errOut io.Writer, admissionHooks ...apiserver.AdmissionHook) *ReviewOptions {
+	return &ReviewOptions{
+		AdmissionHooks: admissionHooks,
+		Output:         "yaml",
+		Out:            out,
+		ErrOut:         errOut,
+	}
+}
+
+// NewCommandReview provides the 'review' command replaying AdmissionReview files against the admission hooks.
+func NewCommandReview(out, errOut io.Writer, admissionHooks ...apiserver.AdmissionHook) *cobra.Command {
+	o := NewReviewOptions(out, errOut, admissionHooks...)
+
+	cmd := &cobra.Command{
+		Use:   "review --path /apis/<group>/<version>/<resource> FILE...",
+		Short: "Run AdmissionReview files through an admission hook",
+		Long: "Run v1 or v1beta1 AdmissionReview files in JSON or YAML through the admission hook served on the given path, " +
+			"in process, and print the reviews with their responses and the objects with the patches applied. " +
+			"With --expected the command fails if the response differs from the one of the expected AdmissionReview.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Validate(args); err != nil {
+				return err
+			}
+			return o.Run(c.Context(), args)
+		},
+	}
+	// a mismatch is reported on its own, the usage does not help
+	cmd.SilenceUsage = true
+
+	o.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func (o *ReviewOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.ResourcePath, "path", o.ResourcePath, "The path of the admission hook to run the reviews through, /apis/<group>/<version>/<resource>.")
+	fs.StringVar(&o.ExpectedFile, "expected", o.ExpectedFile, "An AdmissionReview file with the expected response. Only valid with a single review file.")
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "The output format, yaml or json.")
+	fs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "Initialize the admission hooks with this kubeconfig. By default the hooks are not initialized.")
+}
+
+func (o *ReviewOptions) Validate(args []string) error {
+	if _, err := apiserver.ParseResourcePath(o.ResourcePath); err != nil {
+		return fmt.Errorf("--path: %w", err)
+	}
+	if len(o.ExpectedFile) > 0 && len(args) != 1 {
+		return fmt.Errorf("--expected is only valid with a single review file")
+	}
+	if o.Output != "yaml" && o.Output != "json" {
+		return fmt.Errorf("--output must be yaml or json, got %q", o.Output)
+	}
+	return nil
+}
+
+// reviewOutput is printed for every review file.
+type reviewOutput struct {
+	File          string          `json:"file"`
+	Review        interface{}     `json:"review"`
+	Patch         json.RawMessage `json:"patch,omitempty"`
+	PatchedObject json.RawMessage `json:"patchedObject,omitempty"`
+}
+
+func (o *ReviewOptions) Run(ctx context.Context, files []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	resource, err := apiserver.ParseResourcePath(o.ResourcePath)
+	if err != nil {
+		return err
+	}
+	reviewer, err := apiserver.NewReviewer(o.AdmissionHooks...)
+	if err != nil {
+		return err
+	}
+	if len(o.Kubeconfig) > 0 {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		if err := o.initialize(stopCh); err != nil {
+			return err
+		}
+	}
+
+	var expected *admissionv1.AdmissionReview
+	if len(o.ExpectedFile) > 0 {
+		if expected, _, err = readAdmissionReview(o.ExpectedFile); err != nil {
+			return err
+		}
+		if expected.Response == nil {
+			return fmt.Errorf("%s has no response", o.ExpectedFile)
+		}
+	}
+
+	for i, file := range files {
+		review, version, err := readAdmissionReview(file)
+		if err != nil {
+			return err
+		}
+		result, err := reviewer.Review(ctx, resource, review)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		output := reviewOutput{File: file, Review: result.Review, PatchedObject: result.PatchedObject}
+		if version == admissionv1beta1.SchemeGroupVersion.Version {
+			output.Review = &admissionv1beta1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: admissionv1beta1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+				Request:  admissionreview.ConvertV1RequestToV1Beta1(result.Review.Request),
+				Response: admissionreview.ConvertV1ResponseToV1Beta1(result.Review.Response),
+			}
+		}
+		if response := result.Review.Response; response != nil && json.Valid(response.Patch) {
+			output.Patch = response.Patch
+		}
+		if err := o.print(i, output); err != nil {
+			return err
+		}
+
+		if expected != nil {
+			if err := compareResponses(expected.Response, result.Review.Response); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (o *ReviewOptions) initialize(stopCh <-chan struct{}) error {
+	config, err := getClientConfig(o.Kubeconfig)
+	if err != nil {
+		return err
+	}
+	for _, hook := range o.AdmissionHooks {
+		if err := hook.Initialize(config, stopCh); err != nil {
+			return fmt.Errorf("failed to initialize admission hook %T: %w", hook, err)
+		}
+	}
+	return nil
+}
+
+func (o *ReviewOptions) print(i int, output reviewOutput) error {
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+	if o.Output == "yaml" {
+		if data, err = yaml.JSONToYAML(data); err != nil {
+			return err
+		}
+		if i > 0 {
+			data = append([]byte("---\n"), data...)
+		}
+	} else {
+		data = append(data, '\n')
+	}
+	_, err = o.Out.Write(data)
+	return err
+}
+
+// readAdmissionReview reads a v1 or v1beta1 AdmissionReview in JSON or YAML, returning it in v1 and the version it
+// was read in.
+func readAdmissionReview(file string) (*admissionv1.AdmissionReview, string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	if data, err = yaml.YAMLToJSON(data); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", file, err)
+	}
+	obj, gvk, err := apiserver.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", file, err)
+	}
+
+	switch review := obj.(type) {
+	case *admissionv1.AdmissionReview:
+		return review, gvk.Version, nil
+	case *admissionv1beta1.AdmissionReview:
+		return &admissionv1.AdmissionReview{
+			Request:  admissionreview.ConvertV1Beta1RequestToV1(review.Request),
+			Response: admissionreview.ConvertV1Beta1ResponseToV1(review.Response),
+		}, gvk.Version, nil
+	default:
+		return nil, "", fmt.Errorf("%s: expected an AdmissionReview, got %s", file, gvk)
+	}
+}
+
+// compareResponses compares the responses regardless of their UIDs, comparing patches as JSON.
+func compareResponses(expected, actual *admissionv1.AdmissionResponse) error {
+	normalize := func(response *admissionv1.AdmissionResponse) (*admissionv1.AdmissionResponse, interface{}, error) {
+		response = response.DeepCopy()
+		response.UID = ""
+		var patch interface{}
+		if len(response.Patch) > 0 {
+			if err := json.Unmarshal(response.Patch, &patch); err != nil {
+				return nil, nil, fmt.Errorf("invalid patch: %w", err)
+			}
+		}
+		response.Patch = nil
+		return response, patch, nil
+	}
+	e, expectedPatch, err := normalize(expected)
+	if err != nil {
+		return fmt.Errorf("expected response: %w", err)
+	}
+	a, actualPatch, err := normalize(actual)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(e, a) && reflect.DeepEqual(expectedPatch, actualPatch) {
+		return nil
+	}
+
+	expectedJSON, _ := json.Marshal(expected)
+	actualJSON, _ := json.Marshal(actual)
+	return fmt.Errorf("the response does not match the expected one\nexpected: %s\nactual:   %s", expectedJSON, actualJSON)
+}
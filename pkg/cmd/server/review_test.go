@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/openshift/generic-admission-server/pkg/capture"
+)
+
+type testMutatingHook struct{}
+
+func (testMutatingHook) Initialize(*restclient.Config, <-chan struct{}) error { return nil }
+
+func (testMutatingHook) MutatingResource() (schema.GroupVersionResource, string) {
+	return schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "labelers"}, "labeler"
+}
+
+func (testMutatingHook) Admit(_ context.Context, req *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+	if req.Namespace == "forbidden" {
+		return &admissionv1.AdmissionResponse{Allowed: false}, nil
+	}
+	patchType := admissionv1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{
+		Allowed:   true,
+		Patch:     []byte(`[{"op":"add","path":"/metadata/labels","value":{"labeled":"true"}}]`),
+		PatchType: &patchType,
+	}, nil
+}
+
+const testReviewV1Beta1 = `apiVersion: admission.k8s.io/v1beta1
+kind: AdmissionReview
+request:
+  uid: "1234"
+  kind: {group: "", version: v1, kind: ConfigMap}
+  resource: {group: "", version: v1, resource: configmaps}
+  operation: CREATE
+  namespace: default
+  name: foo
+  userInfo: {username: alice}
+  object:
+    apiVersion: v1
+    kind: ConfigMap
+    metadata: {name: foo, namespace: default}
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runReview(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	cmd := NewCommandReview(out, &bytes.Buffer{}, testMutatingHook{}, testHook{})
+	cmd.SetArgs(append([]string{"--path=/apis/admission.example.com/v1/labelers"}, args...))
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestReview(t *testing.T) {
+	out, err := runReview(writeFile(t, "review.yaml", testReviewV1Beta1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"apiVersion: admission.k8s.io/v1beta1",
+		"allowed: true",
+		`uid: "1234"`,
+		"path: /metadata/labels",
+		"labeled: \"true\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got\n%s", want, out)
+		}
+	}
+}
+
+func TestReviewExpected(t *testing.T) {
+	review := writeFile(t, "review.yaml", testReviewV1Beta1)
+
+	matching := writeFile(t, "expected.json", `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","response":{
+		"uid":"ignored","allowed":true,"patchType":"JSONPatch",
+		"patch":"`+"W3sib3AiOiAiYWRkIiwgInBhdGgiOiAiL21ldGFkYXRhL2xhYmVscyIsICJ2YWx1ZSI6IHsibGFiZWxlZCI6ICJ0cnVlIn19XQ=="+`"}}`)
+	if _, err := runReview("--expected="+matching, review); err != nil {
+		t.Errorf("expected the response to match: %v", err)
+	}
+
+	denial := writeFile(t, "denial.json", `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","response":{"uid":"1234","allowed":false}}`)
+	if _, err := runReview("--expected="+denial, review); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected a mismatch, got %v", err)
+	}
+}
+
+func TestReviewUnknownPath(t *testing.T) {
+	_, err := runReview("--path=/apis/admission.example.com/v1/unknown", writeFile(t, "review.yaml", testReviewV1Beta1))
+	if err == nil || !strings.Contains(err.Error(), "no admission hook is served on unknown.v1.admission.example.com") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReviewCapturedReview(t *testing.T) {
+	dir := t.TempDir()
+	capturer, err := capture.NewCapturer(capture.Config{Dir: dir, SampleRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, _, err := readAdmissionReview(writeFile(t, "review.yaml", testReviewV1Beta1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := testMutatingHook{}
+	gvr, _ := hook.MutatingResource()
+	response, _ := hook.Admit(context.Background(), review.Request)
+	capturer.Capture(gvr, review.Request, response)
+
+	// a captured review is both the input and the expected review of a replay
+	captured := filepath.Join(dir, "labelers.v1.admission.example.com", "1234.json")
+	if _, err := runReview("--expected="+captured, captured); err != nil {
+		t.Errorf("expected the replayed review to match the captured one: %v", err)
+	}
+}
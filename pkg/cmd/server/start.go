@@ -11,6 +11,7 @@ import (
 
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apiserver/pkg/endpoints/openapi"
 	"k8s.io/apiserver/pkg/features"
 	genericapiserver "k8s.io/apiserver/pkg/server"
@@ -18,8 +19,13 @@ import (
 	"k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
 
 	"github.com/openshift/generic-admission-server/pkg/apiserver"
+	"github.com/openshift/generic-admission-server/pkg/capture"
+	"github.com/openshift/generic-admission-server/pkg/celadmission"
+	"github.com/openshift/generic-admission-server/pkg/decisionlog"
+	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview"
 	"github.com/openshift/generic-admission-server/pkg/registry/admissionreview/generated"
 )
 
@@ -30,6 +36,16 @@ type AdmissionServerOptions struct {
 
 	AdmissionHooks []apiserver.AdmissionHook
 
+	Registration *RegistrationOptions
+	Enforcement  *EnforcementOptions
+	DecisionLog  *decisionlog.Options
+	Capture      *capture.Options
+	CEL          *celadmission.Options
+	Exemptions   *ExemptionOptions
+
+	// ConformanceMode is how responses of the hooks violating the admission protocol are handled, lenient or strict.
+	ConformanceMode string
+
 	StdOut io.Writer
 	StdErr io.Writer
 }
@@ -44,6 +60,15 @@ func NewAdmissionServerOptions(out, errOut io.Writer, admissionHooks ...apiserve
 
 		AdmissionHooks: admissionHooks,
 
+		Registration: NewRegistrationOptions(),
+		Enforcement:  NewEnforcementOptions(),
+		DecisionLog:  decisionlog.NewOptions(),
+		Capture:      capture.NewOptions(),
+		CEL:          celadmission.NewOptions(),
+		Exemptions:   NewExemptionOptions(),
+
+		ConformanceMode: string(admissionreview.ConformanceModeLenient),
+
 		StdOut: out,
 		StdErr: errOut,
 	}
@@ -59,7 +84,8 @@ func NewAdmissionServerOptions(out, errOut io.Writer, admissionHooks ...apiserve
 	return o
 }
 
-// NewCommandStartMaster provides a CLI handler for 'start master' command
+// NewCommandStartAdmissionServer provides a CLI handler running the admission server, with the subcommands
+// operating on its admission hooks.
 func NewCommandStartAdmissionServer(out, errOut io.Writer, stopCh <-chan struct{}, admissionHooks ...apiserver.AdmissionHook) *cobra.Command {
 	o := NewAdmissionServerOptions(out, errOut, admissionHooks...)
 
@@ -83,11 +109,24 @@ func NewCommandStartAdmissionServer(out, errOut io.Writer, stopCh <-chan struct{
 	flags := cmd.Flags()
 	o.AddFlags(flags)
 
+	cmd.AddCommand(NewCommandManifests(out, admissionHooks...))
+	cmd.AddCommand(NewCommandReview(out, errOut, admissionHooks...))
+	cmd.AddCommand(NewCommandIdempotency(out, admissionHooks...))
+
 	return cmd
 }
 
+// AddFlags adds the flags of the recommended options, which include --tracing-config-file to trace admission
+// hook calls as children of the request spans, and the feature gates.
 func (o *AdmissionServerOptions) AddFlags(fs *pflag.FlagSet) {
 	o.RecommendedOptions.AddFlags(fs)
+	o.Registration.AddFlags(fs)
+	o.Enforcement.AddFlags(fs)
+	o.DecisionLog.AddFlags(fs)
+	o.Capture.AddFlags(fs)
+	o.CEL.AddFlags(fs)
+	o.Exemptions.AddFlags(fs)
+	fs.StringVar(&o.ConformanceMode, "response-conformance-mode", o.ConformanceMode, "How responses of the admission hooks violating the admission protocol, like patches of validating hooks or patches without a patch type, are handled. The mode is lenient to fix them up and log them, or strict to deny the requests.")
 	// first set the UnauthenticatedHTTP2DOSMitigation feature to true by default
 	if err := feature.DefaultMutableFeatureGate.SetFromMap(map[string]bool{
 		string(features.UnauthenticatedHTTP2DOSMitigation): true,
@@ -114,13 +153,30 @@ func (o *AdmissionServerOptions) AddFlags(fs *pflag.FlagSet) {
 }
 
 func (o AdmissionServerOptions) Validate(args []string) error {
-	return nil
+	var errs []error
+	if o.RecommendedOptions.Traces != nil {
+		errs = append(errs, o.RecommendedOptions.Traces.Validate()...)
+	}
+	errs = append(errs, o.Registration.Validate()...)
+	errs = append(errs, o.Enforcement.Validate()...)
+	errs = append(errs, o.DecisionLog.Validate()...)
+	errs = append(errs, o.Capture.Validate()...)
+	errs = append(errs, o.CEL.Validate()...)
+	errs = append(errs, o.Exemptions.Validate()...)
+	if _, err := admissionreview.ParseConformanceMode(o.ConformanceMode); err != nil {
+		errs = append(errs, fmt.Errorf("--response-conformance-mode: %w", err))
+	}
+	if err := apiserver.ValidateAdmissionHooks(o.AdmissionHooks...); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
 }
 
 func (o *AdmissionServerOptions) Complete() error {
 	return nil
 }
 
+// Config returns the config of the admission server. The caller closes its decision logger, if any.
 func (o AdmissionServerOptions) Config() (*apiserver.Config, error) {
 	// TODO have a "real" external address
 	if err := o.RecommendedOptions.SecureServing.MaybeDefaultWithSelfSignedCerts("localhost", nil, []net.IP{net.ParseIP("127.0.0.1")}); err != nil {
@@ -140,10 +196,42 @@ func (o AdmissionServerOptions) Config() (*apiserver.Config, error) {
 		return nil, err
 	}
 
+	registration, err := o.Registration.RegistrationConfig()
+	if err != nil {
+		return nil, err
+	}
+	enforcementModes, err := o.Enforcement.EnforcementModes()
+	if err != nil {
+		return nil, err
+	}
+	capturer, err := o.Capture.NewCapturer()
+	if err != nil {
+		return nil, err
+	}
+	celHooks, err := o.CEL.AdmissionHooks()
+	if err != nil {
+		return nil, err
+	}
+	exemptions, err := o.Exemptions.Exemptions()
+	if err != nil {
+		return nil, err
+	}
+	// opened last, since the file or HTTP sink must be closed once it is opened
+	decisionLogger, err := o.DecisionLog.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+
 	config := &apiserver.Config{
 		GenericConfig: serverConfig,
 		ExtraConfig: apiserver.ExtraConfig{
-			AdmissionHooks: o.AdmissionHooks,
+			AdmissionHooks:   append(append([]apiserver.AdmissionHook(nil), o.AdmissionHooks...), celHooks...),
+			EnforcementModes: enforcementModes,
+			ConformanceMode:  admissionreview.ConformanceMode(o.ConformanceMode),
+			Registration:     registration,
+			DecisionLogger:   decisionLogger,
+			Capturer:         capturer,
+			Exemptions:       exemptions,
 		},
 		RestConfig: restConfig,
 	}
@@ -156,6 +244,12 @@ func (o AdmissionServerOptions) RunAdmissionServer(stopCh <-chan struct{}) error
 		return err
 	}
 
+	// Run returns after the server drained its requests, so no decision is logged after the logger is closed
+	defer func() {
+		if err := config.ExtraConfig.DecisionLogger.Close(); err != nil {
+			klog.ErrorS(err, "Failed to close the decision log")
+		}
+	}()
 	server, err := config.Complete().New()
 	if err != nil {
 		return err
@@ -0,0 +1,73 @@
+package decisionlog
+
+import (
+	"math/rand/v2"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+// Logger writes the admission decisions of the hooks to a sink. A nil Logger logs nothing.
+type Logger struct {
+	sink Sink
+
+	allowedSampleRate float64
+	includeObjects    bool
+	redactResources   map[schema.GroupResource]bool
+}
+
+// LoggerConfig configures what a Logger records.
+type LoggerConfig struct {
+	// AllowedSampleRate is the fraction of allowed decisions that is logged, between 0 and 1. Denials are always
+	// logged.
+	AllowedSampleRate float64
+	// IncludeObjects records the objects of the requests.
+	IncludeObjects bool
+	// RedactResources are the resources whose objects are never recorded.
+	RedactResources []schema.GroupResource
+}
+
+// NewLogger returns a Logger writing to the given sink.
+func NewLogger(sink Sink, config LoggerConfig) *Logger {
+	l := &Logger{
+		sink:              sink,
+		allowedSampleRate: config.AllowedSampleRate,
+		includeObjects:    config.IncludeObjects,
+		redactResources:   map[schema.GroupResource]bool{},
+	}
+	for _, gr := range config.RedactResources {
+		l.redactResources[gr] = true
+	}
+	return l
+}
+
+// Log logs the decision of the admission hook served on the given resource, unless it is an allowed decision which
+// is not sampled. The response is the one of the hook, enforcement is the enforcement mode it was subject to.
+func (l *Logger) Log(hook schema.GroupVersionResource, enforcement string, request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse) {
+	if l == nil {
+		return
+	}
+	allowed := response != nil && response.Allowed
+	if allowed && l.allowedSampleRate < 1 && rand.Float64() >= l.allowedSampleRate {
+		return
+	}
+
+	redact := false
+	if request != nil {
+		redact = l.redactResources[schema.GroupResource{Group: request.Resource.Group, Resource: request.Resource.Resource}]
+	}
+	record := newRecord(hook, request, response, l.includeObjects, redact)
+	record.Enforcement = enforcement
+	if err := l.sink.Write(record); err != nil {
+		klog.ErrorS(err, "Failed to write admission decision record", "uid", record.UID, "hook", record.Hook)
+	}
+}
+
+// Close flushes and closes the sink of the logger.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.sink.Close()
+}
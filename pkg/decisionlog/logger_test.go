@@ -0,0 +1,165 @@
+package decisionlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var testHook = schema.GroupVersionResource{Group: "admission.example.com", Version: "v1", Resource: "checks"}
+
+func testRequest(resource metav1.GroupVersionResource, kind string) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Group: resource.Group, Version: resource.Version, Kind: kind},
+		Resource:  resource,
+		Operation: admissionv1.Create,
+		Namespace: "ns",
+		Name:      "foo",
+		UserInfo:  authenticationv1.UserInfo{Username: "alice", Groups: []string{"system:authenticated"}},
+		Object:    runtime.RawExtension{Raw: []byte(`{"data":{"password":"c2VjcmV0"}}`)},
+	}
+}
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []Record {
+	t.Helper()
+	var records []Record
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestLoggerRecords(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewLogger(NewWriterSink(buf), LoggerConfig{
+		AllowedSampleRate: 1,
+		IncludeObjects:    true,
+		RedactResources:   []schema.GroupResource{{Resource: "secrets"}},
+	})
+
+	jsonPatch := admissionv1.PatchTypeJSONPatch
+	logger.Log(testHook, "enforce", testRequest(metav1.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "ConfigMap"), &admissionv1.AdmissionResponse{
+		Allowed:   true,
+		Patch:     []byte(`[{"op":"add","path":"/metadata/labels","value":{"a":"secret-value"}}]`),
+		PatchType: &jsonPatch,
+	})
+	logger.Log(testHook, "enforce", testRequest(metav1.GroupVersionResource{Version: "v1", Resource: "secrets"}, "Secret"), &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result:  &metav1.Status{Code: http.StatusForbidden, Reason: metav1.StatusReasonForbidden, Message: "denied"},
+	})
+
+	records := decodeRecords(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	allowed := records[0]
+	if allowed.Hook != "checks.v1.admission.example.com" || allowed.User != "alice" || allowed.Name != "foo" || !allowed.Allowed {
+		t.Errorf("unexpected record %+v", allowed)
+	}
+	if len(allowed.Object) == 0 || allowed.Redacted {
+		t.Errorf("expected the object of a config map to be recorded")
+	}
+	if allowed.Patch == nil || allowed.Patch.Type != "JSONPatch" || len(allowed.Patch.Operations) != 1 || allowed.Patch.Operations[0].Path != "/metadata/labels" {
+		t.Errorf("unexpected patch summary %+v", allowed.Patch)
+	}
+	if strings.Contains(buf.String(), "secret-value") {
+		t.Errorf("expected patch values to be left out of the records")
+	}
+
+	denied := records[1]
+	if denied.Allowed || denied.Code != http.StatusForbidden || denied.Message != "denied" {
+		t.Errorf("unexpected record %+v", denied)
+	}
+	if len(denied.Object) != 0 || !denied.Redacted {
+		t.Errorf("expected the object of a secret to be redacted")
+	}
+}
+
+func TestLoggerSamplesAllowedDecisions(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewLogger(NewWriterSink(buf), LoggerConfig{AllowedSampleRate: 0})
+	request := testRequest(metav1.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "ConfigMap")
+
+	for i := 0; i < 10; i++ {
+		logger.Log(testHook, "enforce", request, &admissionv1.AdmissionResponse{Allowed: true})
+	}
+	logger.Log(testHook, "enforce", request, &admissionv1.AdmissionResponse{Allowed: false})
+
+	records := decodeRecords(t, buf)
+	if len(records) != 1 || records[0].Allowed {
+		t.Errorf("expected only the denial to be logged, got %+v", records)
+	}
+	if len(records[0].Object) != 0 {
+		t.Errorf("expected no objects without IncludeObjects")
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	received := make(chan Record, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record Record
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Errorf("invalid record: %v", err)
+		}
+		received <- record
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(HTTPSinkConfig{URL: server.URL})
+	if err := sink.Write(Record{UID: "uid"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if record := <-received; record.UID != "uid" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if err := sink.Write(Record{}); err == nil {
+		t.Errorf("expected writing to a closed sink to fail")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		modify  func(o *Options)
+		wantErr bool
+	}{
+		{name: "defaults", modify: func(o *Options) {}},
+		{name: "klog", modify: func(o *Options) { o.Sink = SinkKlog }},
+		{name: "file without path", modify: func(o *Options) { o.Sink = SinkFile }, wantErr: true},
+		{name: "file", modify: func(o *Options) { o.Sink, o.File.Path = SinkFile, "/var/log/decisions.log" }},
+		{name: "http without url", modify: func(o *Options) { o.Sink = SinkHTTP }, wantErr: true},
+		{name: "http", modify: func(o *Options) { o.Sink, o.URL = SinkHTTP, "https://collector:8443/decisions" }},
+		{name: "unknown sink", modify: func(o *Options) { o.Sink = "syslog" }, wantErr: true},
+		{name: "sample rate", modify: func(o *Options) { o.AllowedSampleRate = 1.5 }, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o := NewOptions()
+			c.modify(o)
+			if errs := o.Validate(); (len(errs) > 0) != c.wantErr {
+				t.Errorf("expected error %v, got %v", c.wantErr, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package decisionlog
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	SinkNone = ""
+	SinkKlog = "klog"
+	SinkFile = "file"
+	SinkHTTP = "http"
+)
+
+// Options are the command line options of the decision log.
+type Options struct {
+	Sink string
+
+	File FileSinkConfig
+
+	URL         string
+	HTTPTimeout time.Duration
+
+	AllowedSampleRate float64
+	IncludeObjects    bool
+	RedactResources   []string
+}
+
+// NewOptions returns the default options, which log no decisions.
+func NewOptions() *Options {
+	return &Options{
+		File: FileSinkConfig{
+			MaxSize:    100,
+			MaxBackups: 10,
+		},
+		HTTPTimeout:       5 * time.Second,
+		AllowedSampleRate: 1,
+		RedactResources:   []string{"secrets"},
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+	fs.StringVar(&o.Sink, "decision-log-sink", o.Sink, "Where to log the admission decisions of the hooks: klog, file or http. Empty disables the decision log.")
+	fs.StringVar(&o.File.Path, "decision-log-path", o.File.Path, "The file the decision log is written to as JSON lines, with --decision-log-sink=file.")
+	fs.IntVar(&o.File.MaxSize, "decision-log-maxsize", o.File.MaxSize, "The size in megabytes at which the decision log file is rotated.")
+	fs.IntVar(&o.File.MaxBackups, "decision-log-maxbackup", o.File.MaxBackups, "The number of rotated decision log files to keep, 0 to keep all.")
+	fs.IntVar(&o.File.MaxAge, "decision-log-maxage", o.File.MaxAge, "The number of days to keep rotated decision log files, 0 to keep them regardless of their age.")
+	fs.BoolVar(&o.File.Compress, "decision-log-compress", o.File.Compress, "Compress rotated decision log files with gzip.")
+	fs.StringVar(&o.URL, "decision-log-url", o.URL, "The URL each decision record is posted to as JSON, with --decision-log-sink=http.")
+	fs.DurationVar(&o.HTTPTimeout, "decision-log-http-timeout", o.HTTPTimeout, "The timeout of posting a decision record, with --decision-log-sink=http.")
+	fs.Float64Var(&o.AllowedSampleRate, "decision-log-allowed-sample-rate", o.AllowedSampleRate, "The fraction of allowed decisions that is logged, between 0 and 1. Denials are always logged.")
+	fs.BoolVar(&o.IncludeObjects, "decision-log-include-objects", o.IncludeObjects, "Include the objects of the admission requests in the decision log.")
+	fs.StringSliceVar(&o.RedactResources, "decision-log-redact-resources", o.RedactResources, "Resources in the form resource.group whose objects are never included in the decision log.")
+}
+
+func (o *Options) Validate() []error {
+	if o == nil {
+		return nil
+	}
+	var errs []error
+	switch o.Sink {
+	case SinkNone, SinkKlog:
+	case SinkFile:
+		if len(o.File.Path) == 0 {
+			errs = append(errs, fmt.Errorf("--decision-log-path is required with --decision-log-sink=file"))
+		}
+		if o.File.MaxSize < 0 || o.File.MaxBackups < 0 || o.File.MaxAge < 0 {
+			errs = append(errs, fmt.Errorf("--decision-log-maxsize, --decision-log-maxbackup and --decision-log-maxage must not be negative"))
+		}
+	case SinkHTTP:
+		if u, err := url.Parse(o.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			errs = append(errs, fmt.Errorf("--decision-log-url must be an http or https URL with --decision-log-sink=http, got %q", o.URL))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("--decision-log-sink must be one of klog, file or http, got %q", o.Sink))
+	}
+	if o.AllowedSampleRate < 0 || o.AllowedSampleRate > 1 {
+		errs = append(errs, fmt.Errorf("--decision-log-allowed-sample-rate must be between 0 and 1, got %v", o.AllowedSampleRate))
+	}
+	return errs
+}
+
+// NewLogger returns the decision logger configured by the options, or nil if decisions are not logged.
+func (o *Options) NewLogger() (*Logger, error) {
+	if o == nil {
+		return nil, nil
+	}
+	var sink Sink
+	switch o.Sink {
+	case SinkNone:
+		return nil, nil
+	case SinkKlog:
+		sink = NewKlogSink()
+	case SinkFile:
+		sink = NewFileSink(o.File)
+	case SinkHTTP:
+		sink = NewHTTPSink(HTTPSinkConfig{URL: o.URL, Timeout: o.HTTPTimeout})
+	default:
+		return nil, fmt.Errorf("unknown decision log sink %q", o.Sink)
+	}
+
+	config := LoggerConfig{
+		AllowedSampleRate: o.AllowedSampleRate,
+		IncludeObjects:    o.IncludeObjects,
+	}
+	for _, r := range o.RedactResources {
+		config.RedactResources = append(config.RedactResources, schema.ParseGroupResource(r))
+	}
+	return NewLogger(sink, config), nil
+}
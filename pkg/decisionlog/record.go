@@ -0,0 +1,151 @@
+package decisionlog
+
+import (
+	"encoding/json"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Record is the structured log record of one admission decision.
+type Record struct {
+	Time time.Time `json:"time"`
+	UID  types.UID `json:"uid"`
+
+	// Hook is the resource the admission hook is served on, in the form resource.version.group.
+	Hook string `json:"hook"`
+
+	Operation   admissionv1.Operation `json:"operation"`
+	Kind        string                `json:"kind"`
+	Resource    string                `json:"resource"`
+	SubResource string                `json:"subResource,omitempty"`
+	Namespace   string                `json:"namespace,omitempty"`
+	Name        string                `json:"name,omitempty"`
+	DryRun      bool                  `json:"dryRun,omitempty"`
+
+	User   string   `json:"user"`
+	Groups []string `json:"groups,omitempty"`
+
+	// Enforcement is the enforcement mode of the hook. In the warn and audit modes a denial was not enforced.
+	Enforcement string `json:"enforcement,omitempty"`
+
+	Allowed  bool     `json:"allowed"`
+	Code     int32    `json:"code,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Patch    *Patch   `json:"patch,omitempty"`
+
+	// Object and OldObject are only recorded if requested, and never for redacted resources.
+	Object    json.RawMessage `json:"object,omitempty"`
+	OldObject json.RawMessage `json:"oldObject,omitempty"`
+	// Redacted is set if the objects of the request were withheld from the record.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Patch summarizes the patch of a mutating admission hook without its values.
+type Patch struct {
+	Type       string           `json:"type"`
+	Size       int              `json:"size"`
+	Operations []PatchOperation `json:"operations,omitempty"`
+}
+
+// PatchOperation is one operation of a JSON patch, without its value.
+type PatchOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+}
+
+// newRecord returns the record of the given admission decision of the hook served on the given resource. The
+// objects of the request are included if includeObjects is set and the request is not for a redacted resource.
+func newRecord(hook schema.GroupVersionResource, request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse, includeObjects, redact bool) Record {
+	record := Record{
+		Time: time.Now(),
+		Hook: hook.Resource + "." + hook.Version + "." + hook.Group,
+	}
+	if request != nil {
+		record.UID = request.UID
+		record.Operation = request.Operation
+		record.Kind = schema.GroupVersionKind{Group: request.Kind.Group, Version: request.Kind.Version, Kind: request.Kind.Kind}.String()
+		record.Resource = schema.GroupVersionResource{Group: request.Resource.Group, Version: request.Resource.Version, Resource: request.Resource.Resource}.String()
+		record.SubResource = request.SubResource
+		record.Namespace = request.Namespace
+		record.Name = request.Name
+		record.DryRun = request.DryRun != nil && *request.DryRun
+		record.User = request.UserInfo.Username
+		record.Groups = request.UserInfo.Groups
+
+		switch {
+		case includeObjects && redact:
+			record.Redacted = len(request.Object.Raw) > 0 || len(request.OldObject.Raw) > 0
+		case includeObjects:
+			record.Object = json.RawMessage(request.Object.Raw)
+			record.OldObject = json.RawMessage(request.OldObject.Raw)
+		}
+	}
+	if response != nil {
+		record.Allowed = response.Allowed
+		record.Warnings = response.Warnings
+		if response.Result != nil {
+			record.Code = response.Result.Code
+			record.Reason = string(response.Result.Reason)
+			record.Message = response.Result.Message
+		}
+		if len(response.Patch) > 0 {
+			record.Patch = summarizePatch(response)
+		}
+	}
+	return record
+}
+
+func summarizePatch(response *admissionv1.AdmissionResponse) *Patch {
+	patch := &Patch{Size: len(response.Patch)}
+	if response.PatchType != nil {
+		patch.Type = string(*response.PatchType)
+	}
+	// the values are left out, they are as sensitive as the object
+	var operations []PatchOperation
+	if err := json.Unmarshal(response.Patch, &operations); err == nil {
+		patch.Operations = operations
+	}
+	return patch
+}
+
+// keysAndValues returns the record as the key/value pairs of a structured log message.
+func (r Record) keysAndValues() []interface{} {
+	kv := []interface{}{
+		"uid", r.UID,
+		"hook", r.Hook,
+		"operation", r.Operation,
+		"kind", r.Kind,
+		"resource", r.Resource,
+		"subResource", r.SubResource,
+		"namespace", r.Namespace,
+		"name", r.Name,
+		"dryRun", r.DryRun,
+		"user", r.User,
+		"groups", r.Groups,
+		"enforcement", r.Enforcement,
+		"allowed", r.Allowed,
+		"code", r.Code,
+		"reason", r.Reason,
+		"message", r.Message,
+		"warnings", r.Warnings,
+	}
+	if r.Patch != nil {
+		kv = append(kv, "patch", r.Patch)
+	}
+	if len(r.Object) > 0 {
+		kv = append(kv, "object", string(r.Object))
+	}
+	if len(r.OldObject) > 0 {
+		kv = append(kv, "oldObject", string(r.OldObject))
+	}
+	if r.Redacted {
+		kv = append(kv, "redacted", true)
+	}
+	return kv
+}
@@ -0,0 +1,192 @@
+package decisionlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+	"k8s.io/klog/v2"
+)
+
+// Sink receives the records of admission decisions. Write is called concurrently from the requests being admitted.
+type Sink interface {
+	Write(record Record) error
+	// Close flushes buffered records. Records written afterwards may be dropped.
+	Close() error
+}
+
+// NewKlogSink returns a sink logging the records as structured klog messages, which are JSON objects with
+// --logging-format=json.
+func NewKlogSink() Sink {
+	return klogSink{}
+}
+
+type klogSink struct{}
+
+func (klogSink) Write(record Record) error {
+	klog.InfoS("Admission decision", record.keysAndValues()...)
+	return nil
+}
+
+func (klogSink) Close() error {
+	klog.Flush()
+	return nil
+}
+
+// FileSinkConfig configures the rotation of the file of a file sink.
+type FileSinkConfig struct {
+	Path string
+	// MaxSize is the size in megabytes at which the file is rotated.
+	MaxSize int
+	// MaxBackups is the number of rotated files to keep, 0 to keep all.
+	MaxBackups int
+	// MaxAge is the number of days to keep rotated files, 0 to keep them regardless of their age.
+	MaxAge   int
+	Compress bool
+}
+
+// NewFileSink returns a sink writing the records as JSON lines to a local file, which is rotated by size.
+func NewFileSink(config FileSinkConfig) Sink {
+	return NewWriterSink(&lumberjack.Logger{
+		Filename:   config.Path,
+		MaxSize:    config.MaxSize,
+		MaxBackups: config.MaxBackups,
+		MaxAge:     config.MaxAge,
+		Compress:   config.Compress,
+	})
+}
+
+// NewWriterSink returns a sink writing the records as JSON lines to the given writer. The writer is closed with the
+// sink if it is an io.Closer.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+type writerSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (s *writerSink) Write(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+func (s *writerSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// HTTPSinkConfig configures an HTTP sink.
+type HTTPSinkConfig struct {
+	URL     string
+	Timeout time.Duration
+	// BufferSize is the number of records queued for sending. Records are dropped when the queue is full.
+	BufferSize int
+	Client     *http.Client
+}
+
+// NewHTTPSink returns a sink posting each record as JSON to an HTTP endpoint. Records are sent in the background,
+// so that a slow endpoint does not slow down admission.
+func NewHTTPSink(config HTTPSinkConfig) Sink {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1024
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	s := &httpSink{
+		config:  config,
+		records: make(chan Record, config.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+type httpSink struct {
+	config HTTPSinkConfig
+
+	lock    sync.RWMutex
+	closed  bool
+	records chan Record
+	done    chan struct{}
+}
+
+func (s *httpSink) Write(record Record) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return fmt.Errorf("decision log sink %s is closed", s.config.URL)
+	}
+	select {
+	case s.records <- record:
+		return nil
+	default:
+		return fmt.Errorf("decision log sink %s is full, dropped record", s.config.URL)
+	}
+}
+
+func (s *httpSink) Close() error {
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.records)
+	}
+	s.lock.Unlock()
+	<-s.done
+	return nil
+}
+
+func (s *httpSink) run() {
+	defer close(s.done)
+	for record := range s.records {
+		if err := s.send(record); err != nil {
+			klog.ErrorS(err, "Failed to send admission decision record", "url", s.config.URL, "uid", record.UID)
+		}
+	}
+}
+
+func (s *httpSink) send(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if s.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package admissionreview
 import (
 	"context"
 
+	admissionv1 "k8s.io/api/admission/v1"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -10,10 +11,15 @@ import (
 	"k8s.io/apiserver/pkg/registry/rest"
 )
 
+// Deprecated: use AdmissionV1HookFuncWithError.
 type AdmissionHookFunc func(admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
 
+// REST serves an admission hook for admission.k8s.io/v1beta1 AdmissionReviews only. The reviews are handled by a
+// V1REST with the default HookOptions.
+//
+// Deprecated: use V1REST, which serves v1beta1 AdmissionReviews too.
 type REST struct {
-	hookFn AdmissionHookFunc
+	v1 *V1REST
 }
 
 var _ rest.Creater = &REST{}
@@ -21,9 +27,12 @@ var _ rest.Scoper = &REST{}
 var _ rest.GroupVersionKindProvider = &REST{}
 var _ rest.SingularNameProvider = &REST{}
 
+// Deprecated: use NewV1RESTWithOptions.
 func NewREST(hookFn AdmissionHookFunc) *REST {
 	return &REST{
-		hookFn: hookFn,
+		v1: NewV1RESTWithOptions(func(_ context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+			return ConvertV1Beta1ResponseToV1(hookFn(ConvertV1RequestToV1Beta1(admissionSpec))), nil
+		}, HookOptions{}),
 	}
 }
 
@@ -45,10 +54,14 @@ func (r *REST) NamespaceScoped() bool {
 
 func (r *REST) Create(ctx context.Context, obj runtime.Object, _ rest.ValidateObjectFunc, _ *metav1.CreateOptions) (runtime.Object, error) {
 	admissionReview := obj.(*admissionv1beta1.AdmissionReview)
-	admissionReview.Response = r.hookFn(admissionReview.Request)
+	out, err := r.v1.Create(ctx, &admissionv1.AdmissionReview{Request: ConvertV1Beta1RequestToV1(admissionReview.Request)}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	admissionReview.Response = ConvertV1ResponseToV1Beta1(out.(*admissionv1.AdmissionReview).Response)
 	return admissionReview, nil
 }
 
 func (r *REST) GetSingularName() string {
-	return "admissionreview"
+	return r.v1.GetSingularName()
 }
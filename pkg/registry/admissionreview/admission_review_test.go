@@ -0,0 +1,36 @@
+package admissionreview
+
+import (
+	"context"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+)
+
+func TestDeprecatedREST(t *testing.T) {
+	rest := NewREST(func(admissionSpec *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+		return &admissionv1beta1.AdmissionResponse{Allowed: admissionSpec.Name == "allowed"}
+	})
+	for _, name := range []string{"allowed", "denied"} {
+		out, err := rest.Create(context.Background(), &admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{UID: "uid", Name: name}}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := out.(*admissionv1beta1.AdmissionReview).Response
+		if response == nil || response.Allowed != (name == "allowed") || response.UID != "uid" {
+			t.Errorf("%s: unexpected response %#v", name, response)
+		}
+	}
+
+	v1REST := NewV1REST(func(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	})
+	out, err := v1REST.Create(context.Background(), &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: "uid"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := out.(*admissionv1.AdmissionReview).Response; response == nil || !response.Allowed || response.UID != "uid" {
+		t.Errorf("unexpected response %#v", response)
+	}
+}
@@ -2,28 +2,53 @@ package admissionreview
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apiserver/pkg/registry/rest"
 )
 
+// Deprecated: use AdmissionV1HookFuncWithError.
 type AdmissionV1HookFunc func(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
 
+// AdmissionV1HookFuncWithError is an admission hook function getting the request context. Errors deny the request
+// with the status of the error.
+type AdmissionV1HookFuncWithError func(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error)
+
+// V1REST serves an admission hook for admission.k8s.io/v1 AdmissionReviews. It accepts v1beta1 AdmissionReviews
+// too, which are converted to v1 for the hook and responded to in v1beta1.
 type V1REST struct {
-	hookFn AdmissionV1HookFunc
+	hookFn  AdmissionV1HookFuncWithError
+	options HookOptions
 }
 
 var _ rest.Creater = &V1REST{}
 var _ rest.Scoper = &V1REST{}
 var _ rest.GroupVersionKindProvider = &V1REST{}
 var _ rest.SingularNameProvider = &V1REST{}
+var _ rest.GroupVersionAcceptor = &V1REST{}
 
+// NewV1REST returns a V1REST serving hookFn with the default HookOptions.
+//
+// Deprecated: use NewV1RESTWithOptions.
 func NewV1REST(hookFn AdmissionV1HookFunc) *V1REST {
+	return NewV1RESTWithOptions(func(_ context.Context, admissionSpec *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		return hookFn(admissionSpec), nil
+	}, HookOptions{})
+}
+
+// NewV1RESTWithOptions returns a V1REST serving hookFn as described by options.
+func NewV1RESTWithOptions(hookFn AdmissionV1HookFuncWithError, options HookOptions) *V1REST {
 	return &V1REST{
-		hookFn: hookFn,
+		hookFn:  hookFn,
+		options: options,
 	}
 }
 
@@ -39,18 +64,114 @@ func (r *V1REST) GroupVersionKind(containingGV schema.GroupVersion) schema.Group
 	return admissionv1.SchemeGroupVersion.WithKind("AdmissionReview")
 }
 
+func (r *V1REST) AcceptsGroupVersion(gv schema.GroupVersion) bool {
+	return gv == admissionv1.SchemeGroupVersion || gv == admissionv1beta1.SchemeGroupVersion
+}
+
 func (r *V1REST) NamespaceScoped() bool {
 	return false
 }
 
 func (r *V1REST) Create(ctx context.Context, obj runtime.Object, _ rest.ValidateObjectFunc, _ *metav1.CreateOptions) (runtime.Object, error) {
 	admissionReview := obj.(*admissionv1.AdmissionReview)
-	admissionReview.Response = r.hookFn(admissionReview.Request)
-	// Copey request uid to response
+	if admissionReview.Request == nil {
+		return nil, apierrors.NewBadRequest("the AdmissionReview has no request")
+	}
+	if kind, value, exempt := r.options.Exemptions.Exempt(admissionReview.Request); exempt {
+		recordExemption(r.options, admissionReview.Request, kind)
+		admissionReview.Response = exemptionResponse(admissionReview.Request, kind, value)
+		return reviewInVersion(admissionReview)
+	}
+	matches, err := r.options.matches(ctx, admissionReview.Request)
+	if err == nil && !matches {
+		recordUnmatched(r.options, admissionReview.Request)
+		admissionReview.Response = &admissionv1.AdmissionResponse{UID: admissionReview.Request.UID, Allowed: true}
+		return reviewInVersion(admissionReview)
+	}
+
+	start := time.Now()
+	spanCtx, span := r.options.startSpan(ctx, admissionReview.Request)
+	var response *admissionv1.AdmissionResponse
+	if err == nil {
+		response, err = r.callHook(spanCtx, admissionReview.Request)
+	}
+	if err != nil {
+		response = &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result:  StatusForError(requestGroupKind(admissionReview.Request.Kind), admissionReview.Request.Name, err),
+		}
+	}
+	response = r.options.conform(admissionReview.Request, response)
+	endSpan(spanCtx, span, response, err)
+	// metrics, the decision log and captures get the decision of the hook, the caller the enforced one
+	recordAdmission(r.options, admissionReview.Request, response, err, time.Since(start))
+	r.options.DecisionLogger.Log(r.options.Resource, string(r.options.enforcementMode()), admissionReview.Request, response)
+	r.options.Capturer.Capture(r.options.Resource, admissionReview.Request, response)
+	admissionReview.Response = r.options.enforce(response)
+	// the enforced response is a new one in warn and audit mode
 	admissionReview.Response.UID = admissionReview.Request.UID
-	return admissionReview, nil
+
+	return reviewInVersion(admissionReview)
+}
+
+// reviewInVersion returns the review in the version it was sent in.
+func reviewInVersion(review *admissionv1.AdmissionReview) (runtime.Object, error) {
+	if review.APIVersion == admissionv1beta1.SchemeGroupVersion.String() {
+		return v1beta1Review(review)
+	}
+	return review, nil
+}
+
+// v1beta1Review returns the review in v1beta1. The generic API server encodes everything returned by the storage in
+// the storage version, which is v1. Hence the review is encoded here and passed on as runtime.Unknown, which is
+// written as it is.
+func v1beta1Review(review *admissionv1.AdmissionReview) (runtime.Object, error) {
+	data, err := json.Marshal(&admissionv1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionv1beta1.SchemeGroupVersion.String(),
+			Kind:       "AdmissionReview",
+		},
+		Request:  ConvertV1RequestToV1Beta1(review.Request),
+		Response: ConvertV1ResponseToV1Beta1(review.Response),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.Unknown{Raw: data, ContentType: runtime.ContentTypeJSON}, nil
 }
 
 func (r *V1REST) GetSingularName() string {
+	if len(r.options.Singular) > 0 {
+		return r.options.Singular
+	}
 	return "admissionreview"
 }
+
+// Verify calls the admission hook with the request and returns the violations of the admission protocol by its
+// response, before they are fixed up or turn into denials. Errors of the hook are not violations. Panics are not
+// recovered from.
+func (r *V1REST) Verify(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) []Violation {
+	response, err := r.hookFn(ctx, admissionSpec)
+	if err != nil {
+		return nil
+	}
+	return VerifyResponse(r.options.Type, admissionSpec, response)
+}
+
+// callHook calls the admission hook, recovering from panics according to the hook options.
+func (r *V1REST) callHook(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (response *admissionv1.AdmissionResponse, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			var uid types.UID
+			if admissionSpec != nil {
+				uid = admissionSpec.UID
+			}
+			if status := r.options.handlePanic(uid, p); status != nil {
+				response, err = &admissionv1.AdmissionResponse{Allowed: false, Result: status}, nil
+			} else {
+				response, err = &admissionv1.AdmissionResponse{Allowed: true, Warnings: []string{r.options.panicWarning()}}, nil
+			}
+		}
+	}()
+	return r.hookFn(ctx, admissionSpec)
+}
@@ -0,0 +1,174 @@
+package admissionreview
+
+import (
+	"fmt"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+// ConformanceMode is how responses of an admission hook violating the admission protocol are handled.
+type ConformanceMode string
+
+const (
+	// ConformanceModeLenient fixes up violations where possible and logs them. This is the default.
+	ConformanceModeLenient ConformanceMode = "lenient"
+	// ConformanceModeStrict denies requests the hook responded to in violation of the admission protocol.
+	ConformanceModeStrict ConformanceMode = "strict"
+)
+
+// ParseConformanceMode parses the name of a conformance mode.
+func ParseConformanceMode(s string) (ConformanceMode, error) {
+	switch mode := ConformanceMode(s); mode {
+	case ConformanceModeLenient, ConformanceModeStrict:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown conformance mode %q, must be one of lenient or strict", s)
+	}
+}
+
+// HookType is the type of admission an admission hook does.
+type HookType string
+
+const (
+	HookTypeValidating HookType = "validating"
+	HookTypeMutating   HookType = "mutating"
+)
+
+// ResponseRule is a rule of the admission protocol the responses of admission hooks must follow.
+type ResponseRule string
+
+const (
+	// RuleResponseRequired requires a response from hooks that return no error.
+	RuleResponseRequired ResponseRule = "ResponseRequired"
+	// RuleUIDMatchesRequest requires the UID of a response, if set, to be the one of the request.
+	RuleUIDMatchesRequest ResponseRule = "UIDMatchesRequest"
+	// RuleNoPatchFromValidatingHook forbids patches in responses of validating hooks.
+	RuleNoPatchFromValidatingHook ResponseRule = "NoPatchFromValidatingHook"
+	// RuleNoPatchOnDenial forbids patches in responses denying the request.
+	RuleNoPatchOnDenial ResponseRule = "NoPatchOnDenial"
+	// RulePatchTypeWithPatch requires a patch type with every patch, and no patch type without a patch.
+	RulePatchTypeWithPatch ResponseRule = "PatchTypeWithPatch"
+	// RuleSupportedPatchType requires the patch type to be JSONPatch, the only one supported by Kubernetes.
+	RuleSupportedPatchType ResponseRule = "SupportedPatchType"
+	// RuleValidPatch requires patches to decode and apply to the object of the request.
+	RuleValidPatch ResponseRule = "ValidPatch"
+	// RuleImmutableIdentity forbids patches changing the name, namespace or uid of the object, which the API server
+	// rejects.
+	RuleImmutableIdentity ResponseRule = "ImmutableIdentity"
+)
+
+// Violation is a violation of a rule of the admission protocol by a response of an admission hook.
+type Violation struct {
+	Rule    ResponseRule
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+// fixable tells whether a violation of the rule can be fixed up without guessing what the hook meant. Changes of the
+// identity of objects are only flagged with a warning. A missing response is not fixed up, which would allow requests
+// a failing hook did not decide about.
+func (r ResponseRule) fixable() bool {
+	return r != RuleResponseRequired && r != RuleSupportedPatchType && r != RuleValidPatch
+}
+
+// VerifyResponse returns the violations of the admission protocol by the response of an admission hook of the given
+// type to the request. The origin of patches is not verified for hooks of unknown type. Patches allowing the request
+// are applied to its object to verify them, if it has one.
+func VerifyResponse(hookType HookType, request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse) []Violation {
+	if response == nil {
+		return []Violation{{Rule: RuleResponseRequired, Message: "the hook returned neither a response nor an error"}}
+	}
+
+	var violations []Violation
+	if request != nil && len(response.UID) > 0 && response.UID != request.UID {
+		violations = append(violations, Violation{Rule: RuleUIDMatchesRequest, Message: fmt.Sprintf("the response has the UID %q instead of the UID %q of the request", response.UID, request.UID)})
+	}
+	hasPatch := len(response.Patch) > 0
+	if hookType == HookTypeValidating && (hasPatch || response.PatchType != nil) {
+		violations = append(violations, Violation{Rule: RuleNoPatchFromValidatingHook, Message: "validating hooks must not patch objects"})
+		return violations
+	}
+	if !response.Allowed && hasPatch {
+		violations = append(violations, Violation{Rule: RuleNoPatchOnDenial, Message: "denials must not patch objects"})
+	}
+	switch {
+	case hasPatch && response.PatchType == nil:
+		violations = append(violations, Violation{Rule: RulePatchTypeWithPatch, Message: "the patch has no patch type"})
+	case !hasPatch && response.PatchType != nil:
+		violations = append(violations, Violation{Rule: RulePatchTypeWithPatch, Message: "the patch type is set without a patch"})
+	case hasPatch && *response.PatchType != admissionv1.PatchTypeJSONPatch:
+		violations = append(violations, Violation{Rule: RuleSupportedPatchType, Message: fmt.Sprintf("unsupported patch type %q, must be %s", *response.PatchType, admissionv1.PatchTypeJSONPatch)})
+		return violations
+	}
+	if hasPatch && response.Allowed && request != nil && len(request.Object.Raw) > 0 {
+		violations = append(violations, verifyPatch(request.Object.Raw, response)...)
+	}
+	return violations
+}
+
+// verifyPatch applies the patch of the response to the object and returns the violations of the patch.
+func verifyPatch(obj []byte, response *admissionv1.AdmissionResponse) []Violation {
+	patched, err := ApplyPatch(obj, response)
+	if err != nil {
+		return []Violation{{Rule: RuleValidPatch, Message: err.Error()}}
+	}
+	changed, err := changedIdentityFields(obj, patched)
+	if err != nil {
+		return []Violation{{Rule: RuleValidPatch, Message: err.Error()}}
+	}
+	if len(changed) > 0 {
+		return []Violation{{Rule: RuleImmutableIdentity, Message: fmt.Sprintf("the patch changes %s", strings.Join(changed, ", "))}}
+	}
+	return nil
+}
+
+func (o HookOptions) conformanceMode() ConformanceMode {
+	if len(o.ConformanceMode) == 0 {
+		return ConformanceModeLenient
+	}
+	return o.ConformanceMode
+}
+
+// conform returns the response of the hook to send after verifying it. Violations of the admission protocol are
+// logged and counted. In strict mode, and for violations which cannot be fixed up, the request is denied. Otherwise
+// the violations are fixed up, and patches changing the identity of the object are flagged with a warning. The UID
+// of the response is the one of the request in any case.
+func (o HookOptions) conform(request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse) *admissionv1.AdmissionResponse {
+	violations := VerifyResponse(o.Type, request, response)
+	fixable := o.conformanceMode() == ConformanceModeLenient
+	for _, v := range violations {
+		klog.InfoS("Admission hook responded in violation of the admission protocol", "resource", o.Resource.String(), "uid", request.UID, "rule", v.Rule, "message", v.Message)
+		recordViolation(o.Resource, v.Rule)
+		fixable = fixable && v.Rule.fixable()
+	}
+	if len(violations) > 0 && !fixable {
+		messages := make([]string, 0, len(violations))
+		for _, v := range violations {
+			messages = append(messages, v.String())
+		}
+		status := apierrors.NewInternalError(fmt.Errorf("admission hook for %s responded in violation of the admission protocol: %s", o.Resource.GroupResource(), strings.Join(messages, "; "))).Status()
+		return &admissionv1.AdmissionResponse{UID: request.UID, Allowed: false, Result: &status}
+	}
+
+	fixed := *response
+	fixed.UID = request.UID
+	switch {
+	case o.Type == HookTypeValidating || !fixed.Allowed || len(fixed.Patch) == 0:
+		fixed.Patch, fixed.PatchType = nil, nil
+	case fixed.PatchType == nil:
+		patchType := admissionv1.PatchTypeJSONPatch
+		fixed.PatchType = &patchType
+	}
+	for _, v := range violations {
+		if v.Rule == RuleImmutableIdentity {
+			fixed.Warnings = append(append([]string(nil), fixed.Warnings...), fmt.Sprintf("admission hook for %s responded in violation of the admission protocol: %s", o.Resource.GroupResource(), v.Message))
+		}
+	}
+	return &fixed
+}
@@ -0,0 +1,286 @@
+package admissionreview
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestConformance(t *testing.T) {
+	jsonPatch := admissionv1.PatchTypeJSONPatch
+	otherPatch := admissionv1.PatchType("MergePatch")
+	patch := []byte(`[{"op":"add","path":"/metadata/labels","value":{"a":"b"}}]`)
+
+	cases := []struct {
+		name       string
+		hookType   HookType
+		response   *admissionv1.AdmissionResponse
+		violations []ResponseRule
+		lenient    *admissionv1.AdmissionResponse
+	}{
+		{
+			name:     "allowed",
+			hookType: HookTypeValidating,
+			response: &admissionv1.AdmissionResponse{Allowed: true, Warnings: []string{"foo"}},
+			lenient:  &admissionv1.AdmissionResponse{Allowed: true, Warnings: []string{"foo"}},
+		},
+		{
+			name:     "mutation",
+			hookType: HookTypeMutating,
+			response: &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &jsonPatch},
+			lenient:  &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &jsonPatch},
+		},
+		{
+			name:       "nil response",
+			hookType:   HookTypeValidating,
+			violations: []ResponseRule{RuleResponseRequired},
+		},
+		{
+			name:       "other uid",
+			hookType:   HookTypeValidating,
+			response:   &admissionv1.AdmissionResponse{UID: "other", Allowed: true},
+			violations: []ResponseRule{RuleUIDMatchesRequest},
+			lenient:    &admissionv1.AdmissionResponse{Allowed: true},
+		},
+		{
+			name:       "patch of validating hook",
+			hookType:   HookTypeValidating,
+			response:   &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &jsonPatch},
+			violations: []ResponseRule{RuleNoPatchFromValidatingHook},
+			lenient:    &admissionv1.AdmissionResponse{Allowed: true},
+		},
+		{
+			name:       "patch type of validating hook",
+			hookType:   HookTypeValidating,
+			response:   &admissionv1.AdmissionResponse{Allowed: true, PatchType: &jsonPatch},
+			violations: []ResponseRule{RuleNoPatchFromValidatingHook},
+			lenient:    &admissionv1.AdmissionResponse{Allowed: true},
+		},
+		{
+			name:     "patch of hook of unknown type",
+			response: &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &jsonPatch},
+			lenient:  &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &jsonPatch},
+		},
+		{
+			name:       "patch without patch type",
+			hookType:   HookTypeMutating,
+			response:   &admissionv1.AdmissionResponse{Allowed: true, Patch: patch},
+			violations: []ResponseRule{RulePatchTypeWithPatch},
+			lenient:    &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &jsonPatch},
+		},
+		{
+			name:       "patch type without patch",
+			hookType:   HookTypeMutating,
+			response:   &admissionv1.AdmissionResponse{Allowed: true, PatchType: &jsonPatch},
+			violations: []ResponseRule{RulePatchTypeWithPatch},
+			lenient:    &admissionv1.AdmissionResponse{Allowed: true},
+		},
+		{
+			name:       "patch on denial",
+			hookType:   HookTypeMutating,
+			response:   &admissionv1.AdmissionResponse{Allowed: false, Result: &metav1.Status{Message: "no"}, Patch: patch, PatchType: &jsonPatch},
+			violations: []ResponseRule{RuleNoPatchOnDenial},
+			lenient:    &admissionv1.AdmissionResponse{Allowed: false, Result: &metav1.Status{Message: "no"}},
+		},
+		{
+			name:       "unsupported patch type",
+			hookType:   HookTypeMutating,
+			response:   &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &otherPatch},
+			violations: []ResponseRule{RuleSupportedPatchType},
+		},
+	}
+
+	resource := schema.GroupVersionResource{Group: "conformance.test.io", Version: "v1", Resource: "hooks"}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := &admissionv1.AdmissionRequest{UID: "uid", Operation: admissionv1.Create}
+
+			var rules []ResponseRule
+			for _, v := range VerifyResponse(c.hookType, request, c.response) {
+				rules = append(rules, v.Rule)
+			}
+			if !reflect.DeepEqual(rules, c.violations) {
+				t.Errorf("expected violations %v, got %v", c.violations, rules)
+			}
+
+			for _, mode := range []ConformanceMode{"", ConformanceModeLenient, ConformanceModeStrict} {
+				rest := NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+					return c.response.DeepCopy(), nil
+				}, HookOptions{Resource: resource, Type: c.hookType, ConformanceMode: mode})
+				if violations := rest.Verify(context.Background(), request); len(violations) != len(c.violations) {
+					t.Errorf("%q: expected %d violations, got %v", mode, len(c.violations), violations)
+				}
+
+				review := &admissionv1.AdmissionReview{Request: request.DeepCopy()}
+				if _, err := rest.Create(context.Background(), review, nil, nil); err != nil {
+					t.Fatal(err)
+				}
+				if review.Response.UID != "uid" {
+					t.Errorf("%q: expected the uid of the request, got %q", mode, review.Response.UID)
+				}
+
+				if len(c.violations) == 0 || (mode != ConformanceModeStrict && c.lenient != nil) {
+					want := c.lenient.DeepCopy()
+					want.UID = "uid"
+					if !reflect.DeepEqual(review.Response, want) {
+						t.Errorf("%q: expected %#v, got %#v", mode, want, review.Response)
+					}
+					continue
+				}
+				if review.Response.Allowed || review.Response.Result == nil || review.Response.Result.Code != http.StatusInternalServerError {
+					t.Fatalf("%q: expected an internal error denial, got %#v", mode, review.Response)
+				}
+				if !strings.Contains(review.Response.Result.Message, "admission hook for hooks.conformance.test.io responded in violation of the admission protocol: "+string(c.violations[0])) {
+					t.Errorf("%q: unexpected message %q", mode, review.Response.Result.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateEchoesUIDInV1Beta1(t *testing.T) {
+	rest := NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		return &admissionv1.AdmissionResponse{Allowed: true}, nil
+	}, HookOptions{Resource: schema.GroupVersionResource{Group: "conformance.test.io", Version: "v1", Resource: "hooks"}})
+
+	review := &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1beta1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request:  &admissionv1.AdmissionRequest{UID: "uid", Operation: admissionv1.Create},
+	}
+	obj, err := rest.Create(context.Background(), review, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(obj.(*runtime.Unknown).Raw, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Response == nil || out.Response.UID != "uid" || !out.Response.Allowed {
+		t.Errorf("expected an allowed response with the uid of the request, got %#v", out.Response)
+	}
+}
+
+func TestCreateWithoutRequest(t *testing.T) {
+	rest := NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		t.Fatal("unexpected call of the hook")
+		return nil, nil
+	}, HookOptions{})
+
+	if _, err := rest.Create(context.Background(), &admissionv1.AdmissionReview{}, nil, nil); !apierrors.IsBadRequest(err) {
+		t.Errorf("expected a bad request error, got %v", err)
+	}
+}
+
+func TestParseConformanceMode(t *testing.T) {
+	for _, s := range []string{"lenient", "strict"} {
+		if mode, err := ParseConformanceMode(s); err != nil || string(mode) != s {
+			t.Errorf("expected %q to parse, got %q, %v", s, mode, err)
+		}
+	}
+	if _, err := ParseConformanceMode("loose"); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+}
+
+func TestPatchVerification(t *testing.T) {
+	jsonPatch := admissionv1.PatchTypeJSONPatch
+	resource := schema.GroupVersionResource{Group: "conformance.test.io", Version: "v1", Resource: "hooks"}
+
+	cases := []struct {
+		name      string
+		object    string
+		patch     string
+		violation ResponseRule
+		message   string
+	}{
+		{
+			name:   "applies",
+			object: `{"metadata":{"name":"foo","namespace":"ns"}}`,
+			patch:  `[{"op":"add","path":"/metadata/labels","value":{"a":"b"}}]`,
+		},
+		{
+			name:   "sets the name of a generated name",
+			object: `{"metadata":{"generateName":"foo-","namespace":"ns"}}`,
+			patch:  `[{"op":"add","path":"/metadata/name","value":"foo-1"}]`,
+		},
+		{
+			name:      "malformed",
+			object:    `{"metadata":{"name":"foo","namespace":"ns"}}`,
+			patch:     `{"op":"add"}`,
+			violation: RuleValidPatch,
+			message:   "ValidPatch: unable to decode patch",
+		},
+		{
+			name:      "does not apply",
+			object:    `{"metadata":{"name":"foo","namespace":"ns"}}`,
+			patch:     `[{"op":"remove","path":"/spec/replicas"}]`,
+			violation: RuleValidPatch,
+			message:   "ValidPatch: unable to apply patch",
+		},
+		{
+			name:      "changes the name",
+			object:    `{"metadata":{"name":"foo","namespace":"ns","uid":"1"}}`,
+			patch:     `[{"op":"replace","path":"/metadata/name","value":"bar"},{"op":"remove","path":"/metadata/uid"}]`,
+			violation: RuleImmutableIdentity,
+			message:   "the patch changes metadata.name, metadata.uid",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := &admissionv1.AdmissionRequest{UID: "uid", Operation: admissionv1.Create, Object: runtime.RawExtension{Raw: []byte(c.object)}}
+			response := &admissionv1.AdmissionResponse{Allowed: true, Patch: []byte(c.patch), PatchType: &jsonPatch}
+
+			violations := VerifyResponse(HookTypeMutating, request, response)
+			if len(c.violation) == 0 {
+				if len(violations) > 0 {
+					t.Fatalf("unexpected violations %v", violations)
+				}
+				return
+			}
+			if len(violations) != 1 || violations[0].Rule != c.violation {
+				t.Fatalf("expected a %s violation, got %v", c.violation, violations)
+			}
+
+			for _, mode := range []ConformanceMode{ConformanceModeLenient, ConformanceModeStrict} {
+				rest := NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+					return response.DeepCopy(), nil
+				}, HookOptions{Resource: resource, Type: HookTypeMutating, ConformanceMode: mode})
+				review := &admissionv1.AdmissionReview{Request: request.DeepCopy()}
+				if _, err := rest.Create(context.Background(), review, nil, nil); err != nil {
+					t.Fatal(err)
+				}
+
+				if c.violation == RuleImmutableIdentity && mode == ConformanceModeLenient {
+					want := &admissionv1.AdmissionResponse{
+						UID:       "uid",
+						Allowed:   true,
+						Patch:     []byte(c.patch),
+						PatchType: &jsonPatch,
+						Warnings:  []string{"admission hook for hooks.conformance.test.io responded in violation of the admission protocol: " + c.message},
+					}
+					if !reflect.DeepEqual(review.Response, want) {
+						t.Errorf("expected %#v, got %#v", want, review.Response)
+					}
+					continue
+				}
+				if review.Response.Allowed || len(review.Response.Patch) > 0 || review.Response.Result == nil {
+					t.Fatalf("%q: expected a denial without patch, got %#v", mode, review.Response)
+				}
+				if !strings.Contains(review.Response.Result.Message, "admission hook for hooks.conformance.test.io") || !strings.Contains(review.Response.Result.Message, c.message) {
+					t.Errorf("%q: expected the message to name the hook and contain %q, got %q", mode, c.message, review.Response.Result.Message)
+				}
+			}
+		})
+	}
+}
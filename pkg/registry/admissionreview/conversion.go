@@ -0,0 +1,109 @@
+package admissionreview
+
+import (
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AddConversionFuncs registers the conversion of v1beta1 AdmissionReviews to v1 with the scheme, which lets V1REST
+// decode reviews of both versions.
+func AddConversionFuncs(scheme *runtime.Scheme) error {
+	return scheme.AddConversionFunc((*admissionv1beta1.AdmissionReview)(nil), (*admissionv1.AdmissionReview)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		in, out := a.(*admissionv1beta1.AdmissionReview), b.(*admissionv1.AdmissionReview)
+		// the api version is kept on purpose, it tells V1REST which version to respond with
+		out.TypeMeta = in.TypeMeta
+		out.Request = ConvertV1Beta1RequestToV1(in.Request)
+		out.Response = ConvertV1Beta1ResponseToV1(in.Response)
+		return nil
+	})
+}
+
+// ConvertV1Beta1RequestToV1 converts a v1beta1 AdmissionRequest to v1. The two versions have the same fields.
+func ConvertV1Beta1RequestToV1(in *admissionv1beta1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	if in == nil {
+		return nil
+	}
+	return &admissionv1.AdmissionRequest{
+		UID:                in.UID,
+		Kind:               in.Kind,
+		Resource:           in.Resource,
+		SubResource:        in.SubResource,
+		RequestKind:        in.RequestKind,
+		RequestResource:    in.RequestResource,
+		RequestSubResource: in.RequestSubResource,
+		Name:               in.Name,
+		Namespace:          in.Namespace,
+		Operation:          admissionv1.Operation(in.Operation),
+		UserInfo:           in.UserInfo,
+		Object:             in.Object,
+		OldObject:          in.OldObject,
+		DryRun:             in.DryRun,
+		Options:            in.Options,
+	}
+}
+
+// ConvertV1RequestToV1Beta1 converts a v1 AdmissionRequest to v1beta1. The two versions have the same fields.
+func ConvertV1RequestToV1Beta1(in *admissionv1.AdmissionRequest) *admissionv1beta1.AdmissionRequest {
+	if in == nil {
+		return nil
+	}
+	return &admissionv1beta1.AdmissionRequest{
+		UID:                in.UID,
+		Kind:               in.Kind,
+		Resource:           in.Resource,
+		SubResource:        in.SubResource,
+		RequestKind:        in.RequestKind,
+		RequestResource:    in.RequestResource,
+		RequestSubResource: in.RequestSubResource,
+		Name:               in.Name,
+		Namespace:          in.Namespace,
+		Operation:          admissionv1beta1.Operation(in.Operation),
+		UserInfo:           in.UserInfo,
+		Object:             in.Object,
+		OldObject:          in.OldObject,
+		DryRun:             in.DryRun,
+		Options:            in.Options,
+	}
+}
+
+// ConvertV1Beta1ResponseToV1 converts a v1beta1 AdmissionResponse to v1. The two versions have the same fields.
+func ConvertV1Beta1ResponseToV1(in *admissionv1beta1.AdmissionResponse) *admissionv1.AdmissionResponse {
+	if in == nil {
+		return nil
+	}
+	out := &admissionv1.AdmissionResponse{
+		UID:              in.UID,
+		Allowed:          in.Allowed,
+		Result:           in.Result,
+		Patch:            in.Patch,
+		AuditAnnotations: in.AuditAnnotations,
+		Warnings:         in.Warnings,
+	}
+	if in.PatchType != nil {
+		patchType := admissionv1.PatchType(*in.PatchType)
+		out.PatchType = &patchType
+	}
+	return out
+}
+
+// ConvertV1ResponseToV1Beta1 converts a v1 AdmissionResponse to v1beta1. The two versions have the same fields.
+func ConvertV1ResponseToV1Beta1(in *admissionv1.AdmissionResponse) *admissionv1beta1.AdmissionResponse {
+	if in == nil {
+		return nil
+	}
+	out := &admissionv1beta1.AdmissionResponse{
+		UID:              in.UID,
+		Allowed:          in.Allowed,
+		Result:           in.Result,
+		Patch:            in.Patch,
+		AuditAnnotations: in.AuditAnnotations,
+		Warnings:         in.Warnings,
+	}
+	if in.PatchType != nil {
+		patchType := admissionv1beta1.PatchType(*in.PatchType)
+		out.PatchType = &patchType
+	}
+	return out
+}
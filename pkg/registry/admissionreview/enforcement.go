@@ -0,0 +1,65 @@
+package admissionreview
+
+import (
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// EnforcementMode is how the decisions of an admission hook are enforced.
+type EnforcementMode string
+
+const (
+	// EnforcementModeEnforce responds with the decisions of the hook as they are. This is the default.
+	EnforcementModeEnforce EnforcementMode = "enforce"
+	// EnforcementModeWarn turns denials into warnings of an allowed response.
+	EnforcementModeWarn EnforcementMode = "warn"
+	// EnforcementModeAudit allows every request without warnings or patches. Denials are only recorded in metrics
+	// and the decision log.
+	EnforcementModeAudit EnforcementMode = "audit"
+)
+
+// ParseEnforcementMode parses the name of an enforcement mode.
+func ParseEnforcementMode(s string) (EnforcementMode, error) {
+	switch mode := EnforcementMode(s); mode {
+	case EnforcementModeEnforce, EnforcementModeWarn, EnforcementModeAudit:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown enforcement mode %q, must be one of enforce, warn or audit", s)
+	}
+}
+
+func (o HookOptions) enforcementMode() EnforcementMode {
+	if len(o.EnforcementMode) == 0 {
+		return EnforcementModeEnforce
+	}
+	return o.EnforcementMode
+}
+
+// enforce returns the response to send for the given response of the hook according to the enforcement mode.
+func (o HookOptions) enforce(response *admissionv1.AdmissionResponse) *admissionv1.AdmissionResponse {
+	switch o.enforcementMode() {
+	case EnforcementModeWarn:
+		if response.Allowed {
+			return response
+		}
+		warnings := make([]string, 0, len(response.Warnings)+1)
+		warnings = append(warnings, response.Warnings...)
+		return &admissionv1.AdmissionResponse{
+			Allowed:          true,
+			AuditAnnotations: response.AuditAnnotations,
+			Warnings:         append(warnings, o.denialWarning(response)),
+		}
+	case EnforcementModeAudit:
+		return &admissionv1.AdmissionResponse{Allowed: true, AuditAnnotations: response.AuditAnnotations}
+	default:
+		return response
+	}
+}
+
+func (o HookOptions) denialWarning(response *admissionv1.AdmissionResponse) string {
+	if response.Result != nil && len(response.Result.Message) > 0 {
+		return fmt.Sprintf("admission hook for %s would deny the request: %s", o.Resource.GroupResource(), response.Result.Message)
+	}
+	return fmt.Sprintf("admission hook for %s would deny the request", o.Resource.GroupResource())
+}
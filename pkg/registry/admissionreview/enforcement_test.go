@@ -0,0 +1,91 @@
+package admissionreview
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestEnforcementModes(t *testing.T) {
+	denial := &admissionv1.AdmissionResponse{
+		Allowed:          false,
+		Result:           &metav1.Status{Status: metav1.StatusFailure, Code: http.StatusForbidden, Message: "no foo"},
+		Warnings:         []string{"foo is deprecated"},
+		AuditAnnotations: map[string]string{"policy": "foo"},
+	}
+	jsonPatch := admissionv1.PatchTypeJSONPatch
+	mutation := &admissionv1.AdmissionResponse{Allowed: true, Patch: []byte(`[]`), PatchType: &jsonPatch}
+
+	cases := []struct {
+		name     string
+		mode     EnforcementMode
+		response *admissionv1.AdmissionResponse
+		want     *admissionv1.AdmissionResponse
+	}{
+		{
+			name:     "default",
+			response: denial,
+			want:     denial,
+		},
+		{
+			name:     "enforce",
+			mode:     EnforcementModeEnforce,
+			response: denial,
+			want:     denial,
+		},
+		{
+			name:     "warn denial",
+			mode:     EnforcementModeWarn,
+			response: denial,
+			want: &admissionv1.AdmissionResponse{
+				Allowed:          true,
+				Warnings:         []string{"foo is deprecated", "admission hook for hooks.enforcement.test.io would deny the request: no foo"},
+				AuditAnnotations: map[string]string{"policy": "foo"},
+			},
+		},
+		{
+			name:     "warn mutation",
+			mode:     EnforcementModeWarn,
+			response: mutation,
+			want:     mutation,
+		},
+		{
+			name:     "audit denial",
+			mode:     EnforcementModeAudit,
+			response: denial,
+			want:     &admissionv1.AdmissionResponse{Allowed: true, AuditAnnotations: map[string]string{"policy": "foo"}},
+		},
+		{
+			name:     "audit mutation",
+			mode:     EnforcementModeAudit,
+			response: mutation,
+			want:     &admissionv1.AdmissionResponse{Allowed: true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rest := NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+				return c.response.DeepCopy(), nil
+			}, HookOptions{
+				Resource:        schema.GroupVersionResource{Group: "enforcement.test.io", Version: "v1", Resource: "hooks"},
+				EnforcementMode: c.mode,
+			})
+			review := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: "uid", Operation: admissionv1.Create}}
+			if _, err := rest.Create(context.Background(), review, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			want := c.want.DeepCopy()
+			want.UID = "uid"
+			if !reflect.DeepEqual(review.Response, want) {
+				t.Errorf("expected %#v, got %#v", want, review.Response)
+			}
+		})
+	}
+}
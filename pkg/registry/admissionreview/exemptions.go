@@ -0,0 +1,108 @@
+package admissionreview
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+)
+
+// ExemptionAuditAnnotation is the audit annotation recording why a request was exempted.
+const ExemptionAuditAnnotation = "exemption"
+
+// ExemptionKind is what exempted an admission request.
+type ExemptionKind string
+
+const (
+	ExemptionKindNamespace      ExemptionKind = "namespace"
+	ExemptionKindUser           ExemptionKind = "user"
+	ExemptionKindGroup          ExemptionKind = "group"
+	ExemptionKindServiceAccount ExemptionKind = "serviceaccount"
+)
+
+// Exemptions select admission requests which are allowed without calling the admission hooks.
+type Exemptions struct {
+	// Namespaces are glob patterns of the namespaces of exempted requests, like openshift-*. Requests for a
+	// namespace itself, including its creation, are in that namespace.
+	Namespaces []string
+	// Users are the names of exempted users.
+	Users []string
+	// Groups are the names of the groups of exempted users.
+	Groups []string
+	// ServiceAccounts are glob patterns of exempted service accounts in the form namespace/name, like
+	// kube-system/*.
+	ServiceAccounts []string
+}
+
+// Validate checks the patterns of the exemptions.
+func (e *Exemptions) Validate() error {
+	if e == nil {
+		return nil
+	}
+	var errs []error
+	for _, pattern := range e.Namespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid namespace pattern %q: %w", pattern, err))
+		}
+	}
+	for _, pattern := range e.ServiceAccounts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid service account pattern %q: %w", pattern, err))
+		} else if namespace, name, ok := strings.Cut(pattern, "/"); !ok || len(namespace) == 0 || len(name) == 0 || strings.Contains(name, "/") {
+			errs = append(errs, fmt.Errorf("invalid service account pattern %q, must be of the form namespace/name", pattern))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Exempt returns what exempts the request and the matching value, or false if nothing does.
+func (e *Exemptions) Exempt(request *admissionv1.AdmissionRequest) (ExemptionKind, string, bool) {
+	if e == nil || request == nil {
+		return "", "", false
+	}
+	namespace := request.Namespace
+	if len(namespace) == 0 && request.Resource.Group == "" && request.Resource.Resource == "namespaces" {
+		// the namespace of a request for a namespace is only set when the namespace exists, not on creation
+		namespace = request.Name
+	}
+	if len(namespace) > 0 {
+		for _, pattern := range e.Namespaces {
+			if matched, _ := path.Match(pattern, namespace); matched {
+				return ExemptionKindNamespace, namespace, true
+			}
+		}
+	}
+	username := request.UserInfo.Username
+	for _, user := range e.Users {
+		if user == username {
+			return ExemptionKindUser, username, true
+		}
+	}
+	for _, group := range e.Groups {
+		for _, userGroup := range request.UserInfo.Groups {
+			if group == userGroup {
+				return ExemptionKindGroup, group, true
+			}
+		}
+	}
+	if namespace, name, err := serviceaccount.SplitUsername(username); err == nil {
+		for _, pattern := range e.ServiceAccounts {
+			if matched, _ := path.Match(pattern, namespace+"/"+name); matched {
+				return ExemptionKindServiceAccount, namespace + "/" + name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// exemptionResponse returns the response allowing an exempted request, with the exemption as audit annotation.
+func exemptionResponse(request *admissionv1.AdmissionRequest, kind ExemptionKind, value string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		UID:              request.UID,
+		Allowed:          true,
+		AuditAnnotations: map[string]string{ExemptionAuditAnnotation: string(kind) + " " + value},
+	}
+}
@@ -0,0 +1,105 @@
+package admissionreview
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+var testExemptions = &Exemptions{
+	Namespaces:      []string{"kube-system", "openshift-*"},
+	Users:           []string{"system:admin"},
+	Groups:          []string{"system:nodes"},
+	ServiceAccounts: []string{"kube-system/*", "ops/deployer"},
+}
+
+func TestExempt(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		resource  metav1.GroupVersionResource
+		object    string
+		user      authenticationv1.UserInfo
+		kind      ExemptionKind
+		value     string
+	}{
+		{name: "namespace", namespace: "kube-system", kind: ExemptionKindNamespace, value: "kube-system"},
+		{name: "namespace pattern", namespace: "openshift-etcd", kind: ExemptionKindNamespace, value: "openshift-etcd"},
+		{name: "namespace creation", resource: metav1.GroupVersionResource{Version: "v1", Resource: "namespaces"}, object: "openshift-etcd", kind: ExemptionKindNamespace, value: "openshift-etcd"},
+		{name: "namespace update", namespace: "openshift-etcd", resource: metav1.GroupVersionResource{Version: "v1", Resource: "namespaces"}, object: "openshift-etcd", kind: ExemptionKindNamespace, value: "openshift-etcd"},
+		{name: "cluster-scoped object named like a namespace", resource: metav1.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}, object: "openshift-etcd"},
+		{name: "user", namespace: "default", user: authenticationv1.UserInfo{Username: "system:admin"}, kind: ExemptionKindUser, value: "system:admin"},
+		{name: "group", namespace: "default", user: authenticationv1.UserInfo{Username: "node", Groups: []string{"system:authenticated", "system:nodes"}}, kind: ExemptionKindGroup, value: "system:nodes"},
+		{name: "service account pattern", user: authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:replicaset-controller"}, kind: ExemptionKindServiceAccount, value: "kube-system/replicaset-controller"},
+		{name: "service account", namespace: "default", user: authenticationv1.UserInfo{Username: "system:serviceaccount:ops:deployer"}, kind: ExemptionKindServiceAccount, value: "ops/deployer"},
+		{name: "other service account", namespace: "default", user: authenticationv1.UserInfo{Username: "system:serviceaccount:ops:builder"}},
+		{name: "not exempted", namespace: "openshift", user: authenticationv1.UserInfo{Username: "alice", Groups: []string{"system:authenticated"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, value, exempt := testExemptions.Exempt(&admissionv1.AdmissionRequest{Namespace: tt.namespace, Resource: tt.resource, Name: tt.object, UserInfo: tt.user})
+			if exempt != (len(tt.kind) > 0) || kind != tt.kind || value != tt.value {
+				t.Errorf("expected exemption %q %q, got %q %q (%v)", tt.kind, tt.value, kind, value, exempt)
+			}
+		})
+	}
+
+	if _, _, exempt := (*Exemptions)(nil).Exempt(&admissionv1.AdmissionRequest{Namespace: "kube-system"}); exempt {
+		t.Error("expected no exemptions without config")
+	}
+}
+
+func TestValidateExemptions(t *testing.T) {
+	if err := testExemptions.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	err := (&Exemptions{Namespaces: []string{"openshift-["}, ServiceAccounts: []string{"deployer", "ops/"}}).Validate()
+	if err == nil {
+		t.Fatal("expected invalid patterns to be rejected")
+	}
+	for _, want := range []string{`namespace pattern "openshift-["`, `"deployer", must be of the form namespace/name`, `"ops/", must be`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestCreateExemptsRequests(t *testing.T) {
+	RegisterMetrics()
+	resource := schema.GroupVersionResource{Group: "exemptions.test.io", Version: "v1", Resource: "hooks"}
+	labels := []string{resource.Group, resource.Version, resource.Resource, "CREATE", "Deployment.apps", string(ExemptionKindNamespace)}
+
+	rest := NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		t.Error("the hook must not be called for exempted requests")
+		return nil, nil
+	}, HookOptions{Resource: resource, Exemptions: testExemptions, Match: func(context.Context, *admissionv1.AdmissionRequest) (bool, error) {
+		t.Error("the match criteria must not be evaluated for exempted requests")
+		return true, nil
+	}})
+	review := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Namespace: "openshift-monitoring",
+		Operation: admissionv1.Create,
+	}}
+	out, err := rest.Create(context.Background(), review, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := out.(*admissionv1.AdmissionReview).Response
+	if !response.Allowed || response.UID != "uid" {
+		t.Errorf("expected the exempted request to be allowed, got %#v", response)
+	}
+	if got := response.AuditAnnotations[ExemptionAuditAnnotation]; got != "namespace openshift-monitoring" {
+		t.Errorf("unexpected exemption audit annotation %q", got)
+	}
+	if got, err := testutil.GetCounterMetricValue(hookExemptions.WithLabelValues(labels...)); err != nil || got != 1 {
+		t.Errorf("expected one exempted request, got %v (%v)", got, err)
+	}
+}
@@ -0,0 +1,197 @@
+package admissionreview
+
+import (
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	metricsNamespace = "generic_admission_server"
+	metricsSubsystem = "hook"
+
+	decisionAllowed = "allowed"
+	decisionDenied  = "denied"
+)
+
+var (
+	// requestLabels identify the hook by the resource it is served on and the admission request by its operation
+	// and the group and kind of the object under admission.
+	requestLabels = []string{"group", "version", "resource", "operation", "kind"}
+
+	hookRequestDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "request_duration_seconds",
+			Help:           "Latency of admission hooks in seconds, by hook resource, operation, request kind, decision of the hook and enforcement mode.",
+			Buckets:        []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			StabilityLevel: metrics.ALPHA,
+		},
+		append(requestLabels, "decision", "enforcement"),
+	)
+
+	hookDecisions = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "decisions_total",
+			Help:           "Number of admission requests allowed and denied, by hook resource, operation, request kind, decision of the hook and enforcement mode.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		append(requestLabels, "decision", "enforcement"),
+	)
+
+	hookPatchSize = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "patch_size_bytes",
+			Help:           "Size of the patches returned by mutating admission hooks in bytes, by hook resource, operation and request kind.",
+			Buckets:        metrics.ExponentialBuckets(64, 4, 8),
+			StabilityLevel: metrics.ALPHA,
+		},
+		requestLabels,
+	)
+
+	hookWarnings = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "warnings_total",
+			Help:           "Number of warnings returned by admission hooks, by hook resource, operation and request kind.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		requestLabels,
+	)
+
+	hookErrors = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "errors_total",
+			Help:           "Number of errors returned by admission hooks, by hook resource, operation and request kind.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		requestLabels,
+	)
+
+	hookPanics = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "panics_total",
+			Help:           "Number of panics recovered from admission hooks, by the resource the hook is served on.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"group", "version", "resource"},
+	)
+
+	hookViolations = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "response_violations_total",
+			Help:           "Number of responses of admission hooks violating the admission protocol, by the resource the hook is served on and the violated rule.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"group", "version", "resource", "rule"},
+	)
+
+	hookUnmatched = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "unmatched_requests_total",
+			Help:           "Number of admission requests allowed without calling the admission hook because they do not match its criteria, by hook resource, operation and request kind.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		requestLabels,
+	)
+
+	hookExemptions = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "exempted_requests_total",
+			Help:           "Number of admission requests allowed without calling the admission hook because they are exempted, by hook resource, operation, request kind and kind of exemption.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		append(requestLabels, "exemption"),
+	)
+
+	registerMetrics sync.Once
+)
+
+// RegisterMetrics registers the admission hook metrics with the legacy registry, which the generic API server
+// serves on /metrics.
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(hookRequestDuration)
+		legacyregistry.MustRegister(hookDecisions)
+		legacyregistry.MustRegister(hookPatchSize)
+		legacyregistry.MustRegister(hookWarnings)
+		legacyregistry.MustRegister(hookErrors)
+		legacyregistry.MustRegister(hookPanics)
+		legacyregistry.MustRegister(hookViolations)
+		legacyregistry.MustRegister(hookUnmatched)
+		legacyregistry.MustRegister(hookExemptions)
+	})
+}
+
+func recordPanic(resource schema.GroupVersionResource) {
+	hookPanics.WithLabelValues(resource.Group, resource.Version, resource.Resource).Inc()
+}
+
+func recordViolation(resource schema.GroupVersionResource, rule ResponseRule) {
+	hookViolations.WithLabelValues(resource.Group, resource.Version, resource.Resource, string(rule)).Inc()
+}
+
+func recordUnmatched(options HookOptions, admissionSpec *admissionv1.AdmissionRequest) {
+	hookUnmatched.WithLabelValues(requestLabelValues(options.Resource, admissionSpec)...).Inc()
+}
+
+func recordExemption(options HookOptions, admissionSpec *admissionv1.AdmissionRequest, kind ExemptionKind) {
+	hookExemptions.WithLabelValues(append(requestLabelValues(options.Resource, admissionSpec), string(kind))...).Inc()
+}
+
+// recordAdmission records the outcome of one call of the admission hook described by the options. The decision is
+// the one of the hook, regardless of the enforcement mode. hookErr is the error returned by the hook, which the
+// response denies the request for.
+func recordAdmission(options HookOptions, admissionSpec *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse, hookErr error, elapsed time.Duration) {
+	labels := requestLabelValues(options.Resource, admissionSpec)
+
+	decision := decisionDenied
+	if response != nil && response.Allowed {
+		decision = decisionAllowed
+	}
+	enforcement := string(options.enforcementMode())
+	hookRequestDuration.WithLabelValues(append(labels, decision, enforcement)...).Observe(elapsed.Seconds())
+	hookDecisions.WithLabelValues(append(labels, decision, enforcement)...).Inc()
+
+	if hookErr != nil {
+		hookErrors.WithLabelValues(labels...).Inc()
+	}
+	if response == nil {
+		return
+	}
+	if len(response.Patch) > 0 {
+		hookPatchSize.WithLabelValues(labels...).Observe(float64(len(response.Patch)))
+	}
+	if len(response.Warnings) > 0 {
+		hookWarnings.WithLabelValues(labels...).Add(float64(len(response.Warnings)))
+	}
+}
+
+func requestLabelValues(resource schema.GroupVersionResource, admissionSpec *admissionv1.AdmissionRequest) []string {
+	var operation, kind string
+	if admissionSpec != nil {
+		operation = string(admissionSpec.Operation)
+		kind = requestGroupKind(admissionSpec.Kind).String()
+	}
+	return []string{resource.Group, resource.Version, resource.Resource, operation, kind}
+}
@@ -0,0 +1,117 @@
+package admissionreview
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestCreateRecordsMetrics(t *testing.T) {
+	RegisterMetrics()
+	resource := schema.GroupVersionResource{Group: "metrics.test.io", Version: "v1", Resource: "hooks"}
+	labels := []string{resource.Group, resource.Version, resource.Resource, "CREATE", "Deployment.apps"}
+
+	responses := []struct {
+		response *admissionv1.AdmissionResponse
+		err      error
+	}{
+		{response: &admissionv1.AdmissionResponse{Allowed: true, Warnings: []string{"a", "b"}, Patch: []byte(`[{"op":"add","path":"/a","value":1}]`)}},
+		{response: &admissionv1.AdmissionResponse{Allowed: false}},
+		{err: errors.New("boom")},
+	}
+	for _, r := range responses {
+		rest := NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+			return r.response, r.err
+		}, HookOptions{Resource: resource})
+		review := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			Operation: admissionv1.Create,
+		}}
+		if _, err := rest.Create(context.Background(), review, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		got  func() (float64, error)
+		want float64
+	}{
+		{"allowed", func() (float64, error) {
+			return testutil.GetCounterMetricValue(hookDecisions.WithLabelValues(append(labels, decisionAllowed, "enforce")...))
+		}, 1},
+		{"denied", func() (float64, error) {
+			return testutil.GetCounterMetricValue(hookDecisions.WithLabelValues(append(labels, decisionDenied, "enforce")...))
+		}, 2},
+		{"errors", func() (float64, error) { return testutil.GetCounterMetricValue(hookErrors.WithLabelValues(labels...)) }, 1},
+		{"warnings", func() (float64, error) { return testutil.GetCounterMetricValue(hookWarnings.WithLabelValues(labels...)) }, 2},
+	} {
+		got, err := c.got()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+
+	if count, err := testutil.GetHistogramMetricCount(hookPatchSize.WithLabelValues(labels...)); err != nil || count != 1 {
+		t.Errorf("expected one patch size observation, got %d (%v)", count, err)
+	}
+	if count, err := testutil.GetHistogramMetricCount(hookRequestDuration.WithLabelValues(append(labels, decisionDenied, "enforce")...)); err != nil || count != 2 {
+		t.Errorf("expected two denied latency observations, got %d (%v)", count, err)
+	}
+}
+
+func TestCreateSkipsUnmatchedRequests(t *testing.T) {
+	RegisterMetrics()
+	resource := schema.GroupVersionResource{Group: "unmatched.test.io", Version: "v1", Resource: "hooks"}
+	labels := []string{resource.Group, resource.Version, resource.Resource, "CREATE", "Deployment.apps"}
+
+	called := false
+	rest := NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		called = true
+		return &admissionv1.AdmissionResponse{Allowed: false}, nil
+	}, HookOptions{Resource: resource, Match: func(context.Context, *admissionv1.AdmissionRequest) (bool, error) {
+		return false, nil
+	}})
+	review := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Operation: admissionv1.Create,
+	}}
+	out, err := rest.Create(context.Background(), review, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := out.(*admissionv1.AdmissionReview).Response; called || !response.Allowed || response.UID != "uid" {
+		t.Errorf("expected the request to be allowed without calling the hook, got %#v", response)
+	}
+	if got, err := testutil.GetCounterMetricValue(hookUnmatched.WithLabelValues(labels...)); err != nil || got != 1 {
+		t.Errorf("expected one unmatched request, got %v (%v)", got, err)
+	}
+	if got, _ := testutil.GetCounterMetricValue(hookDecisions.WithLabelValues(append(labels, decisionAllowed, "enforce")...)); got != 0 {
+		t.Errorf("expected no decision of the hook, got %v", got)
+	}
+
+	rest = NewV1RESTWithOptions(func(context.Context, *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		t.Error("the hook must not be called when matching fails")
+		return nil, nil
+	}, HookOptions{Resource: resource, Match: func(context.Context, *admissionv1.AdmissionRequest) (bool, error) {
+		return false, errors.New("no namespace")
+	}})
+	out, err = rest.Create(context.Background(), review, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := out.(*admissionv1.AdmissionReview).Response; response.Allowed || !strings.Contains(response.Result.Message, "no namespace") {
+		t.Errorf("expected the matching error to deny the request, got %#v", response)
+	}
+}
@@ -0,0 +1,79 @@
+package admissionreview
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/generic-admission-server/pkg/capture"
+	"github.com/openshift/generic-admission-server/pkg/decisionlog"
+)
+
+// RequestMatcher decides whether an admission request is one an admission hook handles.
+type RequestMatcher func(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (bool, error)
+
+// HookOptions describes the admission hook behind a REST storage and how it is called.
+type HookOptions struct {
+	// Resource is the resource the admission hook is served on. It identifies the hook in logs and metrics.
+	Resource schema.GroupVersionResource
+	// Singular is the singular name of the resource. It defaults to "admissionreview".
+	Singular string
+	// Type is the type of the hook. Patches are only verified to come from mutating hooks if it is set.
+	Type HookType
+
+	// EnforcementMode is how the decisions of the hook are enforced. It defaults to EnforcementModeEnforce.
+	EnforcementMode EnforcementMode
+
+	// DecisionLogger logs the admission decisions of the hook, if set.
+	DecisionLogger *decisionlog.Logger
+
+	// Capturer captures sampled reviews with the responses of the hook, if set.
+	Capturer *capture.Capturer
+
+	// ConformanceMode is how responses violating the admission protocol are handled. It defaults to
+	// ConformanceModeLenient.
+	ConformanceMode ConformanceMode
+
+	// AllowOnPanic allows admission requests for which the hook panicked. By default they are denied.
+	AllowOnPanic bool
+
+	// Exemptions select the admission requests which are allowed without calling the hook or evaluating Match, if
+	// set. They are counted in metrics and recorded in an audit annotation.
+	Exemptions *Exemptions
+
+	// Match selects the admission requests the hook is called for, if set. Other requests are allowed without
+	// calling the hook, and are only counted in metrics. Errors deny the request like errors of the hook.
+	Match RequestMatcher
+}
+
+// handlePanic logs and counts a panic recovered from the admission hook. It returns the Status to deny the request
+// with, or nil if the request is to be allowed.
+func (o HookOptions) handlePanic(uid types.UID, r interface{}) *metav1.Status {
+	klog.ErrorS(nil, "Observed a panic in admission hook", "resource", o.Resource.String(), "uid", uid, "panic", r, "stacktrace", string(debug.Stack()))
+	recordPanic(o.Resource)
+
+	if o.AllowOnPanic {
+		return nil
+	}
+	status := apierrors.NewInternalError(fmt.Errorf("admission hook for %s panicked", o.Resource.GroupResource())).Status()
+	return &status
+}
+
+func (o HookOptions) panicWarning() string {
+	return fmt.Sprintf("admission hook for %s failed, the request was allowed", o.Resource.GroupResource())
+}
+
+// matches tells whether the hook is to be called for the request.
+func (o HookOptions) matches(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (bool, error) {
+	if o.Match == nil {
+		return true, nil
+	}
+	return o.Match(ctx, admissionSpec)
+}
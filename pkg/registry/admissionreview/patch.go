@@ -0,0 +1,59 @@
+package admissionreview
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// identityFields are the metadata fields identifying an object, which the API server does not let admission hooks
+// change.
+var identityFields = []string{"name", "namespace", "uid"}
+
+// ApplyPatch applies the JSONPatch of an admission response to the JSON object.
+func ApplyPatch(obj []byte, response *admissionv1.AdmissionResponse) ([]byte, error) {
+	if len(response.Patch) == 0 {
+		return obj, nil
+	}
+	if response.PatchType != nil && *response.PatchType != admissionv1.PatchTypeJSONPatch {
+		return nil, fmt.Errorf("unsupported patch type %q", *response.PatchType)
+	}
+	patch, err := jsonpatch.DecodePatch(response.Patch)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode patch: %w", err)
+	}
+	patched, err := patch.Apply(obj)
+	if err != nil {
+		return nil, fmt.Errorf("unable to apply patch: %w", err)
+	}
+	return patched, nil
+}
+
+// changedIdentityFields returns the identity fields set in the metadata of the original object which differ in the
+// patched object, as metadata.<field>.
+func changedIdentityFields(original, patched []byte) ([]string, error) {
+	type object struct {
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	var before, after object
+	if err := json.Unmarshal(original, &before); err != nil {
+		return nil, fmt.Errorf("unable to decode object: %w", err)
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return nil, fmt.Errorf("unable to decode patched object: %w", err)
+	}
+
+	var changed []string
+	for _, field := range identityFields {
+		value, ok := before.Metadata[field]
+		if !ok || value == "" {
+			continue
+		}
+		if after.Metadata[field] != value {
+			changed = append(changed, "metadata."+field)
+		}
+	}
+	return changed, nil
+}
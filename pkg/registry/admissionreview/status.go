@@ -0,0 +1,63 @@
+package admissionreview
+
+import (
+	"errors"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// StatusForError converts an error returned by an admission hook into the result of a denied AdmissionResponse:
+//   - API status errors, e.g. from apierrors.NewForbidden, are passed through unchanged.
+//   - A *field.Error or an aggregate of them, e.g. from field.ErrorList.ToAggregate(), becomes an Invalid status
+//     for the reviewed object with one cause per field error.
+//   - Any other error denies the request as Forbidden with the error as message.
+func StatusForError(gk schema.GroupKind, name string, err error) *metav1.Status {
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		status := apiStatus.Status()
+		return &status
+	}
+
+	if errs := fieldErrors(err); len(errs) > 0 {
+		status := apierrors.NewInvalid(gk, name, errs).Status()
+		return &status
+	}
+
+	return &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusForbidden,
+		Reason:  metav1.StatusReasonForbidden,
+		Message: err.Error(),
+	}
+}
+
+// fieldErrors returns the field errors err consists of, or nil if there is any other error in it.
+func fieldErrors(err error) field.ErrorList {
+	var agg utilerrors.Aggregate
+	if errors.As(err, &agg) {
+		var errs field.ErrorList
+		for _, e := range agg.Errors() {
+			var fieldErr *field.Error
+			if !errors.As(e, &fieldErr) {
+				return nil
+			}
+			errs = append(errs, fieldErr)
+		}
+		return errs
+	}
+
+	var fieldErr *field.Error
+	if errors.As(err, &fieldErr) {
+		return field.ErrorList{fieldErr}
+	}
+	return nil
+}
+
+func requestGroupKind(kind metav1.GroupVersionKind) schema.GroupKind {
+	return schema.GroupKind{Group: kind.Group, Kind: kind.Kind}
+}
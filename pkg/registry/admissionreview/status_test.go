@@ -0,0 +1,96 @@
+package admissionreview
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestStatusForError(t *testing.T) {
+	gk := schema.GroupKind{Group: "apps", Kind: "Deployment"}
+
+	cases := []struct {
+		name       string
+		err        error
+		wantCode   int32
+		wantReason metav1.StatusReason
+		wantCauses []metav1.StatusCause
+	}{
+		{
+			name:       "status error",
+			err:        apierrors.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, "foo", errors.New("busy")),
+			wantCode:   http.StatusConflict,
+			wantReason: metav1.StatusReasonConflict,
+		},
+		{
+			name:       "wrapped status error",
+			err:        fmt.Errorf("looking up quota: %w", apierrors.NewServiceUnavailable("try again")),
+			wantCode:   http.StatusServiceUnavailable,
+			wantReason: metav1.StatusReasonServiceUnavailable,
+		},
+		{
+			name:       "field error",
+			err:        field.Invalid(field.NewPath("spec", "replicas"), 20, "must be at most 10"),
+			wantCode:   http.StatusUnprocessableEntity,
+			wantReason: metav1.StatusReasonInvalid,
+			wantCauses: []metav1.StatusCause{
+				{Type: metav1.CauseTypeFieldValueInvalid, Field: "spec.replicas", Message: "Invalid value: 20: must be at most 10"},
+			},
+		},
+		{
+			name: "field error list",
+			err: field.ErrorList{
+				field.Required(field.NewPath("metadata", "labels", "team"), ""),
+				field.Forbidden(field.NewPath("spec", "hostNetwork"), "not allowed"),
+			}.ToAggregate(),
+			wantCode:   http.StatusUnprocessableEntity,
+			wantReason: metav1.StatusReasonInvalid,
+			wantCauses: []metav1.StatusCause{
+				{Type: metav1.CauseTypeFieldValueRequired, Field: "metadata.labels.team", Message: "Required value"},
+				{Type: metav1.CauseTypeForbidden, Field: "spec.hostNetwork", Message: "Forbidden: not allowed"},
+			},
+		},
+		{
+			name:       "plain error",
+			err:        errors.New("replicas must be at most 10"),
+			wantCode:   http.StatusForbidden,
+			wantReason: metav1.StatusReasonForbidden,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status := StatusForError(gk, "foo", c.err)
+			if status.Status != metav1.StatusFailure {
+				t.Errorf("expected status %q, got %q", metav1.StatusFailure, status.Status)
+			}
+			if status.Code != c.wantCode {
+				t.Errorf("expected code %d, got %d", c.wantCode, status.Code)
+			}
+			if status.Reason != c.wantReason {
+				t.Errorf("expected reason %q, got %q", c.wantReason, status.Reason)
+			}
+			if len(status.Message) == 0 {
+				t.Errorf("expected a message")
+			}
+			var causes []metav1.StatusCause
+			if status.Details != nil {
+				causes = status.Details.Causes
+			}
+			if len(causes) != len(c.wantCauses) {
+				t.Fatalf("expected causes %v, got %v", c.wantCauses, causes)
+			}
+			for i := range causes {
+				if causes[i] != c.wantCauses[i] {
+					t.Errorf("expected cause %v, got %v", c.wantCauses[i], causes[i])
+				}
+			}
+		})
+	}
+}
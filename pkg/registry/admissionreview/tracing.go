@@ -0,0 +1,50 @@
+package admissionreview
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/component-base/tracing"
+)
+
+// spanLogThreshold is the duration above which a hook call is logged with its trace.
+const spanLogThreshold = 500 * time.Millisecond
+
+// startSpan starts a child span of the request span for a call of the admission hook. The returned context carries
+// the span, so that client calls of context-aware hooks are traced under it.
+func (o HookOptions) startSpan(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) (context.Context, *tracing.Span) {
+	attributes := []attribute.KeyValue{
+		attribute.String("hook.group", o.Resource.Group),
+		attribute.String("hook.version", o.Resource.Version),
+		attribute.String("hook.resource", o.Resource.Resource),
+		attribute.String("enforcement", string(o.enforcementMode())),
+	}
+	if admissionSpec != nil {
+		attributes = append(attributes,
+			attribute.String("operation", string(admissionSpec.Operation)),
+			attribute.String("group", admissionSpec.Resource.Group),
+			attribute.String("version", admissionSpec.Resource.Version),
+			attribute.String("resource", admissionSpec.Resource.Resource),
+			attribute.String("subresource", admissionSpec.SubResource),
+			attribute.String("namespace", admissionSpec.Namespace),
+			attribute.String("name", admissionSpec.Name),
+		)
+	}
+	return tracing.Start(ctx, "Admission hook", attributes...)
+}
+
+// endSpan records the decision of the admission hook on the span started by startSpan and ends it.
+func endSpan(ctx context.Context, span *tracing.Span, response *admissionv1.AdmissionResponse, hookErr error) {
+	if hookErr != nil {
+		span.RecordError(hookErr)
+	}
+	decision := decisionDenied
+	if response != nil && response.Allowed {
+		decision = decisionAllowed
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("decision", decision))
+	span.End(spanLogThreshold)
+}
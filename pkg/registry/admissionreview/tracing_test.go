@@ -0,0 +1,68 @@
+package admissionreview
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestCreateTracesHookCall(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, requestSpan := provider.Tracer("test").Start(context.Background(), "request")
+
+	var hookSpan trace.SpanContext
+	rest := NewV1RESTWithOptions(func(ctx context.Context, _ *admissionv1.AdmissionRequest) (*admissionv1.AdmissionResponse, error) {
+		hookSpan = trace.SpanContextFromContext(ctx)
+		return &admissionv1.AdmissionResponse{Allowed: true}, nil
+	}, HookOptions{Resource: schema.GroupVersionResource{Group: "tracing.test.io", Version: "v1", Resource: "hooks"}})
+	review := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Resource:  metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		Operation: admissionv1.Create,
+		Namespace: "ns",
+		Name:      "foo",
+	}}
+	if _, err := rest.Create(ctx, review, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	requestSpan.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected a hook and a request span, got %d spans", len(spans))
+	}
+	span := spans[0]
+	if span.Parent().SpanID() != requestSpan.SpanContext().SpanID() {
+		t.Errorf("expected the hook span to be a child of the request span")
+	}
+	if span.SpanContext().SpanID() != hookSpan.SpanID() {
+		t.Errorf("expected the hook to be called with the hook span in its context")
+	}
+
+	got := map[attribute.Key]string{}
+	for _, kv := range span.Attributes() {
+		got[kv.Key] = kv.Value.Emit()
+	}
+	for k, v := range map[attribute.Key]string{
+		"hook.group":    "tracing.test.io",
+		"hook.resource": "hooks",
+		"operation":     "CREATE",
+		"resource":      "deployments",
+		"namespace":     "ns",
+		"name":          "foo",
+		"decision":      "allowed",
+	} {
+		if got[k] != v {
+			t.Errorf("expected attribute %s=%q, got %q", k, v, got[k])
+		}
+	}
+}